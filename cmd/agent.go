@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/jwks_demo/internal/agent"
+	"github.com/jwks_demo/internal/fileoperator"
+	"github.com/jwks_demo/internal/issue"
+	"github.com/spf13/cobra"
+)
+
+// agentCmd represents the agent command
+var agentCmd = &cobra.Command{
+	Use:   "agent",
+	Short: "Hold private keys in memory and sign tokens over a Unix domain socket",
+	Long: `Load the private keys in --private-key-dir and sign for issue / serve over a Unix domain socket
+(like ssh-agent), so that they never read the private key files.
+Set the printed JWKS_DEMO_AGENT_SOCK (or pass --agent-socket) to make issue / serve sign through the agent.
+Keys are referred to by their file names.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		f := fileoperator.NewFileOperator()
+		a := agent.NewAgent()
+		dir, _ := cmd.Flags().GetString("private-key-dir")
+		if err := a.LoadDir(f, dir, passphraseSource(cmd)); err != nil {
+			slog.Error("failed to load private keys", "error", err)
+			os.Exit(1)
+		}
+
+		// ソケットが指定されない場合は新しい一時ディレクトリに作成し、終了時に削除する
+		socketPath := agentSocket(cmd)
+		var l net.Listener
+		var err error
+		if socketPath == "" {
+			l, socketPath, err = agent.ListenTemp()
+			if err == nil {
+				defer os.Remove(filepath.Dir(socketPath))
+			}
+		} else {
+			l, err = agent.Listen(socketPath)
+		}
+		if err != nil {
+			slog.Error("failed to listen", "socket", socketPath, "error", err)
+			os.Exit(1)
+		}
+		slog.Info("start signing agent", "socket", socketPath)
+		fmt.Fprintf(cmd.OutOrStdout(), "%s=%s; export %s;\n", agent.SocketEnv, socketPath, agent.SocketEnv)
+
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-c
+			l.Close()
+		}()
+		if err := a.Serve(l); err != nil {
+			slog.Error("failed to serve", "error", err)
+			os.Exit(1)
+		}
+		slog.Info("signing agent stopped")
+	},
+}
+
+// agentSocket は --agent-socket または JWKS_DEMO_AGENT_SOCK で指定されたエージェントのソケットを返す
+func agentSocket(cmd *cobra.Command) string {
+	if socketPath, _ := cmd.Flags().GetString("agent-socket"); socketPath != "" {
+		return socketPath
+	}
+	return os.Getenv(agent.SocketEnv)
+}
+
+// keyBackendFromFlags は署名鍵のバックエンドを決める
+// エージェントのソケットが指定された場合はエージェントで署名し、無い場合は nil (PEM ファイルを読む) を返す
+func keyBackendFromFlags(cmd *cobra.Command) issue.KeyBackend {
+	if socketPath := agentSocket(cmd); socketPath != "" {
+		return agent.NewClient(socketPath)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(agentCmd)
+	rootCmd.PersistentFlags().String("agent-socket", "", "Unix domain socket of the signing agent (default $"+agent.SocketEnv+"). issue / serve sign through the agent instead of reading private key files")
+
+	agentCmd.Flags().String("private-key-dir", "files/private", "directory of private keys held by the agent")
+}
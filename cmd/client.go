@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/jwks_demo/internal/client"
+	"github.com/spf13/cobra"
+)
+
+// clientCmd represents the client command
+var clientCmd = &cobra.Command{
+	Use:   "client",
+	Short: "Manage clients of the token endpoint",
+}
+
+// clientHashCmd represents the client hash-secret command
+var clientHashCmd = &cobra.Command{
+	Use:   "hash-secret <secret>",
+	Args:  cobra.ExactArgs(1),
+	Short: "Hash a client secret for the client registry file",
+	Run: func(cmd *cobra.Command, args []string) {
+		hash, err := client.HashSecret(args[0])
+		if err != nil {
+			slog.Error("failed to hash client secret", "error", err)
+			os.Exit(1)
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), hash)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(clientCmd)
+	clientCmd.AddCommand(clientHashCmd)
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/jwks_demo/internal/convert"
+	"github.com/jwks_demo/internal/fileoperator"
+	"github.com/spf13/cobra"
+)
+
+// convertCmd represents the convert command
+var convertCmd = &cobra.Command{
+	Use:   "convert <keyPath>",
+	Short: "Convert a key between PEM, JWK, JWKS and OpenSSH formats",
+	Long: `Convert a public or private key to the format given by --to.
+
+The input format is detected from the content:
+  PEM      PKCS#8 / encrypted PKCS#8 / PKCS#1 / SEC1 private keys, SPKI / PKCS#1 public keys
+  JSON     a single JWK or a JWKS (select the key with --kid when it has several keys)
+  OpenSSH  "OPENSSH PRIVATE KEY" private keys and authorized_keys lines
+
+--to is one of pkcs8 (PKCS#8 / SPKI), pkcs1 (RSA only), sec1 (EC private keys only),
+jwk, jwks and openssh. A private key is written as a private key; give --public to
+write only its public key.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		f := fileoperator.NewFileOperator()
+		c := convert.NewConverter(f)
+		c.Passphrase = passphraseSource(cmd)
+		c.Format, _ = cmd.Flags().GetString("to")
+		c.Kid, _ = cmd.Flags().GetString("kid")
+		c.Alg, _ = cmd.Flags().GetString("alg")
+		c.Public, _ = cmd.Flags().GetBool("public")
+
+		result, err := c.ConvertFile(args[0])
+		if err != nil {
+			slog.Error("failed to convert key", "path", args[0], "to", c.Format, "error", err)
+			os.Exit(1)
+		}
+
+		out, _ := cmd.Flags().GetString("out")
+		if out == "" {
+			cmd.OutOrStdout().Write(result.Data)
+			return
+		}
+		var perm os.FileMode = 0644
+		if result.Private {
+			perm = 0600
+		}
+		if err := f.WriteTxtFile(out, result.Data, perm); err != nil {
+			slog.Error("failed to write converted key", "path", out, "error", err)
+			os.Exit(1)
+		}
+		slog.Info("converted key", "path", args[0], "to", c.Format, "out", out, "private", result.Private)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(convertCmd)
+
+	convertCmd.Flags().String("to", convert.FormatPKCS8, "output format ("+strings.Join(convert.Formats(), ", ")+")")
+	convertCmd.Flags().String("kid", "", "kid of the key to take from a JWKS, and kid (or OpenSSH comment) of the output")
+	convertCmd.Flags().String("alg", "", "alg of the output JWK (defaults to the alg of the input JWK or the key type)")
+	convertCmd.Flags().Bool("public", false, "write only the public key of a private key")
+	convertCmd.Flags().String("out", "", "file to write to instead of stdout (0600 for private keys)")
+}
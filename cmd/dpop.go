@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/jwks_demo/internal/fileoperator"
+	"github.com/jwks_demo/internal/issue"
+	"github.com/spf13/cobra"
+)
+
+// dpopCmd represents the dpop command
+var dpopCmd = &cobra.Command{
+	Use:   "dpop",
+	Short: "Create DPoP proofs (RFC 9449)",
+}
+
+var dpopProofCmd = &cobra.Command{
+	Use:   "proof <keyPath>",
+	Short: "Create a DPoP proof for a request with an Ed25519 key",
+	Long: `Create a DPoP proof JWT for the request (--htm, --htu) signed with the Ed25519 key.
+Pass the proof to "issue --dpop-proof" to bind a token to the key, and create another proof
+with --access-token to present the bound token to "verify --dpop-proof".`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		issuer := issue.NewIssuer(fileoperator.NewFileOperator())
+		issuer.Passphrase = passphraseSource(cmd)
+		issuer.Backend = keyBackendFromFlags(cmd)
+
+		htm, _ := cmd.Flags().GetString("htm")
+		htu, _ := cmd.Flags().GetString("htu")
+		accessToken, _ := cmd.Flags().GetString("access-token")
+		proof, err := issuer.DPoPProof(args[0], htm, htu, accessToken)
+		if err != nil {
+			slog.Error("failed to create DPoP proof", "error", err)
+			os.Exit(1)
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), proof)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(dpopCmd)
+	dpopCmd.AddCommand(dpopProofCmd)
+
+	dpopProofCmd.Flags().String("htm", "POST", "HTTP method of the request (htm)")
+	dpopProofCmd.Flags().String("htu", "", "uri of the request (htu)")
+	dpopProofCmd.Flags().String("access-token", "", "access token presented with the proof. sets its hash as ath")
+	dpopProofCmd.MarkFlagRequired("htu")
+}
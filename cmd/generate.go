@@ -1,33 +1,120 @@
 /*
 Copyright © 2025 NAME HERE <EMAIL ADDRESS>
-
 */
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"log/slog"
+	"os"
+	"strings"
 
+	"github.com/jwks_demo/internal/fileoperator"
+	"github.com/jwks_demo/internal/keygen"
 	"github.com/spf13/cobra"
 )
 
 // generateCmd represents the generate command
 var generateCmd = &cobra.Command{
 	Use:   "generate",
-	Short: "A brief description of your command",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
+	Short: "Generate a key pair for signing tokens",
+	Long: `Generate a key pair of --alg (Ed25519, RSA-2048/3072/4096 or P-256/P-384/P-521).
+
+--format selects the output (comma separated, default pem):
+  pem          write the PKCS#8 private key to --private-key-dir (0600) and the SPKI public key
+               to --public-key-dir as <kid>.pem, so that issue can sign with it and serve
+               publishes it in the JWKS with the same kid
+  jwk          print the public key as a JWK Set to stdout
+  private-jwk  print the private key as a JWK Set to stdout
 
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
+Existing keys with the kid are not overwritten unless --force is given.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("generate called")
+		f := fileoperator.NewFileOperator()
+		g := keygen.NewGenerator(f)
+		g.PrivateKeyDir, _ = cmd.Flags().GetString("private-key-dir")
+		g.PublicKeyDir, _ = cmd.Flags().GetString("public-key-dir")
+		g.Force, _ = cmd.Flags().GetBool("force")
+		g.Algorithm, _ = cmd.Flags().GetString("alg")
+		kid, _ := cmd.Flags().GetString("kid")
+		formats, _ := cmd.Flags().GetStringSlice("format")
+
+		var writePEM, publicJWK, privateJWK bool
+		for _, format := range formats {
+			switch format {
+			case "pem":
+				writePEM = true
+			case "jwk":
+				publicJWK = true
+			case "private-jwk":
+				privateJWK = true
+			default:
+				slog.Error("unsupported format", "format", format, "expected", "pem, jwk, private-jwk")
+				os.Exit(1)
+			}
+		}
+		if !writePEM && !publicJWK && !privateJWK {
+			slog.Error("no output format is selected", "expected", "pem, jwk, private-jwk")
+			os.Exit(1)
+		}
+
+		pair, err := g.NewKey(kid)
+		if err != nil {
+			slog.Error("failed to generate key pair", "kid", kid, "error", err)
+			os.Exit(1)
+		}
+		if writePEM {
+			if err := g.WritePEM(pair); err != nil {
+				slog.Error("failed to generate key pair", "kid", kid, "error", err)
+				os.Exit(1)
+			}
+		}
+
+		// JWK を出力する場合は標準出力を JSON だけにする
+		if !publicJWK && !privateJWK {
+			fmt.Fprintln(cmd.OutOrStdout(), pair.PrivateKeyPath)
+			fmt.Fprintln(cmd.OutOrStdout(), pair.PublicKeyPath)
+			return
+		}
+		set := struct {
+			Keys []any `json:"keys"`
+		}{}
+		if publicJWK {
+			key, err := pair.PublicJWK()
+			if err != nil {
+				slog.Error("failed to encode public key as JWK", "kid", kid, "error", err)
+				os.Exit(1)
+			}
+			set.Keys = append(set.Keys, key)
+		}
+		if privateJWK {
+			key, err := pair.PrivateJWK()
+			if err != nil {
+				slog.Error("failed to encode private key as JWK", "kid", kid, "error", err)
+				os.Exit(1)
+			}
+			set.Keys = append(set.Keys, key)
+		}
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(set); err != nil {
+			slog.Error("failed to write JWK Set", "error", err)
+			os.Exit(1)
+		}
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(generateCmd)
 
+	generateCmd.Flags().String("kid", "", "kid of the key pair. used as the file name (<kid>.pem)")
+	generateCmd.MarkFlagRequired("kid")
+	generateCmd.Flags().String("private-key-dir", "files/private", "directory to write the private key to")
+	generateCmd.Flags().String("public-key-dir", "files/public", "directory to write the public key to")
+	generateCmd.Flags().Bool("force", false, "overwrite existing key files with the same kid")
+	generateCmd.Flags().String("alg", keygen.AlgEd25519, "key type to generate ("+strings.Join(keygen.Algorithms(), ", ")+")")
+	generateCmd.Flags().StringSlice("format", []string{"pem"}, "output formats (pem, jwk, private-jwk)")
+
 	// Here you will define your flags and configuration settings.
 
 	// Cobra supports Persistent Flags which will work for this command
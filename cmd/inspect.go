@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+
+	"github.com/jwks_demo/internal/fileoperator"
+	"github.com/jwks_demo/internal/inspect"
+	"github.com/spf13/cobra"
+)
+
+// inspectCmd represents the inspect command
+var inspectCmd = &cobra.Command{
+	Use:   "inspect <file|url>",
+	Short: "Show the type, size, kid and fingerprints of keys",
+	Long: `Show what serve and issue make of a key file, a JWK, a JWKS document (file or URL)
+or a compact token (JWS / JWE).
+
+For every key it prints the key type and curve or size, the kid (for key files the kid
+serve assigns with the same --kid-mode / --kid-map), the RFC 7638 JWK thumbprint,
+the SHA-256 fingerprint of the SPKI, the private keys in --private-key-dir that
+match it and its state in --key-manifest. For a token it prints the header and the
+key in --public-key-dir with its kid.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		f := fileoperator.NewFileOperator()
+		i := inspect.NewInspector(f)
+		i.Passphrase = passphraseSource(cmd)
+		i.PublicKeyDir, _ = cmd.Flags().GetString("public-key-dir")
+		i.PrivateKeyDir, _ = cmd.Flags().GetString("private-key-dir")
+		resolver, err := kidResolverFromFlags(cmd, f)
+		if err != nil {
+			slog.Error("failed to configure kid", "error", err)
+			os.Exit(1)
+		}
+		i.KidResolver = resolver
+		if i.Lifecycle, err = keyManifestFromFlags(cmd, f); err != nil {
+			slog.Error("failed to load key manifest", "error", err)
+			os.Exit(1)
+		}
+
+		report, err := i.Inspect(args[0])
+		if err != nil {
+			slog.Error("failed to inspect", "source", args[0], "error", err)
+			os.Exit(1)
+		}
+
+		if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+			enc := json.NewEncoder(cmd.OutOrStdout())
+			enc.SetIndent("", "  ")
+			err = enc.Encode(report)
+		} else {
+			err = report.WriteText(cmd.OutOrStdout())
+		}
+		if err != nil {
+			slog.Error("failed to write report", "error", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(inspectCmd)
+
+	inspectCmd.Flags().String("public-key-dir", "files/public", "directory of published public keys used to resolve the kid of tokens")
+	inspectCmd.Flags().String("private-key-dir", "files/private", "directory of private keys to match against")
+	inspectCmd.Flags().Bool("json", false, "print the report as JSON")
+	addKidFlags(inspectCmd)
+	addKeyManifestFlag(inspectCmd)
+}
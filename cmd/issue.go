@@ -1,22 +1,31 @@
 package cmd
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
 	"log/slog"
+	"net/http"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
 
+	"github.com/jwks_demo/internal/config"
 	"github.com/jwks_demo/internal/fileoperator"
 	"github.com/jwks_demo/internal/issue"
+	"github.com/jwks_demo/internal/status"
 	"github.com/spf13/cobra"
 )
 
-// 秘密鍵作成
-// openssl genpkey -algorithm ed25519 -out ed25519.pem
-// 秘密鍵から公開鍵を作成
-// openssl pkey -in ed25519.pem -pubout -out ed25519_pub.pem
+// 鍵ペアの作成
+// jwks_demo generate --kid <kid>
 // issueCmd represents the issue command
 var issueCmd = &cobra.Command{
-	Use:   "issue <keyPath> <kid>",
-	Args:  cobra.ExactArgs(2),
+	Use:   "issue [<keyPath> [kid]]",
+	Args:  cobra.RangeArgs(0, 2),
 	Short: "A brief description of your command",
 	Long: `A longer description that spans multiple lines and likely contains examples
 and usage of using your command. For example:
@@ -27,19 +36,398 @@ to quickly create a Cobra application.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		f := fileoperator.NewFileOperator()
 		issuer := issue.NewIssuer(f)
+		issuer.Algorithm, _ = cmd.Flags().GetString("alg")
+		issuer.Passphrase = passphraseSource(cmd)
+		issuer.Backend = keyBackendFromFlags(cmd)
 
-		keyPath := args[0]
-		kid := args[1]
+		profile, err := profileFromFlags(cmd, f)
+		if err != nil {
+			slog.Error("failed to load profile", "error", err)
+			os.Exit(1)
+		}
+
+		keyPath, kid, err := signingKeyFromFlags(cmd, f, issuer, profileKeyArgs(cmd, profile, args))
+		if err != nil {
+			slog.Error("failed to determine signing key", "error", err)
+			os.Exit(1)
+		}
+
+		opts, err := claimsOptionsFromFlags(cmd, profile)
+		if err != nil {
+			slog.Error("invalid claim options", "error", err)
+			os.Exit(1)
+		}
+		if err := claimSourcesFromFlags(cmd, issuer); err != nil {
+			slog.Error("invalid claim options", "error", err)
+			os.Exit(1)
+		}
+
+		claims, err := issuer.BuildClaims(opts)
+		if err != nil {
+			slog.Error("failed to build claims", "error", err)
+			os.Exit(1)
+		}
+
+		// DPoP proof が指定された場合はトークンを proof の鍵に結び付ける (cnf.jkt)
+		if proof, _ := cmd.Flags().GetString("dpop-proof"); proof != "" {
+			htm, _ := cmd.Flags().GetString("dpop-htm")
+			htu, _ := cmd.Flags().GetString("dpop-htu")
+			if err := issuer.BindDPoP(claims, proof, htm, htu); err != nil {
+				slog.Error("failed to bind DPoP proof", "error", err)
+				os.Exit(1)
+			}
+		}
+
+		// クライアント証明書が指定された場合はトークンを証明書に結び付ける (cnf["x5t#S256"])
+		if certPath, _ := cmd.Flags().GetString("client-cert"); certPath != "" {
+			if err := issuer.BindCertificate(claims, certPath); err != nil {
+				slog.Error("failed to bind client certificate", "error", err)
+				os.Exit(1)
+			}
+		}
+
+		// ステータスリストが指定された場合は status クレームを埋め込む
+		// 保存するまでロックし、同時に実行した issue / status コマンドと同じインデックスの割り当てや更新の消失を防ぐ
+		var store *status.Store
+		if statusList, _ := cmd.Flags().GetString("status-list"); statusList != "" {
+			statusURI, _ := cmd.Flags().GetString("status-uri")
+			unlock, err := status.Lock(statusList)
+			if err != nil {
+				slog.Error("failed to lock status list", "error", err)
+				os.Exit(1)
+			}
+			defer unlock()
+			if store, err = status.LoadStore(f, statusList); err != nil {
+				slog.Error("failed to load status list", "error", err)
+				os.Exit(1)
+			}
+			if err := store.Attach(claims, statusURI); err != nil {
+				slog.Error("failed to attach status", "error", err)
+				os.Exit(1)
+			}
+		}
 
-		if err := issuer.Issue(keyPath, kid); err != nil {
+		issued, err := issuer.Issue(keyPath, kid, claims)
+		if err != nil {
 			slog.Error("failed to issue", "error", err)
 			os.Exit(1)
 		}
+
+		// 受信者の公開鍵が指定された場合は署名済みトークンを JWE で包む
+		token := issued.Token
+		if encryptTo, _ := cmd.Flags().GetString("encrypt-to"); encryptTo != "" {
+			encKid, _ := cmd.Flags().GetString("encrypt-kid")
+			if token, err = issuer.Encrypt(token, encryptTo, encKid); err != nil {
+				slog.Error("failed to encrypt", "error", err)
+				os.Exit(1)
+			}
+		}
+
+		// 署名に成功した場合のみインデックスの割り当てを保存する
+		if store != nil {
+			if err := store.Save(); err != nil {
+				slog.Error("failed to save status list", "error", err)
+				os.Exit(1)
+			}
+		}
+
+		// トークンのみを出力し、ログは stderr に出す
+		out, _ := cmd.Flags().GetString("out")
+		if out == "" {
+			fmt.Fprintln(cmd.OutOrStdout(), token)
+			return
+		}
+		if err := f.WriteTxtFile(out, []byte(token+"\n"), 0600); err != nil {
+			slog.Error("failed to write token", "file", out, "error", err)
+			os.Exit(1)
+		}
 	},
 }
 
+var issueBatchCmd = &cobra.Command{
+	Use:   "batch [<keyPath> [kid]]",
+	Args:  cobra.RangeArgs(0, 2),
+	Short: "Issue tokens for each claim set in a JSONL or CSV file",
+	Long: `Issue a token for each claim set read from --input (JSONL or CSV, "-" for stdin)
+and write them as JSONL ({"token": ..., "jti": ..., "exp": ...}) in input order.
+Claims given by flags are used as defaults and overridden by each input record.
+The private key is parsed once and tokens are signed in parallel by --workers goroutines.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		f := fileoperator.NewFileOperator()
+		issuer := issue.NewIssuer(f)
+		issuer.Algorithm, _ = cmd.Flags().GetString("alg")
+		issuer.Passphrase = passphraseSource(cmd)
+		issuer.Backend = keyBackendFromFlags(cmd)
+
+		profile, err := profileFromFlags(cmd, f)
+		if err != nil {
+			slog.Error("failed to load profile", "error", err)
+			os.Exit(1)
+		}
+
+		keyPath, kid, err := signingKeyFromFlags(cmd, f, issuer, profileKeyArgs(cmd, profile, args))
+		if err != nil {
+			slog.Error("failed to determine signing key", "error", err)
+			os.Exit(1)
+		}
+
+		opts, err := claimsOptionsFromFlags(cmd, profile)
+		if err != nil {
+			slog.Error("invalid claim options", "error", err)
+			os.Exit(1)
+		}
+		if err := claimSourcesFromFlags(cmd, issuer); err != nil {
+			slog.Error("invalid claim options", "error", err)
+			os.Exit(1)
+		}
+
+		input, _ := cmd.Flags().GetString("input")
+		format, _ := cmd.Flags().GetString("format")
+		if format == "" {
+			format = issue.BatchFormatJSONL
+			if strings.EqualFold(filepath.Ext(input), ".csv") {
+				format = issue.BatchFormatCSV
+			}
+		}
+		var r io.Reader = cmd.InOrStdin()
+		if input != "-" {
+			file, err := os.Open(input)
+			if err != nil {
+				slog.Error("failed to open input", "file", input, "error", err)
+				os.Exit(1)
+			}
+			defer file.Close()
+			r = file
+		}
+		records, err := issue.ReadBatchInput(r, format)
+		if err != nil {
+			slog.Error("failed to read input", "file", input, "error", err)
+			os.Exit(1)
+		}
+
+		// 署名を始める前に全ての入力を検証する
+		claims, err := issuer.BuildBatchClaims(opts, records)
+		if err != nil {
+			slog.Error("failed to build claims", "error", err)
+			os.Exit(1)
+		}
+
+		signer, err := issuer.NewSigner(keyPath, kid)
+		if err != nil {
+			slog.Error("failed to load signing key", "error", err)
+			os.Exit(1)
+		}
+		workers, _ := cmd.Flags().GetInt("workers")
+		results, err := issue.IssueBatch(signer, claims, workers)
+		if err != nil {
+			slog.Error("failed to issue", "error", err)
+			os.Exit(1)
+		}
+
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		for _, res := range results {
+			if err := enc.Encode(res); err != nil {
+				slog.Error("failed to encode result", "error", err)
+				os.Exit(1)
+			}
+		}
+		slog.Info("successfully issued JWTs", "kid", kid, "count", len(results))
+
+		out, _ := cmd.Flags().GetString("out")
+		if out == "" {
+			cmd.OutOrStdout().Write(buf.Bytes())
+			return
+		}
+		if err := f.WriteTxtFile(out, buf.Bytes(), 0600); err != nil {
+			slog.Error("failed to write tokens", "file", out, "error", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// signingKeyFromFlags は署名に使う秘密鍵のパスと kid を決める
+// kid が引数で指定されない場合は serve と同じ規則 (--kid-mode, --kid-map) で鍵ファイルから決める
+// --skip-publish-check が無い場合は、公開鍵が公開鍵ディレクトリまたは JWKS で公開されていることを確認する
+// --key-manifest が指定された場合は issuer に設定し、active でない鍵では署名しない
+func signingKeyFromFlags(cmd *cobra.Command, f *fileoperator.FileOperator, issuer *issue.Issuer, args []string) (string, string, error) {
+	flags := cmd.Flags()
+	auto, _ := flags.GetBool("auto")
+	skipCheck, _ := flags.GetBool("skip-publish-check")
+	if auto && len(args) > 0 {
+		return "", "", fmt.Errorf("--auto cannot be used with <keyPath> and [kid]")
+	}
+	if !auto && len(args) == 0 {
+		return "", "", fmt.Errorf("<keyPath> is required unless --auto or a --profile with key is specified")
+	}
+	if auto && skipCheck {
+		return "", "", fmt.Errorf("--auto cannot be used with --skip-publish-check")
+	}
+
+	resolver, err := kidResolverFromFlags(cmd, f)
+	if err != nil {
+		return "", "", err
+	}
+	if issuer.Lifecycle, err = keyManifestFromFlags(cmd, f); err != nil {
+		return "", "", err
+	}
+
+	var published issue.PublishedKeys
+	if !skipCheck {
+		if jwksURL, _ := flags.GetString("jwks-url"); jwksURL != "" {
+			published, err = issue.FetchPublishedKeys(&http.Client{Timeout: 10 * time.Second}, jwksURL)
+		} else {
+			publicKeyDir, _ := flags.GetString("public-key-dir")
+			published, err = issue.LoadPublishedKeyDir(f, publicKeyDir, resolver)
+		}
+		if err != nil {
+			return "", "", fmt.Errorf("failed to load published keys: %w", err)
+		}
+	}
+
+	if auto {
+		privateKeyDir, _ := flags.GetString("private-key-dir")
+		return issuer.SelectActiveKey(f, privateKeyDir, resolver, published)
+	}
+
+	keyPath := args[0]
+	pub, err := issuer.PublicKey(keyPath)
+	if err != nil {
+		return "", "", err
+	}
+	kid := ""
+	if len(args) > 1 {
+		kid = args[1]
+	} else if kid, err = resolver.Kid(keyPath, pub); err != nil {
+		return "", "", err
+	}
+
+	if published != nil {
+		if err := published.Check(kid, pub); err != nil {
+			return "", "", err
+		}
+	}
+	return keyPath, kid, nil
+}
+
+// addSigningKeyFlags は署名鍵の選択と公開確認のフラグを追加する (signingKeyFromFlags で使う)
+func addSigningKeyFlags(c *cobra.Command) {
+	addKidFlags(c)
+	addKeyManifestFlag(c)
+	c.Flags().Bool("auto", false, "sign with the newest private key in --private-key-dir whose public key is published (and active in --key-manifest)")
+	c.Flags().String("private-key-dir", "files/private", "directory of private keys searched by --auto")
+	c.Flags().String("public-key-dir", "files/public", "directory of published public keys used to check the signing key")
+	c.Flags().String("jwks-url", "", "check the signing key against the JWKS at this URL instead of --public-key-dir")
+	c.Flags().Bool("skip-publish-check", false, "do not check that the public key of the signing key is published")
+	c.Flags().String("alg", "", "signing algorithm (EdDSA, RS256/384/512, PS256/384/512, ES256/384/512). default is derived from the key")
+}
+
+// addClaimFlags はクレームを指定するフラグを追加する (claimsOptionsFromFlags で使う)
+func addClaimFlags(c *cobra.Command) {
+	c.Flags().String("claims-file", "", "JSON file containing the claims to issue")
+	c.Flags().String("claims-template", "", "JSON file of claims whose string values are Go templates rendered for each token (functions: uuid, now, add, unix, rfc3339, env, random, randInt)")
+	c.Flags().String("iss", "", "issuer (iss) claim")
+	c.Flags().String("sub", "", "subject (sub) claim")
+	c.Flags().StringSlice("aud", nil, "audience (aud) claim. can be specified multiple times")
+	c.Flags().Duration("lifetime", 0, "token lifetime (exp = iat + lifetime, default 1h)")
+	c.Flags().String("nbf", "", "not before (nbf) claim in RFC3339 or unix seconds")
+	c.Flags().String("iat", "", "issued at (iat) claim in RFC3339 or unix seconds (default now)")
+	c.Flags().StringArray("claim", nil, "extra claim in key=value form. value is parsed as JSON if possible")
+	c.Flags().String("claims-provider", "", "executable that receives {\"sub\", \"aud\"} JSON on stdin and prints additional claims JSON on stdout. issuance fails if it fails")
+	c.Flags().Duration("claims-provider-timeout", issue.DefaultProviderTimeout, "timeout of the claims provider")
+	c.Flags().String("claims-conflict", issue.ConflictError, "how to handle claims from the claims provider that already exist (error, override or keep)")
+}
+
+// claimsOptionsFromFlags はフラグの値から issue.ClaimsOptions を組み立てる
+// profile が指定された場合はその値を最も優先度の低い既定値とし、フラグやクレームファイルの値で上書きする
+func claimsOptionsFromFlags(cmd *cobra.Command, profile *config.Profile) (issue.ClaimsOptions, error) {
+	var opts issue.ClaimsOptions
+	flags := cmd.Flags()
+
+	if profile != nil {
+		opts.Defaults = issue.ClaimsDefaults{
+			Issuer:   profile.Issuer,
+			Subject:  profile.Subject,
+			Audience: profile.Audience,
+			Lifetime: profile.Lifetime,
+			Extra:    profile.Claims,
+		}
+	}
+
+	opts.ClaimsFile, _ = flags.GetString("claims-file")
+	opts.Issuer, _ = flags.GetString("iss")
+	opts.Subject, _ = flags.GetString("sub")
+	opts.Audience, _ = flags.GetStringSlice("aud")
+	opts.Lifetime, _ = flags.GetDuration("lifetime")
+
+	if v, _ := flags.GetString("nbf"); v != "" {
+		t, err := issue.ParseTime(v)
+		if err != nil {
+			return opts, err
+		}
+		opts.NotBefore = t
+	}
+	if v, _ := flags.GetString("iat"); v != "" {
+		t, err := issue.ParseTime(v)
+		if err != nil {
+			return opts, err
+		}
+		opts.IssuedAt = t
+	}
+
+	claimArgs, _ := flags.GetStringArray("claim")
+	extra, err := issue.ParseClaimArgs(claimArgs)
+	if err != nil {
+		return opts, err
+	}
+	opts.Extra = extra
+
+	return opts, nil
+}
+
+// claimSourcesFromFlags はトークンごとに署名前に適用するクレームテンプレートと外部クレームプロバイダーを issuer に設定する
+func claimSourcesFromFlags(cmd *cobra.Command, issuer *issue.Issuer) error {
+	flags := cmd.Flags()
+	if path, _ := flags.GetString("claims-template"); path != "" {
+		tmpl, err := issuer.LoadClaimsTemplate(path)
+		if err != nil {
+			return fmt.Errorf("failed to load claims template %s: %w", path, err)
+		}
+		issuer.Template = tmpl
+	}
+	if path, _ := flags.GetString("claims-provider"); path != "" {
+		provider := issue.NewExecProvider(path)
+		provider.Timeout, _ = flags.GetDuration("claims-provider-timeout")
+		issuer.Provider = provider
+		issuer.ProviderConflict, _ = flags.GetString("claims-conflict")
+	}
+	return nil
+}
+
 func init() {
 	rootCmd.AddCommand(issueCmd)
+	issueCmd.AddCommand(issueBatchCmd)
+
+	addSigningKeyFlags(issueCmd)
+	addClaimFlags(issueCmd)
+	issueCmd.Flags().String("profile", "", "issuer profile in the config file. flags override the profile values")
+	issueCmd.Flags().StringP("out", "o", "", "write the token to the file instead of stdout")
+	issueCmd.Flags().String("status-list", "", "status list file. allocates an index and embeds the status claim")
+	issueCmd.Flags().String("status-uri", "http://localhost:8080/statuslist", "uri of the status list token embedded in the status claim")
+	issueCmd.Flags().String("encrypt-to", "", "recipient public key (X25519 or RSA PEM). wraps the signed token in a JWE")
+	issueCmd.Flags().String("encrypt-kid", "", "kid of the recipient encryption key set in the JWE header")
+	issueCmd.Flags().String("dpop-proof", "", "DPoP proof JWT (RFC 9449). binds the token to the proof key with the cnf.jkt claim")
+	issueCmd.Flags().String("dpop-htm", "", "expected htm of the DPoP proof (checked with --dpop-htu)")
+	issueCmd.Flags().String("dpop-htu", "", "expected htu of the DPoP proof, e.g. the token endpoint uri (not checked if empty)")
+	issueCmd.Flags().String("client-cert", "", "client certificate (PEM) for mutual TLS. binds the token to it with the cnf x5t#S256 claim (RFC 8705)")
+
+	addSigningKeyFlags(issueBatchCmd)
+	addClaimFlags(issueBatchCmd)
+	issueBatchCmd.Flags().String("profile", "", "issuer profile in the config file. flags override the profile values")
+	issueBatchCmd.Flags().StringP("input", "i", "-", "JSONL or CSV file of claim sets (\"-\" for stdin)")
+	issueBatchCmd.Flags().String("format", "", "input format (jsonl or csv). default is csv for a .csv input and jsonl otherwise")
+	issueBatchCmd.Flags().Int("workers", runtime.NumCPU(), "number of goroutines signing tokens in parallel")
+	issueBatchCmd.Flags().StringP("out", "o", "", "write the tokens as JSONL to the file instead of stdout")
 
 	// Here you will define your flags and configuration settings.
 
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"github.com/jwks_demo/internal/fileoperator"
+	"github.com/jwks_demo/internal/jwk"
+	"github.com/jwks_demo/internal/lifecycle"
+	"github.com/spf13/cobra"
+)
+
+// addKidFlags は kid の決め方を指定するフラグを追加する
+// issue と serve で同じ値を指定するとトークンの kid と JWKS の kid が一致する
+func addKidFlags(c *cobra.Command) {
+	c.Flags().String("kid-mode", jwk.KidModeFilename, "how to derive kids from key files (filename: file name without extension, thumbprint: RFC 7638 JWK thumbprint)")
+	c.Flags().String("kid-map", "", "JSON file overriding kids ({\"<thumbprint or file name>\": \"<kid>\"})")
+}
+
+// kidResolverFromFlags はフラグの値から jwk.KidResolver を作る
+func kidResolverFromFlags(cmd *cobra.Command, f *fileoperator.FileOperator) (*jwk.KidResolver, error) {
+	mode, _ := cmd.Flags().GetString("kid-mode")
+	kidMap, _ := cmd.Flags().GetString("kid-map")
+	return jwk.NewKidResolver(f, mode, kidMap)
+}
+
+// addKeyManifestFlag は鍵のライフサイクルのマニフェストを指定するフラグを追加する
+// issue と serve で同じファイルを指定すると、serve が公開する鍵と issue が署名に使う鍵が一致する
+func addKeyManifestFlag(c *cobra.Command) {
+	c.Flags().String("key-manifest", "", "JSON file of key lifecycle metadata (activation, signing stop, retirement and status per kid)")
+}
+
+// keyManifestFromFlags は --key-manifest のマニフェストを読み込む (指定が無い場合は nil)
+func keyManifestFromFlags(cmd *cobra.Command, f *fileoperator.FileOperator) (*lifecycle.Manifest, error) {
+	path, _ := cmd.Flags().GetString("key-manifest")
+	if path == "" {
+		return nil, nil
+	}
+	return lifecycle.Load(f, path)
+}
@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"github.com/jwks_demo/internal/passphrase"
+	"github.com/spf13/cobra"
+)
+
+// passphraseSource はフラグの指定から暗号化された秘密鍵のパスフレーズの取得元を決める
+// --passphrase-env, --passphrase-fd の順に優先し、どちらも無い場合は端末で入力を求める
+// パスフレーズは暗号化された鍵を読むときに一度だけ取得する
+func passphraseSource(cmd *cobra.Command) passphrase.Source {
+	if name, _ := cmd.Flags().GetString("passphrase-env"); name != "" {
+		return passphrase.Cached(passphrase.FromEnv(name))
+	}
+	if fd, _ := cmd.Flags().GetInt("passphrase-fd"); fd >= 0 {
+		return passphrase.Cached(passphrase.FromFD(fd))
+	}
+	return passphrase.Cached(passphrase.Prompt("Enter passphrase for private key: "))
+}
+
+func init() {
+	rootCmd.PersistentFlags().String("passphrase-env", "", "environment variable containing the passphrase of encrypted private keys")
+	rootCmd.PersistentFlags().Int("passphrase-fd", -1, "file descriptor to read the passphrase of encrypted private keys from")
+}
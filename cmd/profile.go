@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jwks_demo/internal/config"
+	"github.com/jwks_demo/internal/fileoperator"
+	"github.com/spf13/cobra"
+)
+
+// loadConfig は --config の設定ファイルを読み込む
+// --config が指定されない場合は $HOME/.jwks_demo.yaml を読み、存在しなければ nil を返す
+func loadConfig(f *fileoperator.FileOperator) (*config.Config, error) {
+	path := cfgFile
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, nil
+		}
+		path = filepath.Join(home, config.DefaultFileName)
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+	}
+	return config.Load(f, path)
+}
+
+// profileFromFlags は --profile で指定されたプロファイルを返す (--profile が無い場合は nil)
+func profileFromFlags(cmd *cobra.Command, f *fileoperator.FileOperator) (*config.Profile, error) {
+	name, _ := cmd.Flags().GetString("profile")
+	if name == "" {
+		return nil, nil
+	}
+	c, err := loadConfig(f)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, fmt.Errorf("--profile %q requires a config file (--config or $HOME/%s)", name, config.DefaultFileName)
+	}
+	return c.Profile(name)
+}
+
+// profileKeyArgs は <keyPath> と [kid] が指定されていない場合にプロファイルの key と kid を引数として補う
+// --auto が指定された場合はプロファイルの鍵を使わない
+func profileKeyArgs(cmd *cobra.Command, p *config.Profile, args []string) []string {
+	auto, _ := cmd.Flags().GetBool("auto")
+	if p == nil || p.Key == "" || len(args) > 0 || auto {
+		return args
+	}
+	if p.Kid != "" {
+		return []string{p.Key, p.Kid}
+	}
+	return []string{p.Key}
+}
@@ -6,7 +6,8 @@ import (
 	"github.com/spf13/cobra"
 )
 
-
+// cfgFile は --config で指定された設定ファイル (空の場合は $HOME/.jwks_demo.yaml)
+var cfgFile string
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
@@ -37,11 +38,9 @@ func init() {
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
 
-	// rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.jwks_demo.yaml)")
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file defining issuer profiles (default is $HOME/.jwks_demo.yaml)")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
-
-
@@ -6,8 +6,14 @@ package cmd
 import (
 	"fmt"
 	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
 
+	"github.com/jwks_demo/internal/client"
 	"github.com/jwks_demo/internal/fileoperator"
+	"github.com/jwks_demo/internal/issue"
+	"github.com/jwks_demo/internal/pkcs8"
 	"github.com/jwks_demo/internal/server"
 	"github.com/spf13/cobra"
 )
@@ -27,6 +33,55 @@ to quickly create a Cobra application.`,
 		f := fileoperator.NewFileOperator()
 		srv := server.NewServer(f, 8080)
 
+		// クライアントレジストリが指定された場合はトークンエンドポイントを有効にする
+		if clientsPath, _ := cmd.Flags().GetString("clients"); clientsPath != "" {
+			registry, err := client.LoadRegistry(f, clientsPath)
+			if err != nil {
+				slog.Error("failed to load client registry", "error", err)
+				os.Exit(1)
+			}
+			srv.Clients = registry
+		}
+		srv.PrivateKeyDir, _ = cmd.Flags().GetString("private-key-dir")
+		resolver, err := kidResolverFromFlags(cmd, f)
+		if err != nil {
+			slog.Error("invalid kid options", "error", err)
+			os.Exit(1)
+		}
+		srv.KidResolver = resolver
+		manifest, err := keyManifestFromFlags(cmd, f)
+		if err != nil {
+			slog.Error("failed to load key manifest", "error", err)
+			os.Exit(1)
+		}
+		srv.Lifecycle = manifest
+		issuer := issue.NewIssuer(f)
+		issuer.Lifecycle = manifest
+		issuer.Passphrase = passphraseSource(cmd)
+		issuer.Backend = keyBackendFromFlags(cmd)
+		srv.Issuer = issuer
+		// エージェントで署名する場合は秘密鍵を読まないため以下は不要
+		if issuer.Backend == nil {
+			// 暗号化された秘密鍵がある場合はリクエストの処理中に入力を求めないよう起動時にパスフレーズを取得する
+			if hasEncryptedKey(f, srv.PrivateKeyDir) {
+				if _, err := issuer.Passphrase(); err != nil {
+					slog.Error("failed to get passphrase of private keys", "error", err)
+					os.Exit(1)
+				}
+			}
+			// 秘密鍵の読み込みと復号をリクエストごとに行わないよう、読み込んだ鍵を保持する
+			issuer.Backend = issue.NewCachingBackend(&issue.PEMBackend{FileOperator: f, Passphrase: issuer.Passphrase})
+		}
+		srv.SigningKid, _ = cmd.Flags().GetString("signing-kid")
+		srv.IssuerName, _ = cmd.Flags().GetString("issuer-name")
+		srv.TokenEndpointURL, _ = cmd.Flags().GetString("token-endpoint-url")
+		srv.TokenLifetime, _ = cmd.Flags().GetDuration("token-lifetime")
+		srv.IntrospectionJWT, _ = cmd.Flags().GetBool("introspection-jwt")
+		srv.StatusListFile, _ = cmd.Flags().GetString("status-list")
+		srv.StatusListURI, _ = cmd.Flags().GetString("status-uri")
+		srv.StatusListTTL, _ = cmd.Flags().GetDuration("status-list-ttl")
+		srv.EncryptionKeyDir, _ = cmd.Flags().GetString("enc-key-dir")
+
 		if err := srv.Start(); err != nil {
 			fmt.Println("failed to run server", "error", err)
 			slog.Error("failed to run server", "error", err)
@@ -34,9 +89,38 @@ to quickly create a Cobra application.`,
 	},
 }
 
+// hasEncryptedKey は dir にパスフレーズで暗号化された秘密鍵があるかどうかを返す
+func hasEncryptedKey(f *fileoperator.FileOperator, dir string) bool {
+	names, err := f.GetFileNames(dir)
+	if err != nil {
+		return false
+	}
+	for _, name := range names {
+		b, err := f.LoadTxtFile(filepath.Join(dir, name))
+		if err == nil && pkcs8.IsEncryptedPEM(b) {
+			return true
+		}
+	}
+	return false
+}
+
 func init() {
 	rootCmd.AddCommand(serveCmd)
 
+	addKidFlags(serveCmd)
+	addKeyManifestFlag(serveCmd)
+	serveCmd.Flags().String("clients", "", "client registry file. enables the token endpoint (POST /token) and introspection endpoint (POST /introspect)")
+	serveCmd.Flags().String("private-key-dir", "files/private", "directory of private keys used by the token endpoint")
+	serveCmd.Flags().String("signing-kid", "", "kid of the key used by the token endpoint (default is the first published key that is active in --key-manifest)")
+	serveCmd.Flags().String("issuer-name", "jwks_demo_issuer", "iss claim of tokens issued by the token endpoint")
+	serveCmd.Flags().String("token-endpoint-url", "http://localhost:8080/token", "public URL of the token endpoint. accepted with --issuer-name as the aud of private_key_jwt client assertions")
+	serveCmd.Flags().Duration("token-lifetime", time.Hour, "lifetime of tokens issued by the token endpoint")
+	serveCmd.Flags().String("status-list", "", "status list file. enables the status list endpoint (GET /statuslist)")
+	serveCmd.Flags().String("status-uri", "http://localhost:8080/statuslist", "uri of the status list token (sub claim)")
+	serveCmd.Flags().Duration("status-list-ttl", 5*time.Minute, "ttl of the status list token")
+	serveCmd.Flags().String("enc-key-dir", "", "directory of X25519 / RSA public keys published in the JWKS as encryption keys (use: enc)")
+	serveCmd.Flags().Bool("introspection-jwt", false, "always return introspection responses as signed JWTs (RFC 9701)")
+
 	// Here you will define your flags and configuration settings.
 
 	// Cobra supports Persistent Flags which will work for this command
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/jwks_demo/internal/fileoperator"
+	"github.com/jwks_demo/internal/status"
+	"github.com/spf13/cobra"
+)
+
+// statusCmd represents the status command
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Change the status of issued tokens in the status list",
+}
+
+var statusRevokeCmd = &cobra.Command{
+	Use:   "revoke",
+	Short: "Revoke a token by jti or index",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		setTokenStatus(cmd, func(s *status.Store, idx int) error { return s.Set(idx, status.Invalid) })
+	},
+}
+
+var statusSuspendCmd = &cobra.Command{
+	Use:   "suspend",
+	Short: "Suspend a token by jti or index",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		setTokenStatus(cmd, func(s *status.Store, idx int) error { return s.Set(idx, status.Suspended) })
+	},
+}
+
+var statusReinstateCmd = &cobra.Command{
+	Use:   "reinstate",
+	Short: "Make a suspended token valid again by jti or index",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		setTokenStatus(cmd, (*status.Store).Reinstate)
+	},
+}
+
+// setTokenStatus は --jti または --index で指定したトークンのステータスを変更する
+func setTokenStatus(cmd *cobra.Command, set func(s *status.Store, idx int) error) {
+	path, _ := cmd.Flags().GetString("list")
+	jti, _ := cmd.Flags().GetString("jti")
+	idx, _ := cmd.Flags().GetInt("index")
+	if (jti == "") == (idx < 0) {
+		fmt.Fprintln(cmd.ErrOrStderr(), "Please specify either --jti or --index.")
+		os.Exit(1)
+	}
+
+	// 読み込みから保存までロックし、同時に実行した issue / status コマンドの更新を失わないようにする
+	unlock, err := status.Lock(path)
+	if err != nil {
+		slog.Error("failed to lock status list", "error", err)
+		os.Exit(1)
+	}
+	defer unlock()
+
+	store, err := status.LoadStore(fileoperator.NewFileOperator(), path)
+	if err != nil {
+		slog.Error("failed to load status list", "error", err)
+		os.Exit(1)
+	}
+
+	if jti != "" {
+		if idx, err = store.Index(jti); err != nil {
+			slog.Error("failed to find token", "error", err)
+			os.Exit(1)
+		}
+	}
+	if err := set(store, idx); err != nil {
+		slog.Error("failed to set status", "error", err)
+		os.Exit(1)
+	}
+	if err := store.Save(); err != nil {
+		slog.Error("failed to save status list", "error", err)
+		os.Exit(1)
+	}
+
+	slog.Info("changed token status", "index", idx, "jti", jti, "status", store.Statuses[idx])
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+
+	for _, c := range []*cobra.Command{statusRevokeCmd, statusSuspendCmd, statusReinstateCmd} {
+		c.Flags().String("list", "files/status/statuslist.json", "status list file")
+		c.Flags().String("jti", "", "jti of the token")
+		c.Flags().Int("index", -1, "index of the token in the status list")
+		statusCmd.AddCommand(c)
+	}
+}
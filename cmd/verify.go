@@ -1,10 +1,14 @@
 package cmd
 
 import (
+	"crypto/x509"
 	"fmt"
 	"log/slog"
 	"os"
 
+	"github.com/jwks_demo/internal/fileoperator"
+	"github.com/jwks_demo/internal/jwe"
+	"github.com/jwks_demo/internal/mtls"
 	"github.com/jwks_demo/internal/verify"
 	"github.com/spf13/cobra"
 )
@@ -29,7 +33,41 @@ to quickly create a Cobra application.`,
 		jwtString := args[0]
 
 		v := verify.NewVerfier()
-		ok, err := v.Verify(jwtString)
+		v.CheckStatus, _ = cmd.Flags().GetBool("check-status")
+		if keyPath, _ := cmd.Flags().GetString("decrypt-key"); keyPath != "" {
+			b, err := fileoperator.NewFileOperator().LoadTxtFile(keyPath)
+			if err != nil {
+				slog.Error("failed to load decryption key", "error", err)
+				os.Exit(1)
+			}
+			if v.DecryptionKey, err = jwe.ParsePrivateKeyPEM(b, passphraseSource(cmd)); err != nil {
+				slog.Error("failed to parse decryption key", "error", err)
+				os.Exit(1)
+			}
+		}
+		// 鍵や証明書に結び付けられたトークンは提示された proof と証明書で検証する
+		// 両方に結び付けられたトークンは --dpop-proof と --client-cert の両方が必要
+		var p verify.Presentation
+		if certPath, _ := cmd.Flags().GetString("client-cert"); certPath != "" {
+			cert, err := loadCertificate(certPath)
+			if err != nil {
+				slog.Error("failed to load client certificate", "error", err)
+				os.Exit(1)
+			}
+			p.ClientCert = cert
+		}
+		if proof, _ := cmd.Flags().GetString("dpop-proof"); proof != "" {
+			p.DPoPProof = proof
+			p.DPoPMethod, _ = cmd.Flags().GetString("dpop-htm")
+			p.DPoPURI, _ = cmd.Flags().GetString("dpop-htu")
+		}
+		var ok bool
+		var err error
+		if p.ClientCert != nil || p.DPoPProof != "" {
+			ok, err = v.VerifyBound(jwtString, p)
+		} else {
+			ok, err = v.Verify(jwtString)
+		}
 		if err != nil {
 			fmt.Println("Verification failed:", err)
 			slog.Error("Failed to verify JWT", "error", err)
@@ -43,9 +81,25 @@ to quickly create a Cobra application.`,
 	},
 }
 
+// loadCertificate は PEM 形式の証明書ファイルを読み込む
+func loadCertificate(path string) (*x509.Certificate, error) {
+	b, err := fileoperator.NewFileOperator().LoadTxtFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return mtls.ParseCertificatePEM(b)
+}
+
 func init() {
 	rootCmd.AddCommand(verifyCmd)
 
+	verifyCmd.Flags().String("decrypt-key", "", "private key (X25519 or RSA PEM) used to decrypt JWE encrypted tokens")
+	verifyCmd.Flags().Bool("check-status", false, "reject tokens revoked or suspended in the status list referenced by the status claim")
+	verifyCmd.Flags().String("dpop-proof", "", "DPoP proof JWT presented with a DPoP-bound token (RFC 9449)")
+	verifyCmd.Flags().String("dpop-htm", "GET", "HTTP method of the request the DPoP proof was presented with")
+	verifyCmd.Flags().String("dpop-htu", "", "uri of the request the DPoP proof was presented with")
+	verifyCmd.Flags().String("client-cert", "", "client certificate (PEM) presented over mutual TLS with a certificate-bound token (RFC 8705)")
+
 	// Here you will define your flags and configuration settings.
 
 	// Cobra supports Persistent Flags which will work for this command
@@ -0,0 +1,239 @@
+package agent
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/jwks_demo/internal/issue"
+	"github.com/jwks_demo/internal/passphrase"
+)
+
+// SocketEnv はエージェントのソケットのパスを渡す環境変数 (ssh-agent の SSH_AUTH_SOCK に相当)
+const SocketEnv = "JWKS_DEMO_AGENT_SOCK"
+
+// エージェントへのリクエストの種類
+const (
+	opList   = "list"   // 保持している鍵の名前の一覧
+	opPublic = "public" // 鍵の公開鍵と署名アルゴリズム
+	opSign   = "sign"   // ダイジェストへの署名
+)
+
+// request はクライアントからエージェントへのリクエスト (1 行に 1 つの JSON)
+type request struct {
+	Op         string `json:"op"`
+	Key        string `json:"key,omitempty"`
+	Digest     []byte `json:"digest,omitempty"`
+	Hash       string `json:"hash,omitempty"`        // ダイジェストのハッシュ関数 (Ed25519 の場合は空)
+	SaltLength *int   `json:"salt_length,omitempty"` // RSA-PSS のソルト長 (PKCS#1 v1.5 の場合は nil)
+}
+
+// response はエージェントからクライアントへのレスポンス
+type response struct {
+	Error     string   `json:"error,omitempty"`
+	Keys      []string `json:"keys,omitempty"`
+	PublicKey []byte   `json:"public_key,omitempty"` // PKIX (DER) 形式の公開鍵
+	Alg       string   `json:"alg,omitempty"`
+	Signature []byte   `json:"signature,omitempty"`
+}
+
+// hashByName は署名リクエストで使えるハッシュ関数
+var hashByName = map[string]crypto.Hash{
+	crypto.SHA256.String(): crypto.SHA256,
+	crypto.SHA384.String(): crypto.SHA384,
+	crypto.SHA512.String(): crypto.SHA512,
+}
+
+type FileOperator interface {
+	LoadTxtFile(filePath string) ([]byte, error)
+	GetFileNames(dirPath string) ([]string, error)
+}
+
+// Agent は秘密鍵をメモリに保持し、Unix ドメインソケット経由で署名する (ssh-agent と同様)
+// クライアントには公開鍵と署名だけを返し、秘密鍵は渡さない
+type Agent struct {
+	mu   sync.RWMutex
+	keys map[string]agentKey // 鍵の名前 (秘密鍵のファイル名) -> 鍵
+}
+
+type agentKey struct {
+	signer crypto.Signer
+	alg    string
+}
+
+func NewAgent() *Agent {
+	return &Agent{keys: map[string]agentKey{}}
+}
+
+// AddKey は name の鍵として signer を登録する
+// alg は鍵に設定された署名アルゴリズム (無い場合は空)
+func (a *Agent) AddKey(name string, signer crypto.Signer, alg string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.keys[name] = agentKey{signer: signer, alg: alg}
+}
+
+// LoadDir は dir の秘密鍵をすべて読み込み、ファイル名を鍵の名前として登録する
+// 暗号化された秘密鍵は pass から取得したパスフレーズで復号する
+func (a *Agent) LoadDir(f FileOperator, dir string, pass passphrase.Source) error {
+	names, err := f.GetFileNames(dir)
+	if err != nil {
+		slog.Error("failed to get private key file names", "dir", dir, "error", err)
+		return err
+	}
+	backend := &issue.PEMBackend{FileOperator: f, Passphrase: pass}
+	for _, name := range names {
+		signer, alg, err := backend.Signer(filepath.Join(dir, name))
+		if err != nil {
+			return fmt.Errorf("failed to load private key %s: %w", name, err)
+		}
+		a.AddKey(name, signer, alg)
+		slog.Info("loaded private key", "key", name)
+	}
+	return nil
+}
+
+// Listen は socketPath に所有者のみが接続できる Unix ドメインソケットを作成する
+// 既に別のエージェントが使っているソケット、ソケット以外のファイル、他のユーザーが所有するソケットの場合はエラーを返し、
+// 残っている自分の古いソケットは削除する
+func Listen(socketPath string) (net.Listener, error) {
+	if conn, err := net.Dial("unix", socketPath); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("another agent is already listening on %s", socketPath)
+	}
+	if info, err := os.Lstat(socketPath); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s already exists and is not a socket", socketPath)
+		}
+		if !ownedByCurrentUser(info) {
+			return nil, fmt.Errorf("%s already exists and is owned by another user", socketPath)
+		}
+		if err := os.Remove(socketPath); err != nil {
+			return nil, err
+		}
+	}
+
+	l, err := listenUnix(socketPath)
+	if err != nil {
+		return nil, err
+	}
+	// ソケットに接続できるのは所有者のみとする
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// ListenTemp は新しく作成した所有者のみがアクセスできる (0700) 一時ディレクトリにソケットを作成する (ssh-agent と同様)
+// ソケットのパスを返す。ソケットを閉じた後にディレクトリを削除するのは呼び出し元の責任
+func ListenTemp() (net.Listener, string, error) {
+	dir, err := os.MkdirTemp("", "jwks_demo-agent-")
+	if err != nil {
+		return nil, "", err
+	}
+	if err := os.Chmod(dir, 0700); err != nil {
+		os.Remove(dir)
+		return nil, "", err
+	}
+	socketPath := filepath.Join(dir, "agent.sock")
+	l, err := Listen(socketPath)
+	if err != nil {
+		os.Remove(dir)
+		return nil, "", err
+	}
+	return l, socketPath, nil
+}
+
+// Serve は l で接続を受け付け、リクエストを処理する
+// l が閉じられるまで戻らない
+func (a *Agent) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go a.handleConn(conn)
+	}
+}
+
+func (a *Agent) handleConn(conn net.Conn) {
+	defer conn.Close()
+	dec := json.NewDecoder(conn)
+	enc := json.NewEncoder(conn)
+	for {
+		var req request
+		if err := dec.Decode(&req); err != nil {
+			return
+		}
+		res, err := a.handle(&req)
+		if err != nil {
+			slog.Warn("agent request failed", "op", req.Op, "key", req.Key, "error", err)
+			res = &response{Error: err.Error()}
+		}
+		if err := enc.Encode(res); err != nil {
+			return
+		}
+	}
+}
+
+func (a *Agent) handle(req *request) (*response, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if req.Op == opList {
+		keys := make([]string, 0, len(a.keys))
+		for name := range a.keys {
+			keys = append(keys, name)
+		}
+		sort.Strings(keys)
+		return &response{Keys: keys}, nil
+	}
+
+	key, ok := a.keys[req.Key]
+	if !ok {
+		return nil, fmt.Errorf("unknown key: %q", req.Key)
+	}
+
+	switch req.Op {
+	case opPublic:
+		der, err := x509.MarshalPKIXPublicKey(key.signer.Public())
+		if err != nil {
+			return nil, err
+		}
+		return &response{PublicKey: der, Alg: key.alg}, nil
+
+	case opSign:
+		var opts crypto.SignerOpts = crypto.Hash(0)
+		if req.Hash != "" {
+			h, ok := hashByName[req.Hash]
+			if !ok {
+				return nil, fmt.Errorf("unsupported hash: %q", req.Hash)
+			}
+			opts = h
+			if req.SaltLength != nil {
+				opts = &rsa.PSSOptions{SaltLength: *req.SaltLength, Hash: h}
+			}
+		}
+		sig, err := key.signer.Sign(rand.Reader, req.Digest, opts)
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("signed with agent key", "key", req.Key)
+		return &response{Signature: sig}, nil
+	}
+	return nil, fmt.Errorf("unsupported operation: %q", req.Op)
+}
@@ -0,0 +1,109 @@
+package agent
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"time"
+)
+
+const defaultTimeout = 10 * time.Second
+
+// Client はエージェントに署名を依頼する issue.KeyBackend
+// 鍵はファイルパスのファイル名でエージェントが保持する鍵を参照するため、秘密鍵のファイルは読まない
+type Client struct {
+	SocketPath string
+	Timeout    time.Duration // 1 リクエストあたりのタイムアウト
+}
+
+func NewClient(socketPath string) *Client {
+	return &Client{
+		SocketPath: socketPath,
+		Timeout:    defaultTimeout,
+	}
+}
+
+// Signer は keyRef のファイル名の鍵で署名する crypto.Signer と、鍵に設定された署名アルゴリズムを返す
+func (c *Client) Signer(keyRef string) (crypto.Signer, string, error) {
+	name := filepath.Base(keyRef)
+	res, err := c.call(&request{Op: opPublic, Key: name})
+	if err != nil {
+		return nil, "", err
+	}
+	pub, err := x509.ParsePKIXPublicKey(res.PublicKey)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to parse public key from agent: %w", err)
+	}
+	return &remoteSigner{client: c, name: name, pub: pub}, res.Alg, nil
+}
+
+// List はエージェントが保持している鍵の名前の一覧を返す
+func (c *Client) List() ([]string, error) {
+	res, err := c.call(&request{Op: opList})
+	if err != nil {
+		return nil, err
+	}
+	return res.Keys, nil
+}
+
+// call はエージェントに接続してリクエストを 1 つ送り、レスポンスを返す
+func (c *Client) call(req *request) (*response, error) {
+	conn, err := net.DialTimeout("unix", c.SocketPath, c.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to agent: %w", err)
+	}
+	defer conn.Close()
+	if c.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(c.Timeout))
+	}
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, fmt.Errorf("failed to send request to agent: %w", err)
+	}
+	var res response
+	if err := json.NewDecoder(conn).Decode(&res); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("failed to read response from agent: %w", err)
+	}
+	if res.Error != "" {
+		return nil, fmt.Errorf("agent: %s", res.Error)
+	}
+	return &res, nil
+}
+
+// remoteSigner はエージェントの鍵で署名する crypto.Signer
+type remoteSigner struct {
+	client *Client
+	name   string
+	pub    crypto.PublicKey
+}
+
+func (s *remoteSigner) Public() crypto.PublicKey {
+	return s.pub
+}
+
+// Sign はダイジェスト (Ed25519 の場合はメッセージ) への署名をエージェントに依頼する
+// 乱数はエージェント側で生成するため rand は使わない
+func (s *remoteSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	req := &request{Op: opSign, Key: s.name, Digest: digest}
+	if h := opts.HashFunc(); h != 0 {
+		req.Hash = h.String()
+	}
+	if pss, ok := opts.(*rsa.PSSOptions); ok {
+		saltLength := pss.SaltLength
+		req.SaltLength = &saltLength
+	}
+	res, err := s.client.call(req)
+	if err != nil {
+		return nil, err
+	}
+	return res.Signature, nil
+}
@@ -0,0 +1,33 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// MockFileOperator は FileOperator インターフェースのモック実装です。
+type MockFileOperator struct {
+	Files map[string][]byte // filePath -> 内容
+}
+
+// LoadTxtFile は Files に登録された内容を返します。
+func (m *MockFileOperator) LoadTxtFile(filePath string) ([]byte, error) {
+	b, ok := m.Files[filePath]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return b, nil
+}
+
+// GetFileNames は Files に登録されたファイルのうち dirPath 直下のファイル名を返します。
+func (m *MockFileOperator) GetFileNames(dirPath string) ([]string, error) {
+	var names []string
+	for p := range m.Files {
+		if filepath.Dir(p) == filepath.Clean(dirPath) {
+			names = append(names, filepath.Base(p))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
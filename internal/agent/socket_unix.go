@@ -0,0 +1,23 @@
+//go:build unix
+
+package agent
+
+import (
+	"net"
+	"os"
+	"syscall"
+)
+
+// listenUnix は所有者以外が接続できない権限 (0600) で Unix ドメインソケットを作成する
+// 作成してから権限を変更するまでの間に他のユーザーが接続できないよう、umask を設定して作成する
+func listenUnix(socketPath string) (net.Listener, error) {
+	old := syscall.Umask(0177)
+	defer syscall.Umask(old)
+	return net.Listen("unix", socketPath)
+}
+
+// ownedByCurrentUser は info のファイルの所有者が現在のユーザーかどうかを返す
+func ownedByCurrentUser(info os.FileInfo) bool {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	return ok && int(st.Uid) == os.Getuid()
+}
@@ -0,0 +1,107 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ClientAssertionTypeJWTBearer は private_key_jwt で使う client_assertion_type (RFC 7523 Section 2.2)
+const ClientAssertionTypeJWTBearer = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// maxAssertionLifetime は client_assertion の exp として受け付ける現在時刻からの最大の期間
+// 使用済みの jti は exp まで保持するため、exp が遠い assertion で保持する jti が増え続けないようにする
+const maxAssertionLifetime = 5 * time.Minute
+
+// AuthenticateAssertion は client_assertion の JWT でクライアントを認証する (RFC 7523 Section 3)
+// clientID が空でない場合は assertion の iss/sub と一致する必要がある
+// audiences は assertion の aud として受け付ける値 (トークンエンドポイントの URL など)
+func (r *Registry) AuthenticateAssertion(assertion, clientID string, audiences []string) (*Client, error) {
+	// 署名を検証する鍵を決めるために、まず検証せずに iss を取り出す
+	unverified := &jwt.RegisteredClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(assertion, unverified); err != nil {
+		return nil, fmt.Errorf("%w: malformed client_assertion: %v", ErrInvalidClient, err)
+	}
+	if clientID == "" {
+		clientID = unverified.Issuer
+	}
+
+	c, ok := r.Get(clientID)
+	if !ok || len(c.publicKeys) == 0 || !c.AllowsAuthMethod(AuthMethodPrivateKeyJWT) {
+		return nil, fmt.Errorf("%w: client %q does not support private_key_jwt", ErrInvalidClient, clientID)
+	}
+
+	claims := &jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(assertion, claims, c.assertionKey,
+		jwt.WithValidMethods([]string{jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuer(clientID),
+		jwt.WithSubject(clientID),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidClient, err)
+	}
+
+	if claims.ExpiresAt.After(time.Now().Add(maxAssertionLifetime)) {
+		return nil, fmt.Errorf("%w: client_assertion exp is more than %s in the future", ErrInvalidClient, maxAssertionLifetime)
+	}
+
+	if !slices.ContainsFunc(claims.Audience, func(aud string) bool { return slices.Contains(audiences, aud) }) {
+		return nil, fmt.Errorf("%w: client_assertion aud %v does not match %v", ErrInvalidClient, claims.Audience, audiences)
+	}
+
+	if claims.ID == "" {
+		return nil, fmt.Errorf("%w: client_assertion jti is required", ErrInvalidClient)
+	}
+	if err := r.useJTI(clientID+":"+claims.ID, claims.ExpiresAt.Time); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// assertionKey は client_assertion の kid に対応するクライアントの公開鍵を返す
+func (c *Client) assertionKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		// kid が無い場合は鍵が 1 つだけのときに限りその鍵を使う
+		if len(c.publicKeys) == 1 {
+			for _, key := range c.publicKeys {
+				return key, nil
+			}
+		}
+		return nil, errors.New("kid header missing or not a string")
+	}
+
+	key, ok := c.publicKeys[kid]
+	if !ok {
+		return nil, fmt.Errorf("verification key not found for kid: %s", kid)
+	}
+	return key, nil
+}
+
+// useJTI は jti を使用済みとして記録する。有効期限内に同じ jti が使われた場合はエラーを返す
+func (r *Registry) useJTI(jti string, exp time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if r.usedJTIs == nil {
+		r.usedJTIs = make(map[string]time.Time)
+	}
+	// 有効期限切れの jti は再利用されても exp の検証で弾かれるので削除する
+	for k, e := range r.usedJTIs {
+		if now.After(e) {
+			delete(r.usedJTIs, k)
+		}
+	}
+
+	if _, ok := r.usedJTIs[jti]; ok {
+		return fmt.Errorf("%w: client_assertion jti has already been used", ErrInvalidClient)
+	}
+	r.usedJTIs[jti] = exp
+	return nil
+}
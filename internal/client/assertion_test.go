@@ -0,0 +1,193 @@
+package client
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jwks_demo/internal/model"
+)
+
+func newTestAssertionRegistry(t *testing.T) (*Registry, ed25519.PrivateKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Client{
+		ClientID: "client-1",
+		JWKS: &model.Response{Keys: []model.Key{
+			{Kty: "OKP", Crv: "Ed25519", Kid: "client-key", Use: "sig", Alg: "EdDSA", X: base64.RawURLEncoding.EncodeToString(pub)},
+		}},
+	}
+	if err := c.loadPublicKeys(&MockFileOperator{}); err != nil {
+		t.Fatal(err)
+	}
+	// 公開鍵があってもシークレットで認証すると登録したクライアント
+	basic := *c
+	basic.ClientID = "basic-client"
+	basic.TokenEndpointAuthMethod = AuthMethodClientSecretBasic
+	basic.ClientSecretHash = testSecretHash
+	return &Registry{Clients: map[string]*Client{
+		"client-1":      c,
+		"secret-client": {ClientID: "secret-client", ClientSecretHash: testSecretHash},
+		"basic-client":  &basic,
+	}}, priv
+}
+
+func signAssertion(t *testing.T, key ed25519.PrivateKey, kid string, claims jwt.RegisteredClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestRegistry_AuthenticateAssertion(t *testing.T) {
+	r, key := newTestAssertionRegistry(t)
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	audiences := []string{"http://localhost:8080/token"}
+
+	validClaims := func(jti string) jwt.RegisteredClaims {
+		return jwt.RegisteredClaims{
+			Issuer:    "client-1",
+			Subject:   "client-1",
+			Audience:  jwt.ClaimStrings{"http://localhost:8080/token"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			ID:        jti,
+		}
+	}
+	replayed := signAssertion(t, key, "client-key", validClaims("jti-replayed"))
+	if _, err := r.AuthenticateAssertion(replayed, "", audiences); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		assertion string
+		clientID  string
+		wantErr   bool
+	}{
+		{
+			name:      "normal",
+			assertion: signAssertion(t, key, "client-key", validClaims("jti-1")),
+		},
+		{
+			name:      "normal without kid and with client_id",
+			assertion: signAssertion(t, key, "", validClaims("jti-2")),
+			clientID:  "client-1",
+		},
+		{
+			name:      "error replayed jti",
+			assertion: replayed,
+			wantErr:   true,
+		},
+		{
+			name:      "error client_id mismatch",
+			assertion: signAssertion(t, key, "client-key", validClaims("jti-3")),
+			clientID:  "secret-client",
+			wantErr:   true,
+		},
+		{
+			name:      "error signed by other key",
+			assertion: signAssertion(t, otherKey, "client-key", validClaims("jti-4")),
+			wantErr:   true,
+		},
+		{
+			name: "error wrong aud",
+			assertion: signAssertion(t, key, "client-key", func() jwt.RegisteredClaims {
+				c := validClaims("jti-5")
+				c.Audience = jwt.ClaimStrings{"http://example.com/token"}
+				return c
+			}()),
+			wantErr: true,
+		},
+		{
+			name: "error expired",
+			assertion: signAssertion(t, key, "client-key", func() jwt.RegisteredClaims {
+				c := validClaims("jti-6")
+				c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+				return c
+			}()),
+			wantErr: true,
+		},
+		{
+			name: "error exp too far in the future",
+			assertion: signAssertion(t, key, "client-key", func() jwt.RegisteredClaims {
+				c := validClaims("jti-far")
+				c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(365 * 24 * time.Hour))
+				return c
+			}()),
+			wantErr: true,
+		},
+		{
+			name: "error missing exp",
+			assertion: signAssertion(t, key, "client-key", func() jwt.RegisteredClaims {
+				c := validClaims("jti-7")
+				c.ExpiresAt = nil
+				return c
+			}()),
+			wantErr: true,
+		},
+		{
+			name:      "error missing jti",
+			assertion: signAssertion(t, key, "client-key", validClaims("")),
+			wantErr:   true,
+		},
+		{
+			name: "error sub differs from iss",
+			assertion: signAssertion(t, key, "client-key", func() jwt.RegisteredClaims {
+				c := validClaims("jti-8")
+				c.Subject = "someone"
+				return c
+			}()),
+			wantErr: true,
+		},
+		{
+			name:      "error unknown kid",
+			assertion: signAssertion(t, key, "unknown-key", validClaims("jti-9")),
+			wantErr:   true,
+		},
+		{
+			name: "error client registered with other auth method",
+			assertion: signAssertion(t, key, "client-key", func() jwt.RegisteredClaims {
+				c := validClaims("jti-10")
+				c.Issuer, c.Subject = "basic-client", "basic-client"
+				return c
+			}()),
+			wantErr: true,
+		},
+		{
+			name:      "error malformed assertion",
+			assertion: "invalid",
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.AuthenticateAssertion(tt.assertion, tt.clientID, audiences)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Registry.AuthenticateAssertion() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidClient) {
+					t.Errorf("Registry.AuthenticateAssertion() error = %v, want ErrInvalidClient", err)
+				}
+				return
+			}
+			if got.ClientID != "client-1" {
+				t.Errorf("Registry.AuthenticateAssertion() = %v, want client-1", got.ClientID)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package client
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jwks_demo/internal/model"
+	"github.com/jwks_demo/internal/verify"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInvalidClient はクライアント認証に失敗したことを表す
+var ErrInvalidClient = errors.New("invalid client")
+
+// トークンエンドポイントでのクライアント認証方式 (RFC 7591 token_endpoint_auth_method)
+const (
+	AuthMethodClientSecretBasic = "client_secret_basic"
+	AuthMethodClientSecretPost  = "client_secret_post"
+	AuthMethodPrivateKeyJWT     = "private_key_jwt"
+)
+
+// Client はクライアントレジストリに登録されたクライアント
+// TokenEndpointAuthMethod で指定した方式でのみ認証できる
+// 指定されていない場合、ClientSecretHash が設定されたクライアントはシークレット (Basic 認証またはフォーム) で、
+// JWKS または JWKSFile が設定されたクライアントは private_key_jwt で認証できる
+type Client struct {
+	ClientID                string `json:"client_id"`
+	TokenEndpointAuthMethod string `json:"token_endpoint_auth_method,omitempty"` // クライアント認証方式
+
+	ClientSecretHash  string          `json:"client_secret_hash,omitempty"` // bcrypt でハッシュ化したシークレット
+	JWKS              *model.Response `json:"jwks,omitempty"`               // client_assertion の検証に使う公開鍵
+	JWKSFile          string          `json:"jwks_file,omitempty"`          // JWKS を記載したローカルファイル
+	Scopes            []string        `json:"scopes"`                       // 要求を許可するスコープ
+	Audiences         []string        `json:"audiences"`                    // 要求を許可するオーディエンス
+	ExchangeAudiences []string        `json:"exchange_audiences,omitempty"` // トークン交換 (RFC 8693) で要求を許可するオーディエンス
+
+	publicKeys map[string]ed25519.PublicKey // kid -> PublicKey
+}
+
+// Registry はクライアントレジストリ
+type Registry struct {
+	Clients map[string]*Client // client_id -> Client
+
+	mu       sync.Mutex
+	usedJTIs map[string]time.Time // 使用済みの client_assertion の jti -> exp
+}
+
+// registryFile はクライアントレジストリファイルの形式
+type registryFile struct {
+	Clients []*Client `json:"clients"`
+}
+
+type FileOperator interface {
+	LoadTxtFile(filePath string) ([]byte, error)
+}
+
+// LoadRegistry は JSON 形式のクライアントレジストリファイルを読み込む
+func LoadRegistry(f FileOperator, path string) (*Registry, error) {
+	b, err := f.LoadTxtFile(path)
+	if err != nil {
+		slog.Error("failed to load client registry file", "path", path, "error", err)
+		return nil, err
+	}
+
+	var rf registryFile
+	if err := json.Unmarshal(b, &rf); err != nil {
+		return nil, fmt.Errorf("failed to parse client registry file: %w", err)
+	}
+
+	r := &Registry{Clients: make(map[string]*Client)}
+	for _, c := range rf.Clients {
+		if c.ClientID == "" {
+			return nil, fmt.Errorf("client_id is required in client registry")
+		}
+		if _, ok := r.Clients[c.ClientID]; ok {
+			return nil, fmt.Errorf("duplicate client_id in client registry: %s", c.ClientID)
+		}
+		if err := c.loadPublicKeys(f); err != nil {
+			return nil, err
+		}
+		if err := c.validateAuthMethod(); err != nil {
+			return nil, err
+		}
+		r.Clients[c.ClientID] = c
+	}
+
+	slog.Info("loaded client registry", "path", path, "clients", len(r.Clients))
+	return r, nil
+}
+
+// loadPublicKeys は JWKS または JWKSFile から client_assertion の検証に使う公開鍵を読み込む
+func (c *Client) loadPublicKeys(f FileOperator) error {
+	if c.JWKS != nil && c.JWKSFile != "" {
+		return fmt.Errorf("both jwks and jwks_file are set for client: %s", c.ClientID)
+	}
+
+	jwks := c.JWKS
+	if c.JWKSFile != "" {
+		b, err := f.LoadTxtFile(c.JWKSFile)
+		if err != nil {
+			slog.Error("failed to load client jwks file", "client_id", c.ClientID, "path", c.JWKSFile, "error", err)
+			return err
+		}
+		jwks = &model.Response{}
+		if err := json.Unmarshal(b, jwks); err != nil {
+			return fmt.Errorf("failed to parse jwks file of client %s: %w", c.ClientID, err)
+		}
+	}
+	if jwks == nil {
+		return nil
+	}
+
+	c.publicKeys = verify.ParseEd25519Keys(jwks.Keys)
+	if len(c.publicKeys) == 0 {
+		return fmt.Errorf("no usable Ed25519 key in jwks of client: %s", c.ClientID)
+	}
+	return nil
+}
+
+// validateAuthMethod は認証方式とその認証に使う情報 (シークレット、公開鍵) が揃っているかを検証する
+func (c *Client) validateAuthMethod() error {
+	switch c.TokenEndpointAuthMethod {
+	case "":
+		// どちらの方式でも認証できるクライアントは、意図しない方式を許さないよう方式の指定を必須にする
+		if c.ClientSecretHash != "" && len(c.publicKeys) > 0 {
+			return fmt.Errorf("client %s has both client_secret_hash and jwks; token_endpoint_auth_method is required", c.ClientID)
+		}
+	case AuthMethodClientSecretBasic, AuthMethodClientSecretPost:
+		if c.ClientSecretHash == "" {
+			return fmt.Errorf("client %s uses %s but has no client_secret_hash", c.ClientID, c.TokenEndpointAuthMethod)
+		}
+	case AuthMethodPrivateKeyJWT:
+		if len(c.publicKeys) == 0 {
+			return fmt.Errorf("client %s uses %s but has no jwks", c.ClientID, c.TokenEndpointAuthMethod)
+		}
+		if c.ClientSecretHash != "" {
+			return fmt.Errorf("client %s uses %s and must not have client_secret_hash", c.ClientID, c.TokenEndpointAuthMethod)
+		}
+	default:
+		return fmt.Errorf("unsupported token_endpoint_auth_method of client %s: %q (expected %q, %q or %q)",
+			c.ClientID, c.TokenEndpointAuthMethod, AuthMethodClientSecretBasic, AuthMethodClientSecretPost, AuthMethodPrivateKeyJWT)
+	}
+	return nil
+}
+
+// AllowsAuthMethod はクライアントが method で認証できるかどうかを返す
+func (c *Client) AllowsAuthMethod(method string) bool {
+	if c.TokenEndpointAuthMethod != "" {
+		return c.TokenEndpointAuthMethod == method
+	}
+	if method == AuthMethodPrivateKeyJWT {
+		return len(c.publicKeys) > 0
+	}
+	return c.ClientSecretHash != ""
+}
+
+// Get は client_id に対応するクライアントを返す
+func (r *Registry) Get(clientID string) (*Client, bool) {
+	c, ok := r.Clients[clientID]
+	return c, ok
+}
+
+// Authenticate は client_id と client_secret でクライアントを認証する
+// method はシークレットを送った方式 (client_secret_basic または client_secret_post)
+func (r *Registry) Authenticate(clientID, clientSecret, method string) (*Client, error) {
+	c, ok := r.Get(clientID)
+	if !ok || c.ClientSecretHash == "" || !c.AllowsAuthMethod(method) {
+		return nil, ErrInvalidClient
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(c.ClientSecretHash), []byte(clientSecret)); err != nil {
+		return nil, ErrInvalidClient
+	}
+	return c, nil
+}
+
+// AllowsScope はクライアントが scope を要求できるかどうかを返す
+func (c *Client) AllowsScope(scope string) bool {
+	return slices.Contains(c.Scopes, scope)
+}
+
+// AllowsAudience はクライアントが aud を要求できるかどうかを返す
+func (c *Client) AllowsAudience(aud string) bool {
+	return slices.Contains(c.Audiences, aud)
+}
+
+// AllowsExchangeAudience はクライアントがトークン交換で aud を要求できるかどうかを返す
+func (c *Client) AllowsExchangeAudience(aud string) bool {
+	return slices.Contains(c.ExchangeAudiences, aud)
+}
+
+// HashSecret はクライアントシークレットをレジストリに登録する形式でハッシュ化する
+func HashSecret(secret string) (string, error) {
+	b, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
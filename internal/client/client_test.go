@@ -0,0 +1,94 @@
+package client
+
+import (
+	"errors"
+	"testing"
+)
+
+// "secret" を bcrypt (cost 4) でハッシュ化した値
+const testSecretHash = "$2a$04$0Z2czos2lTZXL/x4swnQx.eFuruRATHSJbK3vYUZdypJAO9.qMday"
+
+func TestLoadRegistry(t *testing.T) {
+	files := map[string][]byte{
+		"clients.json":        []byte(`{"clients":[{"client_id":"client-1","client_secret_hash":"` + testSecretHash + `","scopes":["read"],"audiences":["api"]}]}`),
+		"duplicate.json":      []byte(`{"clients":[{"client_id":"client-1"},{"client_id":"client-1"}]}`),
+		"no_id.json":          []byte(`{"clients":[{"scopes":["read"]}]}`),
+		"invalid.json":        []byte(`{"clients":`),
+		"basic.json":          []byte(`{"clients":[{"client_id":"client-1","token_endpoint_auth_method":"client_secret_basic","client_secret_hash":"` + testSecretHash + `"}]}`),
+		"both.json":           []byte(`{"clients":[{"client_id":"client-1","client_secret_hash":"` + testSecretHash + `","jwks_file":"jwks.json"}]}`),
+		"pkjwt_secret.json":   []byte(`{"clients":[{"client_id":"client-1","token_endpoint_auth_method":"private_key_jwt","client_secret_hash":"` + testSecretHash + `","jwks_file":"jwks.json"}]}`),
+		"pkjwt_no_jwks.json":  []byte(`{"clients":[{"client_id":"client-1","token_endpoint_auth_method":"private_key_jwt"}]}`),
+		"secret_no_hash.json": []byte(`{"clients":[{"client_id":"client-1","token_endpoint_auth_method":"client_secret_post"}]}`),
+		"unknown_method.json": []byte(`{"clients":[{"client_id":"client-1","token_endpoint_auth_method":"tls_client_auth","client_secret_hash":"` + testSecretHash + `"}]}`),
+		"jwks.json":           []byte(`{"keys":[{"kty":"OKP","crv":"Ed25519","kid":"client-key","use":"sig","alg":"EdDSA","x":"wYDYgYnwhxMfR9hE7isN1rWHubXvEW1EJ_gYirMuxyY"}]}`),
+	}
+	tests := []struct {
+		name        string
+		path        string
+		wantClients int
+		wantErr     bool
+	}{
+		{name: "normal", path: "clients.json", wantClients: 1},
+		{name: "auth method", path: "basic.json", wantClients: 1},
+		{name: "error secret and jwks without auth method", path: "both.json", wantErr: true},
+		{name: "error private_key_jwt with secret", path: "pkjwt_secret.json", wantErr: true},
+		{name: "error private_key_jwt without jwks", path: "pkjwt_no_jwks.json", wantErr: true},
+		{name: "error client_secret_post without secret", path: "secret_no_hash.json", wantErr: true},
+		{name: "error unsupported auth method", path: "unknown_method.json", wantErr: true},
+		{name: "error duplicate client_id", path: "duplicate.json", wantErr: true},
+		{name: "error missing client_id", path: "no_id.json", wantErr: true},
+		{name: "error invalid json", path: "invalid.json", wantErr: true},
+		{name: "error file not found", path: "notfound.json", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadRegistry(&MockFileOperator{Files: files}, tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadRegistry() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && len(got.Clients) != tt.wantClients {
+				t.Errorf("LoadRegistry() clients = %d, want %d", len(got.Clients), tt.wantClients)
+			}
+		})
+	}
+}
+
+func TestRegistry_Authenticate(t *testing.T) {
+	r := &Registry{
+		Clients: map[string]*Client{
+			"client-1":     {ClientID: "client-1", ClientSecretHash: testSecretHash},
+			"basic-client": {ClientID: "basic-client", TokenEndpointAuthMethod: AuthMethodClientSecretBasic, ClientSecretHash: testSecretHash},
+			"pkjwt-client": {ClientID: "pkjwt-client", TokenEndpointAuthMethod: AuthMethodPrivateKeyJWT, ClientSecretHash: testSecretHash},
+			"no-secret":    {ClientID: "no-secret"},
+		},
+	}
+	tests := []struct {
+		name         string
+		clientID     string
+		clientSecret string
+		method       string
+		wantErr      error
+	}{
+		{name: "normal", clientID: "client-1", clientSecret: "secret", method: AuthMethodClientSecretBasic},
+		{name: "secret in form", clientID: "client-1", clientSecret: "secret", method: AuthMethodClientSecretPost},
+		{name: "registered auth method", clientID: "basic-client", clientSecret: "secret", method: AuthMethodClientSecretBasic},
+		{name: "error other auth method than registered", clientID: "basic-client", clientSecret: "secret", method: AuthMethodClientSecretPost, wantErr: ErrInvalidClient},
+		{name: "error secret for private_key_jwt client", clientID: "pkjwt-client", clientSecret: "secret", method: AuthMethodClientSecretBasic, wantErr: ErrInvalidClient},
+		{name: "error wrong secret", clientID: "client-1", clientSecret: "wrong", method: AuthMethodClientSecretBasic, wantErr: ErrInvalidClient},
+		{name: "error unknown client", clientID: "unknown", clientSecret: "secret", method: AuthMethodClientSecretBasic, wantErr: ErrInvalidClient},
+		{name: "error client without secret", clientID: "no-secret", clientSecret: "", method: AuthMethodClientSecretBasic, wantErr: ErrInvalidClient},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.Authenticate(tt.clientID, tt.clientSecret, tt.method)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Registry.Authenticate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr == nil && got.ClientID != tt.clientID {
+				t.Errorf("Registry.Authenticate() = %v, want %v", got.ClientID, tt.clientID)
+			}
+		})
+	}
+}
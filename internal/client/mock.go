@@ -0,0 +1,22 @@
+package client
+
+import "os"
+
+// MockFileOperator は FileOperator インターフェースのモック実装です。
+type MockFileOperator struct {
+	Files          map[string][]byte // filePath -> 内容
+	ErrLoadTxtFile error
+}
+
+// LoadTxtFile は Files に登録された内容を返します。
+// ErrLoadTxtFile が設定されていればそのエラーを返します。
+func (m *MockFileOperator) LoadTxtFile(filePath string) ([]byte, error) {
+	if m.ErrLoadTxtFile != nil {
+		return nil, m.ErrLoadTxtFile
+	}
+	b, ok := m.Files[filePath]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return b, nil
+}
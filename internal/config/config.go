@@ -0,0 +1,87 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFileName は --config が指定されない場合に $HOME から読む設定ファイル名
+const DefaultFileName = ".jwks_demo.yaml"
+
+type FileOperator interface {
+	LoadTxtFile(filePath string) ([]byte, error)
+}
+
+// Config は設定ファイルの内容
+type Config struct {
+	Profiles map[string]*Profile `yaml:"profiles"` // プロファイル名 -> Profile
+}
+
+// Profile は issue コマンドで --profile により選択する発行の設定
+// 空の項目は使われず、フラグで指定された値はプロファイルの値より優先される
+type Profile struct {
+	Key      string         `yaml:"key"`      // 署名に使う秘密鍵のパス
+	Kid      string         `yaml:"kid"`      // 署名鍵の kid (Key を使う場合のみ)
+	Issuer   string         `yaml:"iss"`      // iss
+	Subject  string         `yaml:"sub"`      // sub
+	Audience []string       `yaml:"aud"`      // 既定の aud
+	Lifetime time.Duration  `yaml:"lifetime"` // トークンの有効期限 ("15m" など)
+	Claims   map[string]any `yaml:"claims"`   // 追加のクレーム
+}
+
+// Load は YAML 形式の設定ファイルを読み込む
+// 未知の項目はタイプミスを見逃さないようエラーにする
+func Load(f FileOperator, path string) (*Config, error) {
+	b, err := f.LoadTxtFile(path)
+	if err != nil {
+		slog.Error("failed to load config file", "path", path, "error", err)
+		return nil, err
+	}
+
+	var c Config
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&c); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	for name, p := range c.Profiles {
+		if p == nil {
+			return nil, fmt.Errorf("profile %q is empty", name)
+		}
+		if p.Lifetime < 0 {
+			return nil, fmt.Errorf("profile %q: lifetime must not be negative: %s", name, p.Lifetime)
+		}
+		if p.Kid != "" && p.Key == "" {
+			return nil, fmt.Errorf("profile %q: kid requires key", name)
+		}
+	}
+	slog.Info("loaded config file", "path", path, "profiles", len(c.Profiles))
+	return &c, nil
+}
+
+// Profile は name のプロファイルを返す
+func (c *Config) Profile(name string) (*Profile, error) {
+	p, ok := c.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("profile %q is not defined (available: %v)", name, c.ProfileNames())
+	}
+	return p, nil
+}
+
+// ProfileNames は定義されたプロファイル名を昇順で返す
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testConfig = `
+profiles:
+  staging-api:
+    key: files/private/staging.pem
+    kid: staging-2025
+    iss: https://staging.example.com
+    aud: [staging-api]
+    lifetime: 15m
+    claims:
+      role: service
+      tenants: [a, b]
+  minimal:
+    lifetime: 2h
+`
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		noFile  bool
+		want    map[string]*Profile
+		wantErr bool
+	}{
+		{
+			name:    "profiles",
+			content: testConfig,
+			want: map[string]*Profile{
+				"staging-api": {
+					Key:      "files/private/staging.pem",
+					Kid:      "staging-2025",
+					Issuer:   "https://staging.example.com",
+					Audience: []string{"staging-api"},
+					Lifetime: 15 * time.Minute,
+					Claims:   map[string]any{"role": "service", "tenants": []any{"a", "b"}},
+				},
+				"minimal": {Lifetime: 2 * time.Hour},
+			},
+		},
+		{name: "empty file", content: "", want: nil},
+		{name: "error unknown field", content: "profiles:\n  a:\n    audience: [api]\n", wantErr: true},
+		{name: "error invalid lifetime", content: "profiles:\n  a:\n    lifetime: soon\n", wantErr: true},
+		{name: "error negative lifetime", content: "profiles:\n  a:\n    lifetime: -1h\n", wantErr: true},
+		{name: "error kid without key", content: "profiles:\n  a:\n    kid: key-001\n", wantErr: true},
+		{name: "error empty profile", content: "profiles:\n  a:\n", wantErr: true},
+		{name: "error not found", noFile: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &MockFileOperator{Files: map[string][]byte{}}
+			if !tt.noFile {
+				f.Files["config.yaml"] = []byte(tt.content)
+			}
+			got, err := Load(f, "config.yaml")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Load() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got.Profiles, tt.want) {
+				t.Errorf("Load() = %+v, want %+v", got.Profiles, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_Profile(t *testing.T) {
+	c, err := Load(&MockFileOperator{Files: map[string][]byte{"config.yaml": []byte(testConfig)}}, "config.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, err := c.Profile("staging-api"); err != nil || p.Kid != "staging-2025" {
+		t.Errorf("Config.Profile() = %+v, %v", p, err)
+	}
+	if _, err := c.Profile("production"); err == nil {
+		t.Error("Config.Profile() with undefined profile succeeded")
+	}
+}
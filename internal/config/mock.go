@@ -0,0 +1,17 @@
+package config
+
+import "os"
+
+// MockFileOperator は FileOperator インターフェースのモック実装です。
+type MockFileOperator struct {
+	Files map[string][]byte // filePath -> 内容
+}
+
+// LoadTxtFile は Files に登録された内容を返します。
+func (m *MockFileOperator) LoadTxtFile(filePath string) ([]byte, error) {
+	b, ok := m.Files[filePath]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return b, nil
+}
@@ -0,0 +1,147 @@
+package dpop
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jwks_demo/internal/jwk"
+	"github.com/jwks_demo/internal/model"
+)
+
+// ProofType は DPoP proof の typ ヘッダー (RFC 9449 Section 4.2)
+const ProofType = "dpop+jwt"
+
+// DefaultMaxAge は DPoP proof の iat と現在時刻の差として許容する既定の最大値
+const DefaultMaxAge = time.Minute
+
+// Proof は署名と iat を検証済みの DPoP proof (RFC 9449)
+type Proof struct {
+	Thumbprint string    // jwk ヘッダーの公開鍵の JWK Thumbprint (cnf.jkt と比較する)
+	HTM        string    // HTTP メソッド
+	HTU        string    // HTTP リクエストの URI
+	ATH        string    // アクセストークンのハッシュ (トークンの提示時のみ)
+	JTI        string    // proof の一意な識別子 (リプレイ検知に使う)
+	IssuedAt   time.Time // proof の作成時刻
+}
+
+// proofClaims は DPoP proof のクレーム
+type proofClaims struct {
+	jwt.RegisteredClaims
+	HTM string `json:"htm"`
+	HTU string `json:"htu"`
+	ATH string `json:"ath,omitempty"`
+}
+
+// ParseProof は DPoP proof の typ、jwk ヘッダーの公開鍵による署名、必須クレーム、iat を検証する
+// iat は now の前後 maxAge 以内である必要がある
+// jwk ヘッダーは Ed25519 (EdDSA) の公開鍵に対応する
+func ParseProof(proof string, now time.Time, maxAge time.Duration) (*Proof, error) {
+	var thumbprint string
+	claims := &proofClaims{}
+	_, err := jwt.ParseWithClaims(proof, claims, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != ProofType {
+			return nil, fmt.Errorf("unexpected DPoP proof typ: %q (expected %q)", typ, ProofType)
+		}
+		key, err := proofJWK(token.Header["jwk"])
+		if err != nil {
+			return nil, err
+		}
+		publicKey, err := jwk.ParseEd25519Key(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DPoP proof jwk: %w", err)
+		}
+		if thumbprint, err = jwk.Thumbprint(publicKey); err != nil {
+			return nil, err
+		}
+		return publicKey, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodEdDSA.Alg()}), jwt.WithTimeFunc(func() time.Time { return now }))
+	if err != nil {
+		return nil, fmt.Errorf("invalid DPoP proof: %w", err)
+	}
+
+	if claims.ID == "" || claims.HTM == "" || claims.HTU == "" || claims.IssuedAt == nil {
+		return nil, errors.New("DPoP proof must contain jti, htm, htu and iat")
+	}
+	if age := now.Sub(claims.IssuedAt.Time); age > maxAge || age < -maxAge {
+		return nil, fmt.Errorf("DPoP proof iat (%s) is outside the acceptable window of %s", claims.IssuedAt.Time, maxAge)
+	}
+
+	return &Proof{
+		Thumbprint: thumbprint,
+		HTM:        claims.HTM,
+		HTU:        claims.HTU,
+		ATH:        claims.ATH,
+		JTI:        claims.ID,
+		IssuedAt:   claims.IssuedAt.Time,
+	}, nil
+}
+
+// proofJWK は jwk ヘッダーを model.Key に変換する
+// 秘密鍵のメンバー (d) を含む場合は拒否する
+func proofJWK(header any) (model.Key, error) {
+	var key model.Key
+	m, ok := header.(map[string]any)
+	if !ok {
+		return key, errors.New("DPoP proof jwk header is missing or not an object")
+	}
+	if _, ok := m["d"]; ok {
+		return key, errors.New("DPoP proof jwk header must not contain a private key")
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return key, err
+	}
+	if err := json.Unmarshal(b, &key); err != nil {
+		return key, fmt.Errorf("invalid DPoP proof jwk header: %w", err)
+	}
+	return key, nil
+}
+
+// Check は proof がリクエスト (method, uri) と提示されたアクセストークンに対応することを確認する
+// accessToken が空の場合は ath を確認しない (トークンエンドポイントへの proof)
+func (p *Proof) Check(method, uri, accessToken string) error {
+	if p.HTM != method {
+		return fmt.Errorf("DPoP proof htm %q does not match the request method %q", p.HTM, method)
+	}
+	want, err := normalizeHTU(uri)
+	if err != nil {
+		return fmt.Errorf("invalid request uri: %w", err)
+	}
+	got, err := normalizeHTU(p.HTU)
+	if err != nil || got != want {
+		return fmt.Errorf("DPoP proof htu %q does not match the request uri %q", p.HTU, uri)
+	}
+	if accessToken != "" && p.ATH != AccessTokenHash(accessToken) {
+		return errors.New("DPoP proof ath does not match the access token")
+	}
+	return nil
+}
+
+// normalizeHTU はクエリとフラグメントを除き、スキームとホストを小文字にした URI を返す (RFC 9449 Section 4.3)
+func normalizeHTU(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("uri must be absolute: %q", uri)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String(), nil
+}
+
+// AccessTokenHash は DPoP proof の ath (アクセストークンの SHA-256 の base64url) を返す
+func AccessTokenHash(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,126 @@
+package dpop
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jwks_demo/internal/jwk"
+)
+
+// newProof は key で署名した DPoP proof を作成する
+// header と claims で指定した値は既定値を上書きし、nil の値はメンバーを削除する
+func newProof(t *testing.T, key ed25519.PrivateKey, header, claims map[string]any) string {
+	t.Helper()
+	c := jwt.MapClaims{"jti": "proof-1", "htm": "GET", "htu": "https://rs.example.com/resource", "iat": time.Unix(1700000000, 0).Unix()}
+	for k, v := range claims {
+		if v == nil {
+			delete(c, k)
+			continue
+		}
+		c[k] = v
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, c)
+	token.Header["typ"] = ProofType
+	token.Header["jwk"] = map[string]any{"kty": "OKP", "crv": "Ed25519", "x": base64.RawURLEncoding.EncodeToString(key.Public().(ed25519.PublicKey))}
+	for k, v := range header {
+		if v == nil {
+			delete(token.Header, k)
+			continue
+		}
+		token.Header[k] = v
+	}
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestParseProof(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	thumbprint, _ := jwk.Thumbprint(key.Public())
+	otherJWK := map[string]any{"kty": "OKP", "crv": "Ed25519", "x": base64.RawURLEncoding.EncodeToString(otherKey.Public().(ed25519.PublicKey))}
+
+	tests := []struct {
+		name    string
+		proof   string
+		want    *Proof
+		wantErr bool
+	}{
+		{
+			name:  "valid",
+			proof: newProof(t, key, nil, map[string]any{"ath": "hash"}),
+			want:  &Proof{Thumbprint: thumbprint, HTM: "GET", HTU: "https://rs.example.com/resource", ATH: "hash", JTI: "proof-1", IssuedAt: now},
+		},
+		{
+			name:  "iat within window",
+			proof: newProof(t, key, nil, map[string]any{"iat": now.Add(-30 * time.Second).Unix()}),
+			want:  &Proof{Thumbprint: thumbprint, HTM: "GET", HTU: "https://rs.example.com/resource", JTI: "proof-1", IssuedAt: now.Add(-30 * time.Second)},
+		},
+		{name: "error wrong typ", proof: newProof(t, key, map[string]any{"typ": "JWT"}, nil), wantErr: true},
+		{name: "error missing jwk", proof: newProof(t, key, map[string]any{"jwk": nil}, nil), wantErr: true},
+		{name: "error jwk contains private key", proof: newProof(t, key, map[string]any{"jwk": map[string]any{"kty": "OKP", "crv": "Ed25519", "x": "x", "d": "d"}}, nil), wantErr: true},
+		{name: "error signed by another key", proof: newProof(t, key, map[string]any{"jwk": otherJWK}, nil), wantErr: true},
+		{name: "error missing htu", proof: newProof(t, key, nil, map[string]any{"htu": nil}), wantErr: true},
+		{name: "error missing jti", proof: newProof(t, key, nil, map[string]any{"jti": nil}), wantErr: true},
+		{name: "error iat too old", proof: newProof(t, key, nil, map[string]any{"iat": now.Add(-2 * time.Minute).Unix()}), wantErr: true},
+		{name: "error iat in the future", proof: newProof(t, key, nil, map[string]any{"iat": now.Add(2 * time.Minute).Unix()}), wantErr: true},
+		{name: "error not a jwt", proof: "invalid", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseProof(tt.proof, now, time.Minute)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseProof() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if *got != *tt.want {
+				t.Errorf("ParseProof() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProof_Check(t *testing.T) {
+	p := &Proof{HTM: "GET", HTU: "https://RS.example.com/resource", ATH: AccessTokenHash("token")}
+
+	tests := []struct {
+		name        string
+		method      string
+		uri         string
+		accessToken string
+		wantErr     bool
+	}{
+		{name: "match", method: "GET", uri: "https://rs.example.com/resource", accessToken: "token"},
+		{name: "query and fragment are ignored", method: "GET", uri: "https://rs.example.com/resource?a=1#f", accessToken: "token"},
+		{name: "ath not checked without access token", method: "GET", uri: "https://rs.example.com/resource"},
+		{name: "error htm mismatch", method: "POST", uri: "https://rs.example.com/resource", accessToken: "token", wantErr: true},
+		{name: "error htu mismatch", method: "GET", uri: "https://rs.example.com/other", accessToken: "token", wantErr: true},
+		{name: "error ath mismatch", method: "GET", uri: "https://rs.example.com/resource", accessToken: "other", wantErr: true},
+		{name: "error relative uri", method: "GET", uri: "/resource", accessToken: "token", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := p.Check(tt.method, tt.uri, tt.accessToken); (err != nil) != tt.wantErr {
+				t.Errorf("Proof.Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAccessTokenHash(t *testing.T) {
+	// RFC 9449 Section 7.1 の例
+	token := "Kz~8mXK1EalYznwH-LC-1fBAo.4Ljp~zsPE_NeO.gxU"
+	if got, want := AccessTokenHash(token), "fUHyO2r2Z3DZ53EsNrWBb0xWXoaNy59IiKCAqksmQEo"; got != want {
+		t.Errorf("AccessTokenHash() = %v, want %v", got, want)
+	}
+}
@@ -3,6 +3,9 @@ package fileoperator
 import (
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
 type FileOperator struct {
@@ -26,6 +29,8 @@ func (f *FileOperator) LoadTxtFile(filePath string) ([]byte, error) {
 }
 
 // GetFileNames returns a list of file names in the specified directory.
+// Hidden files (names starting with ".") are skipped, so key loaders never pick up
+// temporary files left behind by an interrupted WriteTxtFile.
 func (f *FileOperator) GetFileNames(dirPath string) ([]string, error) {
 	files, err := os.ReadDir(dirPath)
 	if err != nil {
@@ -33,9 +38,46 @@ func (f *FileOperator) GetFileNames(dirPath string) ([]string, error) {
 	}
 	var fileNames []string
 	for _, file := range files {
-		if !file.IsDir() {
+		if !file.IsDir() && !strings.HasPrefix(file.Name(), ".") {
 			fileNames = append(fileNames, file.Name())
 		}
 	}
 	return fileNames, nil
 }
+
+// WriteTxtFile writes data to the specified file with the given permission.
+// The permission is also applied when the file already exists.
+// The data is written to a temporary file in the same directory whose permission is set
+// before writing, and then renamed into place, so it is never readable under the old mode.
+func (f *FileOperator) WriteTxtFile(filePath string, data []byte, perm os.FileMode) (err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), "."+filepath.Base(filePath)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if err = tmp.Chmod(perm); err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filePath)
+}
+
+// ModTime returns the modification time of the specified file.
+func (f *FileOperator) ModTime(filePath string) (time.Time, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
@@ -0,0 +1,91 @@
+package fileoperator
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFileOperator_WriteTxtFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing os.FileMode // 0 の場合はファイルが存在しない
+		perm     os.FileMode
+	}{
+		{name: "new file", perm: 0600},
+		{name: "overwrite file with wider permission", existing: 0644, perm: 0600},
+		{name: "overwrite file with narrower permission", existing: 0600, perm: 0644},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "key.pem")
+			if tt.existing != 0 {
+				if err := os.WriteFile(path, []byte("old"), tt.existing); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chmod(path, tt.existing); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			f := NewFileOperator()
+			if err := f.WriteTxtFile(path, []byte("new"), tt.perm); err != nil {
+				t.Fatalf("WriteTxtFile() error = %v", err)
+			}
+
+			b, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != "new" {
+				t.Errorf("WriteTxtFile() content = %q, want %q", b, "new")
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != tt.perm {
+				t.Errorf("WriteTxtFile() perm = %o, want %o", info.Mode().Perm(), tt.perm)
+			}
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 {
+				t.Errorf("WriteTxtFile() left temporary files: %v", entries)
+			}
+		})
+	}
+}
+
+func TestFileOperator_WriteTxtFile_error(t *testing.T) {
+	f := NewFileOperator()
+	path := filepath.Join(t.TempDir(), "notfound", "key.pem")
+	if err := f.WriteTxtFile(path, []byte("new"), 0600); err == nil {
+		t.Error("WriteTxtFile() error = nil, want error for missing directory")
+	}
+}
+
+func TestFileOperator_GetFileNames(t *testing.T) {
+	dir := t.TempDir()
+	// 中断した WriteTxtFile が残した一時ファイルは鍵ファイルとして扱わない
+	for _, name := range []string{"key-001.pem", "key-002.pem", ".key-003.pem.tmp-123456"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("key"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := NewFileOperator().GetFileNames(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"key-001.pem", "key-002.pem"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetFileNames() = %v, want %v", got, want)
+	}
+}
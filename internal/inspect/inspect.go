@@ -0,0 +1,529 @@
+package inspect
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jwks_demo/internal/convert"
+	"github.com/jwks_demo/internal/issue"
+	"github.com/jwks_demo/internal/jwk"
+	"github.com/jwks_demo/internal/lifecycle"
+	"github.com/jwks_demo/internal/passphrase"
+)
+
+const (
+	defaultPublicKeyDir  = "files/public"
+	defaultPrivateKeyDir = "files/private"
+
+	maxFetchSize = 1 << 20 // URL から読み込む内容の上限 (byte)
+)
+
+// 入力の種類
+const (
+	KindKey  = "key"  // PEM / JWK / OpenSSH の単一の鍵
+	KindJWKS = "jwks" // JWK Set
+	KindJWS  = "jws"  // 署名されたトークン (compact serialization)
+	KindJWE  = "jwe"  // 暗号化されたトークン (compact serialization)
+)
+
+// kid の出どころ
+const (
+	KidFromFileName = "file name"  // serve と同じ規則で鍵ファイルから決めた kid
+	KidFromJWK      = "jwk"        // JWK の kid メンバー
+	KidFromToken    = "token kid"  // トークンのヘッダーの kid
+	KidFromOverride = "kid map"    // kid の上書きファイル
+	KidThumbprint   = "thumbprint" // JWK Thumbprint
+)
+
+type FileOperator interface {
+	LoadTxtFile(filePath string) ([]byte, error)
+	GetFileNames(dirPath string) ([]string, error)
+}
+
+// HTTPClient は URL の内容の取得に使う HTTP クライアント
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Inspector は鍵ファイル、JWK、JWKS、トークンの鍵の情報を調べる
+type Inspector struct {
+	FileOperator FileOperator
+	HTTPClient   HTTPClient
+	Passphrase   passphrase.Source // 暗号化された秘密鍵のパスフレーズ (入力の鍵のみに使う)
+
+	KidResolver   *jwk.KidResolver    // 鍵ファイルの kid の決め方 (serve と同じ設定にする)
+	Lifecycle     *lifecycle.Manifest // 鍵のライフサイクル (nil の場合は状態を表示しない)
+	PublicKeyDir  string              // トークンの kid を探す公開鍵のディレクトリ
+	PrivateKeyDir string              // 対応する秘密鍵を探すディレクトリ
+}
+
+func NewInspector(f FileOperator) *Inspector {
+	return &Inspector{
+		FileOperator:  f,
+		HTTPClient:    http.DefaultClient,
+		KidResolver:   &jwk.KidResolver{},
+		PublicKeyDir:  defaultPublicKeyDir,
+		PrivateKeyDir: defaultPrivateKeyDir,
+	}
+}
+
+// Report は調べた結果
+type Report struct {
+	Source string     `json:"source"`
+	Kind   string     `json:"kind"`
+	Token  *TokenInfo `json:"token,omitempty"`
+	Keys   []KeyInfo  `json:"keys"`
+}
+
+// TokenInfo はトークンのヘッダーの情報
+type TokenInfo struct {
+	Alg string `json:"alg,omitempty"`
+	Enc string `json:"enc,omitempty"`
+	Kid string `json:"kid,omitempty"`
+	Typ string `json:"typ,omitempty"`
+}
+
+// KeyInfo は 1 つの鍵の情報
+type KeyInfo struct {
+	Source          string   `json:"source,omitempty"` // 入力とは別のファイルから読んだ場合のパス
+	Kid             string   `json:"kid,omitempty"`
+	KidSource       string   `json:"kid_source,omitempty"`
+	Private         bool     `json:"private"`
+	Kty             string   `json:"kty"`
+	Crv             string   `json:"crv,omitempty"`
+	Size            int      `json:"size"` // 鍵長 (bit)
+	Alg             string   `json:"alg,omitempty"`
+	Use             string   `json:"use,omitempty"`
+	State           string   `json:"state,omitempty"`   // Lifecycle での現在の状態
+	Thumbprint      string   `json:"thumbprint"`        // JWK Thumbprint (RFC 7638, SHA-256)
+	SPKIFingerprint string   `json:"spki_sha256"`       // SPKI (DER) の SHA-256 (16 進)
+	PrivateKeyFiles []string `json:"private_key_files"` // PrivateKeyDir の対応する秘密鍵
+	Warnings        []string `json:"warnings,omitempty"`
+}
+
+// Inspect は source (ファイルのパスまたは http(s) の URL) の内容を調べる
+func (i *Inspector) Inspect(source string) (*Report, error) {
+	b, name, err := i.load(source)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{Source: source}
+
+	trimmed := bytes.TrimSpace(b)
+	switch {
+	case isCompactToken(trimmed):
+		err = i.inspectToken(report, string(trimmed))
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		err = i.inspectJSON(report, trimmed)
+	default:
+		err = i.inspectKey(report, trimmed, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := i.findPrivateKeys(report); err != nil {
+		return nil, err
+	}
+	if i.Lifecycle != nil {
+		now := time.Now()
+		for n, k := range report.Keys {
+			if k.Kid != "" {
+				report.Keys[n].State = i.Lifecycle.State(k.Kid, now)
+			}
+		}
+	}
+	return report, nil
+}
+
+// load は source の内容と kid の決定に使うファイル名を返す
+func (i *Inspector) load(source string) ([]byte, string, error) {
+	u, err := url.Parse(source)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		b, err := i.FileOperator.LoadTxtFile(source)
+		if err != nil {
+			slog.Error("failed to load file", "path", source, "error", err)
+			return nil, "", err
+		}
+		return b, filepath.Base(source), nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, source, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	res, err := i.HTTPClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, res.Body)
+		return nil, "", fmt.Errorf("failed to fetch %s: status code %d", source, res.StatusCode)
+	}
+	b, err := io.ReadAll(io.LimitReader(res.Body, maxFetchSize))
+	if err != nil {
+		return nil, "", err
+	}
+	return b, path.Base(u.Path), nil
+}
+
+// inspectKey は PEM または OpenSSH の鍵を調べる。kid は serve と同じ規則でファイル名から決める
+func (i *Inspector) inspectKey(report *Report, b []byte, name string) error {
+	c := convert.NewConverter(nil)
+	c.Passphrase = i.Passphrase
+	key, err := c.Parse(b)
+	if err != nil {
+		return err
+	}
+	report.Kind = KindKey
+
+	info, err := newKeyInfo(key.Public, key.Private != nil)
+	if err != nil {
+		return err
+	}
+	if kid, err := i.KidResolver.Kid(name, key.Public); err == nil {
+		info.Kid, info.KidSource = kid, i.kidSource(name, info.Thumbprint)
+	} else {
+		info.Warnings = append(info.Warnings, "serve cannot derive a kid: "+err.Error())
+	}
+	if !info.Private {
+		if _, err := issue.SigningMethodForKey(key.Public, ""); err != nil {
+			info.Warnings = append(info.Warnings, "serve does not publish this key from the public key directory: "+err.Error())
+		}
+	}
+	report.Keys = append(report.Keys, info)
+	return nil
+}
+
+// kidSource は KidResolver が kid を何から決めたかを返す
+func (i *Inspector) kidSource(name, thumbprint string) string {
+	base := strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+	if _, ok := i.KidResolver.Overrides[thumbprint]; ok {
+		return KidFromOverride
+	}
+	if _, ok := i.KidResolver.Overrides[base]; ok {
+		return KidFromOverride
+	}
+	if i.KidResolver.Mode == jwk.KidModeThumbprint {
+		return KidThumbprint
+	}
+	return KidFromFileName
+}
+
+// inspectJSON は JWK または JWKS を調べる
+func (i *Inspector) inspectJSON(report *Report, b []byte) error {
+	var set struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &set); err != nil {
+		return fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	raws := set.Keys
+	report.Kind = KindJWKS
+	if set.Keys == nil {
+		raws = []json.RawMessage{b}
+		report.Kind = KindKey
+	}
+
+	for n, raw := range raws {
+		var k jwk.PrivateKey
+		if err := json.Unmarshal(raw, &k); err != nil {
+			return fmt.Errorf("failed to parse JWK #%d: %w", n, err)
+		}
+		info, err := jwkInfo(&k)
+		if err != nil {
+			// JWKS の他の鍵は調べられるよう、読めない鍵は警告として残す
+			if report.Kind == KindKey {
+				return err
+			}
+			report.Keys = append(report.Keys, KeyInfo{Kid: k.Kid, Kty: k.Kty, Crv: k.Crv, Warnings: []string{err.Error()}})
+			continue
+		}
+		report.Keys = append(report.Keys, info)
+	}
+	return nil
+}
+
+func jwkInfo(k *jwk.PrivateKey) (KeyInfo, error) {
+	var pub crypto.PublicKey
+	private := k.D != ""
+	if private {
+		signer, err := k.Signer()
+		if err != nil {
+			return KeyInfo{}, err
+		}
+		pub = signer.Public()
+	} else {
+		var err error
+		if pub, err = jwk.PublicKey(k.Key); err != nil {
+			return KeyInfo{}, err
+		}
+	}
+	info, err := newKeyInfo(pub, private)
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	info.Alg, info.Use = k.Alg, k.Use
+	if k.Kid != "" {
+		info.Kid, info.KidSource = k.Kid, KidFromJWK
+	}
+	return info, nil
+}
+
+// inspectToken はトークンのヘッダーを調べ、kid に対応する公開鍵を PublicKeyDir から探す
+// DPoP proof のように jwk ヘッダーを持つ場合はその鍵も調べる
+func (i *Inspector) inspectToken(report *Report, token string) error {
+	parts := strings.Split(token, ".")
+	report.Kind = KindJWS
+	if len(parts) == 5 {
+		report.Kind = KindJWE
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return fmt.Errorf("failed to decode token header: %w", err)
+	}
+	var header struct {
+		TokenInfo
+		JWK *jwk.PrivateKey `json:"jwk"`
+	}
+	if err := json.Unmarshal(b, &header); err != nil {
+		return fmt.Errorf("failed to parse token header: %w", err)
+	}
+	report.Token = &header.TokenInfo
+
+	if header.JWK != nil {
+		if header.JWK.D != "" {
+			return fmt.Errorf("jwk header of the token contains a private key")
+		}
+		info, err := jwkInfo(header.JWK)
+		if err != nil {
+			return fmt.Errorf("invalid jwk header: %w", err)
+		}
+		report.Keys = append(report.Keys, info)
+	}
+
+	if header.Kid == "" || report.Kind == KindJWE {
+		return nil
+	}
+	info, err := i.findPublishedKey(header.Kid)
+	if err != nil {
+		return err
+	}
+	if info == nil {
+		slog.Warn("kid of the token is not found in the public key directory", "kid", header.Kid, "dir", i.PublicKeyDir)
+		return nil
+	}
+	if info.Alg == "" {
+		info.Alg = header.Alg
+	}
+	report.Keys = append(report.Keys, *info)
+	return nil
+}
+
+// findPublishedKey は PublicKeyDir から serve が kid を割り当てる公開鍵を探す (無い場合は nil)
+func (i *Inspector) findPublishedKey(kid string) (*KeyInfo, error) {
+	names, err := i.FileOperator.GetFileNames(i.PublicKeyDir)
+	if err != nil {
+		slog.Warn("failed to get public key file names", "dir", i.PublicKeyDir, "error", err)
+		return nil, nil
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := filepath.Join(i.PublicKeyDir, name)
+		b, err := i.FileOperator.LoadTxtFile(p)
+		if err != nil {
+			return nil, err
+		}
+		key, err := convert.NewConverter(nil).Parse(b)
+		if err != nil || key.Private != nil {
+			continue
+		}
+		if k, err := i.KidResolver.Kid(name, key.Public); err != nil || k != kid {
+			continue
+		}
+		info, err := newKeyInfo(key.Public, false)
+		if err != nil {
+			return nil, err
+		}
+		info.Source, info.Kid, info.KidSource = p, kid, KidFromToken
+		return &info, nil
+	}
+	return nil, nil
+}
+
+// findPrivateKeys は PrivateKeyDir から各鍵の公開鍵と一致する秘密鍵を探す
+// 暗号化された秘密鍵はパスフレーズを求めずに読み飛ばす
+func (i *Inspector) findPrivateKeys(report *Report) error {
+	if len(report.Keys) == 0 {
+		return nil
+	}
+	names, err := i.FileOperator.GetFileNames(i.PrivateKeyDir)
+	if err != nil {
+		slog.Warn("failed to get private key file names", "dir", i.PrivateKeyDir, "error", err)
+		return nil
+	}
+	sort.Strings(names)
+
+	byThumbprint := map[string][]string{}
+	for _, name := range names {
+		p := filepath.Join(i.PrivateKeyDir, name)
+		b, err := i.FileOperator.LoadTxtFile(p)
+		if err != nil {
+			return err
+		}
+		signer, _, err := issue.ParsePrivateKeyPEM(b, nil)
+		if err != nil {
+			slog.Info("skipping private key", "file_name", name, "error", err)
+			continue
+		}
+		thumbprint, err := jwk.Thumbprint(signer.Public())
+		if err != nil {
+			continue
+		}
+		byThumbprint[thumbprint] = append(byThumbprint[thumbprint], p)
+	}
+
+	for n := range report.Keys {
+		report.Keys[n].PrivateKeyFiles = byThumbprint[report.Keys[n].Thumbprint]
+		if report.Keys[n].PrivateKeyFiles == nil {
+			report.Keys[n].PrivateKeyFiles = []string{}
+		}
+	}
+	return nil
+}
+
+// newKeyInfo は公開鍵の種類、鍵長、JWK Thumbprint、SPKI のフィンガープリントを求める
+func newKeyInfo(pub crypto.PublicKey, private bool) (KeyInfo, error) {
+	info := KeyInfo{Private: private}
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+		info.Kty, info.Crv, info.Size = "OKP", "Ed25519", 256
+	case *ecdh.PublicKey:
+		if k.Curve() != ecdh.X25519() {
+			return KeyInfo{}, fmt.Errorf("unsupported ECDH curve")
+		}
+		info.Kty, info.Crv, info.Size = "OKP", "X25519", 256
+	case *ecdsa.PublicKey:
+		info.Kty, info.Crv, info.Size = "EC", k.Curve.Params().Name, k.Curve.Params().BitSize
+	case *rsa.PublicKey:
+		info.Kty, info.Size = "RSA", k.N.BitLen()
+	default:
+		return KeyInfo{}, fmt.Errorf("unsupported key type: %T", pub)
+	}
+
+	thumbprint, err := jwk.Thumbprint(pub)
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	sum := sha256.Sum256(der)
+	info.Thumbprint, info.SPKIFingerprint = thumbprint, hex.EncodeToString(sum[:])
+	return info, nil
+}
+
+// isCompactToken は b が JWS (3 つ) または JWE (5 つ) の compact serialization かどうかを返す
+func isCompactToken(b []byte) bool {
+	parts := strings.Split(string(b), ".")
+	if len(parts) != 3 && len(parts) != 5 {
+		return false
+	}
+	for _, p := range parts {
+		for _, r := range p {
+			if !(r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+				return false
+			}
+		}
+	}
+	return parts[0] != ""
+}
+
+// WriteText は report を人が読む形式で w に書き込む
+func (r *Report) WriteText(w io.Writer) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "source: %s (%s)\n", r.Source, r.Kind)
+	if r.Token != nil {
+		fmt.Fprintf(&sb, "token: alg=%s", r.Token.Alg)
+		for _, kv := range [][2]string{{"enc", r.Token.Enc}, {"kid", r.Token.Kid}, {"typ", r.Token.Typ}} {
+			if kv[1] != "" {
+				fmt.Fprintf(&sb, " %s=%s", kv[0], kv[1])
+			}
+		}
+		sb.WriteString("\n")
+	}
+	for _, k := range r.Keys {
+		sb.WriteString("\n")
+		if k.Source != "" {
+			fmt.Fprintf(&sb, "  file:         %s\n", k.Source)
+		}
+		kid := "(none)"
+		if k.Kid != "" {
+			kid = k.Kid + " (" + k.KidSource + ")"
+		}
+		fmt.Fprintf(&sb, "  kid:          %s\n", kid)
+		kind := "public"
+		if k.Private {
+			kind = "private"
+		}
+		typ := k.Kty
+		if k.Crv != "" {
+			typ += " " + k.Crv
+		}
+		if k.Size > 0 {
+			typ += fmt.Sprintf(" (%d bits)", k.Size)
+		}
+		fmt.Fprintf(&sb, "  type:         %s %s\n", typ, kind)
+		if k.State != "" {
+			fmt.Fprintf(&sb, "  state:        %s\n", k.State)
+		}
+		if k.Alg != "" || k.Use != "" {
+			fmt.Fprintf(&sb, "  alg / use:    %s / %s\n", orNone(k.Alg), orNone(k.Use))
+		}
+		if k.Thumbprint != "" {
+			fmt.Fprintf(&sb, "  thumbprint:   %s\n", k.Thumbprint)
+			fmt.Fprintf(&sb, "  spki sha256:  %s\n", k.SPKIFingerprint)
+		}
+		if k.PrivateKeyFiles != nil {
+			files := "(not found)"
+			if len(k.PrivateKeyFiles) > 0 {
+				files = strings.Join(k.PrivateKeyFiles, ", ")
+			}
+			fmt.Fprintf(&sb, "  private key:  %s\n", files)
+		}
+		for _, warning := range k.Warnings {
+			fmt.Fprintf(&sb, "  warning:      %s\n", warning)
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
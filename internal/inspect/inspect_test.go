@@ -0,0 +1,279 @@
+package inspect
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jwks_demo/internal/jwk"
+	"github.com/jwks_demo/internal/lifecycle"
+)
+
+func publicPEM(t *testing.T, pub crypto.PublicKey) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func privatePEM(t *testing.T, priv crypto.Signer) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func token(header map[string]any, parts int) string {
+	b, _ := json.Marshal(header)
+	segments := []string{base64.RawURLEncoding.EncodeToString(b)}
+	for len(segments) < parts {
+		segments = append(segments, "c2ln")
+	}
+	return strings.Join(segments, ".")
+}
+
+func TestInspector_Inspect(t *testing.T) {
+	edPub, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	weakKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+	edThumbprint, _ := jwk.Thumbprint(edPub)
+	der, _ := x509.MarshalPKIXPublicKey(edPub)
+	spki := sha256.Sum256(der)
+
+	edJWK, _ := jwk.FromPublicKey("jwk-ed", edPub, "EdDSA")
+	ecJWK, _ := jwk.FromPrivateKey("jwk-ec", ecKey, "ES256")
+	jwks, _ := json.Marshal(map[string]any{"keys": []any{edJWK, ecJWK, map[string]string{"kty": "oct", "kid": "secret"}}})
+
+	files := map[string][]byte{
+		"files/public/key-001.pem":  publicPEM(t, edPub),
+		"files/private/key-001.pem": privatePEM(t, edKey),
+		"files/private/backup.pem":  privatePEM(t, edKey),
+		"files/private/broken.pem":  []byte("not a key"),
+		"ec.pem":                    publicPEM(t, &ecKey.PublicKey),
+		"weak.pem":                  publicPEM(t, &weakKey.PublicKey),
+		"key.jwk":                   mustJSON(t, ecJWK),
+		"jws.txt":                   []byte(token(map[string]any{"alg": "EdDSA", "kid": "key-001", "typ": "JWT"}, 3) + "\n"),
+		"jwe.txt":                   []byte(token(map[string]any{"alg": "ECDH-ES+A256KW", "enc": "A256GCM", "kid": "enc-001"}, 5)),
+		"dpop.txt":                  []byte(token(map[string]any{"alg": "EdDSA", "typ": "dpop+jwt", "jwk": edJWK}, 3)),
+		"unknown.jws":               []byte(token(map[string]any{"alg": "EdDSA", "kid": "missing"}, 3)),
+		"garbage.txt":               []byte("hello world"),
+	}
+
+	tests := []struct {
+		name      string
+		source    string
+		resolver  *jwk.KidResolver
+		lifecycle *lifecycle.Manifest
+		http      *MockHTTPClient
+		want      func(t *testing.T, r *Report)
+		wantErr   bool
+	}{
+		{
+			name: "published public key", source: "files/public/key-001.pem",
+			want: func(t *testing.T, r *Report) {
+				want := KeyInfo{
+					Kid: "key-001", KidSource: KidFromFileName, Kty: "OKP", Crv: "Ed25519", Size: 256,
+					Thumbprint: edThumbprint, SPKIFingerprint: hex.EncodeToString(spki[:]),
+					PrivateKeyFiles: []string{"files/private/backup.pem", "files/private/key-001.pem"},
+				}
+				if r.Kind != KindKey || len(r.Keys) != 1 || !reflect.DeepEqual(r.Keys[0], want) {
+					t.Errorf("Inspector.Inspect() = %+v, want key %+v", r, want)
+				}
+			},
+		},
+		{
+			name: "thumbprint kid mode", source: "files/public/key-001.pem", resolver: &jwk.KidResolver{Mode: jwk.KidModeThumbprint},
+			want: func(t *testing.T, r *Report) {
+				if r.Keys[0].Kid != edThumbprint || r.Keys[0].KidSource != KidThumbprint {
+					t.Errorf("Inspector.Inspect() key = %+v", r.Keys[0])
+				}
+			},
+		},
+		{
+			name: "kid map override", source: "files/public/key-001.pem", resolver: &jwk.KidResolver{Overrides: map[string]string{"key-001": "custom"}},
+			want: func(t *testing.T, r *Report) {
+				if r.Keys[0].Kid != "custom" || r.Keys[0].KidSource != KidFromOverride {
+					t.Errorf("Inspector.Inspect() key = %+v", r.Keys[0])
+				}
+			},
+		},
+		{
+			name: "lifecycle state", source: "files/public/key-001.pem",
+			lifecycle: &lifecycle.Manifest{Keys: map[string]*lifecycle.Metadata{"key-001": {Status: lifecycle.StateRetiring}}},
+			want: func(t *testing.T, r *Report) {
+				if r.Keys[0].State != lifecycle.StateRetiring {
+					t.Errorf("Inspector.Inspect() key = %+v", r.Keys[0])
+				}
+			},
+		},
+		{
+			name: "private key file", source: "files/private/key-001.pem",
+			want: func(t *testing.T, r *Report) {
+				if !r.Keys[0].Private || r.Keys[0].Thumbprint != edThumbprint || len(r.Keys[0].Warnings) != 0 {
+					t.Errorf("Inspector.Inspect() key = %+v", r.Keys[0])
+				}
+			},
+		},
+		{
+			name: "EC public key", source: "ec.pem",
+			want: func(t *testing.T, r *Report) {
+				k := r.Keys[0]
+				if k.Kty != "EC" || k.Crv != "P-256" || k.Size != 256 || len(k.Warnings) != 0 || len(k.PrivateKeyFiles) != 0 {
+					t.Errorf("Inspector.Inspect() key = %+v", k)
+				}
+			},
+		},
+		{
+			name: "small RSA public key is not served", source: "weak.pem",
+			want: func(t *testing.T, r *Report) {
+				k := r.Keys[0]
+				if k.Kty != "RSA" || k.Size != 1024 || len(k.Warnings) != 1 {
+					t.Errorf("Inspector.Inspect() key = %+v", k)
+				}
+			},
+		},
+		{
+			name: "private JWK", source: "key.jwk",
+			want: func(t *testing.T, r *Report) {
+				k := r.Keys[0]
+				if r.Kind != KindKey || !k.Private || k.Kid != "jwk-ec" || k.KidSource != KidFromJWK || k.Alg != "ES256" || k.Use != "sig" {
+					t.Errorf("Inspector.Inspect() key = %+v", k)
+				}
+			},
+		},
+		{
+			name: "JWKS from URL", source: "https://issuer.example/.well-known/jwks.json",
+			http: &MockHTTPClient{StatusCode: 200, Body: string(jwks)},
+			want: func(t *testing.T, r *Report) {
+				if r.Kind != KindJWKS || len(r.Keys) != 3 {
+					t.Fatalf("Inspector.Inspect() = %+v", r)
+				}
+				if r.Keys[0].Kid != "jwk-ed" || !reflect.DeepEqual(r.Keys[0].PrivateKeyFiles, []string{"files/private/backup.pem", "files/private/key-001.pem"}) {
+					t.Errorf("Inspector.Inspect() key = %+v", r.Keys[0])
+				}
+				if r.Keys[1].Kid != "jwk-ec" || !r.Keys[1].Private {
+					t.Errorf("Inspector.Inspect() key = %+v", r.Keys[1])
+				}
+				// 読めない鍵は警告として残す
+				if r.Keys[2].Kid != "secret" || len(r.Keys[2].Warnings) != 1 {
+					t.Errorf("Inspector.Inspect() key = %+v", r.Keys[2])
+				}
+			},
+		},
+		{
+			name: "JWS resolves kid in the public key directory", source: "jws.txt",
+			want: func(t *testing.T, r *Report) {
+				if r.Kind != KindJWS || r.Token == nil || r.Token.Kid != "key-001" || r.Token.Typ != "JWT" {
+					t.Fatalf("Inspector.Inspect() = %+v", r)
+				}
+				k := r.Keys[0]
+				if len(r.Keys) != 1 || k.Source != "files/public/key-001.pem" || k.KidSource != KidFromToken || k.Alg != "EdDSA" || len(k.PrivateKeyFiles) != 2 {
+					t.Errorf("Inspector.Inspect() key = %+v", k)
+				}
+			},
+		},
+		{
+			name: "JWS with unknown kid", source: "unknown.jws",
+			want: func(t *testing.T, r *Report) {
+				if r.Kind != KindJWS || len(r.Keys) != 0 {
+					t.Errorf("Inspector.Inspect() = %+v", r)
+				}
+			},
+		},
+		{
+			name: "JWS with jwk header", source: "dpop.txt",
+			want: func(t *testing.T, r *Report) {
+				if len(r.Keys) != 1 || r.Keys[0].Thumbprint != edThumbprint || r.Keys[0].Kid != "jwk-ed" {
+					t.Errorf("Inspector.Inspect() = %+v", r)
+				}
+			},
+		},
+		{
+			name: "JWE", source: "jwe.txt",
+			want: func(t *testing.T, r *Report) {
+				if r.Kind != KindJWE || r.Token.Enc != "A256GCM" || len(r.Keys) != 0 {
+					t.Errorf("Inspector.Inspect() = %+v", r)
+				}
+			},
+		},
+		{name: "error URL status", source: "https://issuer.example/jwks.json", http: &MockHTTPClient{StatusCode: 404}, wantErr: true},
+		{name: "error missing file", source: "missing.pem", wantErr: true},
+		{name: "error unknown format", source: "garbage.txt", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := NewInspector(&MockFileOperator{Files: files})
+			if tt.resolver != nil {
+				i.KidResolver = tt.resolver
+			}
+			i.Lifecycle = tt.lifecycle
+			if tt.http != nil {
+				i.HTTPClient = tt.http
+			}
+			got, err := i.Inspect(tt.source)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Inspector.Inspect() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			tt.want(t, got)
+		})
+	}
+}
+
+func TestReport_WriteText(t *testing.T) {
+	r := &Report{
+		Source: "jws.txt",
+		Kind:   KindJWS,
+		Token:  &TokenInfo{Alg: "EdDSA", Kid: "key-001"},
+		Keys: []KeyInfo{{
+			Source: "files/public/key-001.pem", Kid: "key-001", KidSource: KidFromToken, Kty: "OKP", Crv: "Ed25519", Size: 256,
+			Thumbprint: "tp", SPKIFingerprint: "fp", PrivateKeyFiles: []string{}, Warnings: []string{"careful"},
+		}},
+	}
+	var sb strings.Builder
+	if err := r.WriteText(&sb); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"source: jws.txt (jws)",
+		"token: alg=EdDSA kid=key-001",
+		"file:         files/public/key-001.pem",
+		"kid:          key-001 (token kid)",
+		"type:         OKP Ed25519 (256 bits) public",
+		"thumbprint:   tp",
+		"spki sha256:  fp",
+		"private key:  (not found)",
+		"warning:      careful",
+	} {
+		if !strings.Contains(sb.String(), want) {
+			t.Errorf("Report.WriteText() = %s, want containing %q", sb.String(), want)
+		}
+	}
+}
+
+func mustJSON(t *testing.T, v any) []byte {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
@@ -0,0 +1,57 @@
+package inspect
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// MockFileOperator は FileOperator インターフェースのモック実装です。
+type MockFileOperator struct {
+	Files map[string][]byte // filePath -> 内容
+}
+
+// LoadTxtFile は Files に登録された内容を返します。
+func (m *MockFileOperator) LoadTxtFile(filePath string) ([]byte, error) {
+	b, ok := m.Files[filePath]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return b, nil
+}
+
+// GetFileNames は Files に登録されたファイルのうち dirPath 直下のファイル名を返します。
+func (m *MockFileOperator) GetFileNames(dirPath string) ([]string, error) {
+	var names []string
+	for p := range m.Files {
+		if filepath.Dir(p) == filepath.Clean(dirPath) {
+			names = append(names, filepath.Base(p))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// MockHTTPClient は HTTPClient インターフェースのモック実装です。
+type MockHTTPClient struct {
+	StatusCode int
+	Body       string
+	Err        error
+	Requests   []*http.Request // 受け取ったリクエスト
+}
+
+// Do は設定されたレスポンスを返します。
+func (m *MockHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	m.Requests = append(m.Requests, req)
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	return &http.Response{
+		StatusCode: m.StatusCode,
+		Body:       io.NopCloser(bytes.NewBufferString(m.Body)),
+		Header:     make(http.Header),
+	}, nil
+}
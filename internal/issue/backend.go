@@ -0,0 +1,113 @@
+package issue
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jwks_demo/internal/passphrase"
+)
+
+// KeyBackend は秘密鍵を保持し、鍵の参照から署名に使う crypto.Signer を返す
+// 署名は crypto.Signer を通して行うため、バックエンドによっては呼び出し側が秘密鍵に触れずに署名できる
+type KeyBackend interface {
+	// Signer は keyRef (秘密鍵のファイルパス) の鍵の crypto.Signer と、鍵に設定された署名アルゴリズム (無い場合は空) を返す
+	Signer(keyRef string) (crypto.Signer, string, error)
+}
+
+// PEMBackend は PEM ファイルの秘密鍵を読み込んで署名するバックエンド
+type PEMBackend struct {
+	FileOperator FileOperator
+	Passphrase   passphrase.Source // 暗号化された秘密鍵のパスフレーズ (nil の場合は暗号化された鍵を扱えない)
+}
+
+// Signer は keyRef の PEM ファイルを読み込み、秘密鍵と PEM ヘッダーの Alg を返す
+func (b *PEMBackend) Signer(keyRef string) (crypto.Signer, string, error) {
+	pemBytes, err := b.FileOperator.LoadTxtFile(keyRef)
+	if err != nil {
+		return nil, "", err
+	}
+	return ParsePrivateKeyPEM(pemBytes, b.Passphrase)
+}
+
+// CachingBackend は Backend から取得した crypto.Signer を鍵の参照ごとに保持するバックエンド
+// serve のように同じ鍵で繰り返し署名する場合に、秘密鍵の読み込みと (暗号化された鍵の) 復号を鍵ごとに一度だけにする
+// 取得に失敗した鍵は保持せず、次の呼び出しで再度取得する
+type CachingBackend struct {
+	Backend KeyBackend
+
+	mu      sync.Mutex
+	signers map[string]cachedSigner // keyRef -> 取得済みの鍵
+}
+
+type cachedSigner struct {
+	signer crypto.Signer
+	alg    string
+}
+
+// NewCachingBackend は backend から取得した鍵を保持する CachingBackend を返す
+func NewCachingBackend(backend KeyBackend) *CachingBackend {
+	return &CachingBackend{Backend: backend, signers: map[string]cachedSigner{}}
+}
+
+// Signer は保持している keyRef の鍵を返す。無い場合は Backend から取得して保持する
+// 同じ鍵を同時に復号しないよう、取得の間はロックを保持する
+func (b *CachingBackend) Signer(keyRef string) (crypto.Signer, string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c, ok := b.signers[keyRef]; ok {
+		return c.signer, c.alg, nil
+	}
+	signer, alg, err := b.Backend.Signer(keyRef)
+	if err != nil {
+		return nil, "", err
+	}
+	if b.signers == nil {
+		b.signers = map[string]cachedSigner{}
+	}
+	b.signers[keyRef] = cachedSigner{signer: signer, alg: alg}
+	return signer, alg, nil
+}
+
+// signJWS は JWS の署名入力 (header.payload) に signer で method の署名を行い、JWS 形式の署名を返す
+// golang-jwt の SigningMethod は RSA / ECDSA で具体的な秘密鍵の型を要求するため、crypto.Signer で直接署名する
+func signJWS(signer crypto.Signer, method jwt.SigningMethod, signingInput []byte) ([]byte, error) {
+	switch m := method.(type) {
+	case *jwt.SigningMethodEd25519:
+		return signer.Sign(rand.Reader, signingInput, crypto.Hash(0))
+
+	case *jwt.SigningMethodRSA:
+		return signer.Sign(rand.Reader, digest(m.Hash, signingInput), m.Hash)
+
+	case *jwt.SigningMethodRSAPSS:
+		opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: m.Hash}
+		return signer.Sign(rand.Reader, digest(m.Hash, signingInput), opts)
+
+	case *jwt.SigningMethodECDSA:
+		der, err := signer.Sign(rand.Reader, digest(m.Hash, signingInput), m.Hash)
+		if err != nil {
+			return nil, err
+		}
+		// crypto.Signer は ASN.1 DER の署名を返すため、JWS の R || S 形式に変換する
+		var sig struct{ R, S *big.Int }
+		if _, err := asn1.Unmarshal(der, &sig); err != nil {
+			return nil, fmt.Errorf("failed to parse ECDSA signature: %w", err)
+		}
+		out := make([]byte, 2*m.KeySize)
+		sig.R.FillBytes(out[:m.KeySize])
+		sig.S.FillBytes(out[m.KeySize:])
+		return out, nil
+	}
+	return nil, fmt.Errorf("unsupported signing method: %s", method.Alg())
+}
+
+func digest(h crypto.Hash, b []byte) []byte {
+	hasher := h.New()
+	hasher.Write(b)
+	return hasher.Sum(nil)
+}
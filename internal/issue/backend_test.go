@@ -0,0 +1,124 @@
+package issue
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jwks_demo/internal/model"
+)
+
+// opaqueSigner は具体的な秘密鍵の型を隠した crypto.Signer (HSM やエージェントの代わり)
+type opaqueSigner struct {
+	signer crypto.Signer
+}
+
+func (s *opaqueSigner) Public() crypto.PublicKey { return s.signer.Public() }
+
+func (s *opaqueSigner) Sign(r io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return s.signer.Sign(r, digest, opts)
+}
+
+func TestSigner_Sign_backend(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	p521, _ := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	ed, _, err := ParsePrivateKeyPEM([]byte(testPrivateKeyPem), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		signer crypto.Signer
+		alg    string
+		keyAlg string
+	}{
+		{name: "EdDSA", signer: ed, alg: "EdDSA"},
+		{name: "RS256", signer: rsaKey, alg: "RS256"},
+		{name: "RS512", signer: rsaKey, alg: "RS512"},
+		{name: "PS256", signer: rsaKey, alg: "PS256"},
+		{name: "PS384 from key alg", signer: rsaKey, keyAlg: "PS384"},
+		{name: "ES256", signer: p256, alg: "ES256"},
+		{name: "ES384", signer: p384},
+		{name: "ES512", signer: p521, alg: "ES512"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := NewIssuer(&MockFileOperator{})
+			i.Algorithm = tt.alg
+			i.Backend = &MockKeyBackend{Signers: map[string]crypto.Signer{"key": &opaqueSigner{tt.signer}}, Alg: tt.keyAlg}
+
+			s, err := i.NewSigner("key", "kid-1")
+			if err != nil {
+				t.Fatalf("Issuer.NewSigner() error = %v", err)
+			}
+			claims := &model.CustomClaims{RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}}
+			token, header, err := s.Sign(nil, claims)
+			if err != nil {
+				t.Fatalf("Signer.Sign() error = %v", err)
+			}
+
+			parsed, err := jwt.Parse(token, func(*jwt.Token) (any, error) {
+				return tt.signer.Public(), nil
+			}, jwt.WithValidMethods([]string{header["alg"].(string)}))
+			if err != nil || !parsed.Valid {
+				t.Errorf("failed to verify token signed by backend (alg %v): %v", header["alg"], err)
+			}
+		})
+	}
+}
+
+func TestIssuer_NewSigner_backendError(t *testing.T) {
+	i := NewIssuer(&MockFileOperator{})
+	i.Backend = &MockKeyBackend{}
+	if _, err := i.NewSigner("unknown", "kid"); err == nil {
+		t.Error("Issuer.NewSigner() with unknown key succeeded")
+	}
+	if _, err := i.PublicKey("unknown"); err == nil {
+		t.Error("Issuer.PublicKey() with unknown key succeeded")
+	}
+}
+
+func TestCachingBackend_Signer(t *testing.T) {
+	ed, _, err := ParsePrivateKeyPEM([]byte(testPrivateKeyPem), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &opaqueSigner{ed}
+	mock := &MockKeyBackend{Signers: map[string]crypto.Signer{"key": want}, Alg: "EdDSA"}
+	b := NewCachingBackend(mock)
+
+	for range 3 {
+		signer, alg, err := b.Signer("key")
+		if err != nil {
+			t.Fatalf("CachingBackend.Signer() error = %v", err)
+		}
+		if signer != crypto.Signer(want) || alg != "EdDSA" {
+			t.Errorf("CachingBackend.Signer() = %v, %q", signer, alg)
+		}
+	}
+	if mock.Calls != 1 {
+		t.Errorf("backend was called %d times, want 1", mock.Calls)
+	}
+
+	// 取得に失敗した鍵は保持しない
+	for range 2 {
+		if _, _, err := b.Signer("unknown"); err == nil {
+			t.Error("CachingBackend.Signer() with unknown key succeeded")
+		}
+	}
+	if mock.Calls != 3 {
+		t.Errorf("backend was called %d times, want 3", mock.Calls)
+	}
+}
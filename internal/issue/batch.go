@@ -0,0 +1,201 @@
+package issue
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/jwks_demo/internal/model"
+)
+
+// 一括発行の入力形式
+const (
+	BatchFormatJSONL = "jsonl" // 1 行に 1 つのクレームの JSON オブジェクト
+	BatchFormatCSV   = "csv"   // 1 行目がクレーム名のヘッダー
+)
+
+// BatchResult は一括発行したトークン 1 件分の出力
+type BatchResult struct {
+	Token     string `json:"token"`
+	JTI       string `json:"jti"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// ReadBatchInput は JSONL または CSV 形式の入力からクレームの組を読み込む
+// CSV の値は JSON として解釈できる場合はその値を、できない場合は文字列として扱い、空の値は読み飛ばす
+func ReadBatchInput(r io.Reader, format string) ([]map[string]any, error) {
+	switch format {
+	case BatchFormatJSONL:
+		return readBatchJSONL(r)
+	case BatchFormatCSV:
+		return readBatchCSV(r)
+	}
+	return nil, fmt.Errorf("unsupported batch input format: %q (expected %q or %q)", format, BatchFormatJSONL, BatchFormatCSV)
+}
+
+func readBatchJSONL(r io.Reader) ([]map[string]any, error) {
+	var records []map[string]any
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		record := map[string]any{}
+		if err := json.Unmarshal([]byte(text), &record); err != nil {
+			return nil, fmt.Errorf("line %d: invalid claims: %w", line, err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// stringClaims は CSV やクレームテンプレートの値を JSON として解釈しない登録済みクレーム
+var stringClaims = map[string]bool{"iss": true, "sub": true, "aud": true, "jti": true}
+
+func readBatchCSV(r io.Reader) ([]map[string]any, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var records []map[string]any
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var args []string
+		strs := map[string]any{}
+		for i, v := range row {
+			if v == "" {
+				continue
+			}
+			// 文字列型の登録済みクレームは数値のような値でも文字列のまま扱う (aud は JSON 配列も受け付ける)
+			if stringClaims[header[i]] && !strings.HasPrefix(v, "[") {
+				strs[header[i]] = v
+				continue
+			}
+			args = append(args, header[i]+"="+v)
+		}
+		record, err := ParseClaimArgs(args)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		for k, v := range strs {
+			record[k] = v
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// BuildBatchClaims は opts から組み立てたクレームを既定値とし、入力ごとのクレームで上書きする
+// 入力に jti が無い場合は生成し、Template や Provider が設定されている場合は入力ごとに適用する
+// 不正な入力がある場合は署名前にエラーを返す
+func (i *Issuer) BuildBatchClaims(opts ClaimsOptions, records []map[string]any) ([]*model.CustomClaims, error) {
+	// テンプレートは入力ごとに描画するため、既定値には描画しない
+	base, err := i.buildClaims(opts)
+	if err != nil {
+		return nil, err
+	}
+	baseJSON, err := json.Marshal(base)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := make([]*model.CustomClaims, 0, len(records))
+	for n, record := range records {
+		merged := map[string]any{}
+		if err := json.Unmarshal(baseJSON, &merged); err != nil {
+			return nil, err
+		}
+		for k, v := range record {
+			merged[k] = v
+		}
+		b, err := json.Marshal(merged)
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %w", n+1, err)
+		}
+
+		c := &model.CustomClaims{}
+		if err := json.Unmarshal(b, c); err != nil {
+			return nil, fmt.Errorf("record %d: invalid claims: %w", n+1, err)
+		}
+		// jti はトークンごとに一意にするため、入力で指定されない限り既定値を引き継がない
+		if _, ok := record["jti"]; !ok || c.ID == "" {
+			c.ID = NewJTI()
+		}
+		if i.Template != nil {
+			if c, err = i.Template.Render(c, i.now()); err != nil {
+				return nil, fmt.Errorf("record %d: %w", n+1, err)
+			}
+		}
+		if i.Provider != nil {
+			if c, err = i.applyProvider(c); err != nil {
+				return nil, fmt.Errorf("record %d: %w", n+1, err)
+			}
+		}
+		if err := ValidateClaims(c); err != nil {
+			return nil, fmt.Errorf("record %d: %w", n+1, err)
+		}
+		claims = append(claims, c)
+	}
+	return claims, nil
+}
+
+// IssueBatch は claims のそれぞれに signer で署名し、入力と同じ順序で結果を返す
+// 署名は最大 workers 個の goroutine で並列に行う
+func IssueBatch(signer *Signer, claims []*model.CustomClaims, workers int) ([]BatchResult, error) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	results := make([]BatchResult, len(claims))
+	errs := make([]error, len(claims))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for range min(workers, len(claims)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range jobs {
+				c := claims[n]
+				token, _, err := signer.Sign(nil, c)
+				if err != nil {
+					errs[n] = fmt.Errorf("record %d: %w", n+1, err)
+					continue
+				}
+				results[n] = BatchResult{Token: token, JTI: c.ID, ExpiresAt: c.ExpiresAt.Unix()}
+			}
+		}()
+	}
+	for n := range claims {
+		jobs <- n
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
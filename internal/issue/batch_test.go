@@ -0,0 +1,197 @@
+package issue
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jwks_demo/internal/model"
+)
+
+func TestReadBatchInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		format  string
+		want    []map[string]any
+		wantErr bool
+	}{
+		{
+			name:   "jsonl",
+			input:  "{\"sub\":\"alice\",\"admin\":true}\n\n{\"sub\":\"bob\",\"exp\":1700000600}\n",
+			format: BatchFormatJSONL,
+			want: []map[string]any{
+				{"sub": "alice", "admin": true},
+				{"sub": "bob", "exp": float64(1700000600)},
+			},
+		},
+		{
+			name:   "csv",
+			input:  "sub,aud,level,groups\n12345,api,3,\"[\"\"a\"\",\"\"b\"\"]\"\nbob,,,\n",
+			format: BatchFormatCSV,
+			want: []map[string]any{
+				{"sub": "12345", "aud": "api", "level": float64(3), "groups": []any{"a", "b"}},
+				{"sub": "bob"},
+			},
+		},
+		{
+			name:    "error invalid jsonl line",
+			input:   "{\"sub\":\"alice\"}\n{\"sub\":\n",
+			format:  BatchFormatJSONL,
+			wantErr: true,
+		},
+		{
+			name:    "error csv column count mismatch",
+			input:   "sub,aud\nalice\n",
+			format:  BatchFormatCSV,
+			wantErr: true,
+		},
+		{
+			name:    "error unsupported format",
+			input:   "",
+			format:  "yaml",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadBatchInput(strings.NewReader(tt.input), tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ReadBatchInput() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadBatchInput() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIssuer_BuildBatchClaims(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	files := map[string][]byte{
+		"claims.json": []byte(`{"jti":"shared","role":"user"}`),
+	}
+
+	tests := []struct {
+		name     string
+		opts     ClaimsOptions
+		template string
+		records  []map[string]any
+		check    func(t *testing.T, got []*model.CustomClaims)
+		wantErr  bool
+	}{
+		{
+			name:    "records override defaults",
+			opts:    ClaimsOptions{Issuer: "batch_issuer", ClaimsFile: "claims.json"},
+			records: []map[string]any{{"sub": "alice", "role": "admin"}, {"sub": "bob", "jti": "bob-1"}},
+			check: func(t *testing.T, got []*model.CustomClaims) {
+				if len(got) != 2 {
+					t.Fatalf("len = %d, want 2", len(got))
+				}
+				if got[0].Subject != "alice" || got[0].Issuer != "batch_issuer" || got[0].Extra["role"] != "admin" {
+					t.Errorf("record 1 = %+v", got[0])
+				}
+				if got[1].Subject != "bob" || got[1].Extra["role"] != "user" || got[1].ID != "bob-1" {
+					t.Errorf("record 2 = %+v", got[1])
+				}
+				if got[0].ID == "" || got[0].ID == "shared" {
+					t.Errorf("record 1 jti = %q, want a generated one", got[0].ID)
+				}
+				if !got[0].ExpiresAt.Equal(now.Add(time.Hour)) {
+					t.Errorf("record 1 exp = %v, want %v", got[0].ExpiresAt, now.Add(time.Hour))
+				}
+			},
+		},
+		{
+			name:     "template rendered per record",
+			template: `{"email": "{{ .sub }}@example.com"}`,
+			records:  []map[string]any{{"sub": "alice"}, {"sub": "bob"}},
+			check: func(t *testing.T, got []*model.CustomClaims) {
+				if got[0].Extra["email"] != "alice@example.com" || got[1].Extra["email"] != "bob@example.com" {
+					t.Errorf("records = %+v, %+v", got[0].Extra, got[1].Extra)
+				}
+			},
+		},
+		{
+			name:     "error template of a record",
+			template: `{"email": "{{ .mail }}@example.com"}`,
+			records:  []map[string]any{{"sub": "alice"}},
+			wantErr:  true,
+		},
+		{
+			name:    "error invalid record",
+			records: []map[string]any{{"sub": "alice"}, {"exp": float64(now.Add(-time.Hour).Unix())}},
+			wantErr: true,
+		},
+		{
+			name:    "error invalid claim type",
+			records: []map[string]any{{"sub": 1}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := &Issuer{
+				FileOperator: &MockFileOperator{Files: files},
+				clock:        func() time.Time { return now },
+			}
+			if tt.template != "" {
+				tmpl, err := ParseClaimsTemplate([]byte(tt.template))
+				if err != nil {
+					t.Fatal(err)
+				}
+				i.Template = tmpl
+			}
+			got, err := i.BuildBatchClaims(tt.opts, tt.records)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Issuer.BuildBatchClaims() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.check != nil {
+				tt.check(t, got)
+			}
+		})
+	}
+}
+
+func TestIssueBatch(t *testing.T) {
+	privPem, _ := newEd25519Pems(t)
+	i := NewIssuer(&MockFileOperator{Files: map[string][]byte{"key.pem": privPem}})
+	signer, err := i.NewSigner("key.pem", "key-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := time.Now().Add(time.Hour)
+	var claims []*model.CustomClaims
+	for n := range 20 {
+		claims = append(claims, &model.CustomClaims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				ID:        NewJTI(),
+				ExpiresAt: jwt.NewNumericDate(exp.Add(time.Duration(n) * time.Second)),
+			},
+		})
+	}
+
+	for _, workers := range []int{0, 1, 4, 100} {
+		got, err := IssueBatch(signer, claims, workers)
+		if err != nil {
+			t.Fatalf("IssueBatch(workers=%d) error = %v", workers, err)
+		}
+		if len(got) != len(claims) {
+			t.Fatalf("IssueBatch(workers=%d) len = %d, want %d", workers, len(got), len(claims))
+		}
+		for n, r := range got {
+			if r.JTI != claims[n].ID || r.ExpiresAt != claims[n].ExpiresAt.Unix() {
+				t.Errorf("IssueBatch(workers=%d)[%d] = %+v, want jti %s", workers, n, r, claims[n].ID)
+			}
+			parsed := &model.CustomClaims{}
+			if _, _, err := jwt.NewParser().ParseUnverified(r.Token, parsed); err != nil || parsed.ID != claims[n].ID {
+				t.Errorf("IssueBatch(workers=%d)[%d] token jti = %q, err = %v", workers, n, parsed.ID, err)
+			}
+		}
+	}
+}
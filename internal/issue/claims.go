@@ -0,0 +1,215 @@
+package issue
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jwks_demo/internal/model"
+)
+
+const (
+	defaultIssuer  = "jwks_demo_issuer"
+	defaultSubject = "jwks_demo_subject"
+)
+
+// ClaimsOptions は発行する JWT のクレームを組み立てるための設定
+// ゼロ値の項目はクレームファイルの値、無ければ既定値を使う
+type ClaimsOptions struct {
+	ClaimsFile string        // JSON 形式のクレームファイル
+	Issuer     string        // iss
+	Subject    string        // sub
+	Audience   []string      // aud
+	Lifetime   time.Duration // exp = iat + Lifetime
+	NotBefore  time.Time     // nbf
+	IssuedAt   time.Time     // iat (ゼロ値なら現在時刻)
+	Extra      map[string]any
+	Defaults   ClaimsDefaults // クレームファイルにもオプションにも無い場合に使う値
+}
+
+// ClaimsDefaults はクレームファイルより優先度の低い既定値 (設定ファイルのプロファイルの値など)
+type ClaimsDefaults struct {
+	Issuer   string         // iss
+	Subject  string         // sub
+	Audience []string       // aud
+	Lifetime time.Duration  // exp = iat + Lifetime
+	Extra    map[string]any // 追加のクレーム
+}
+
+// BuildClaims はクレームファイルとオプションからクレームを組み立てて検証する
+// 優先順位はオプション、クレームファイル、opts.Defaults、組み込みの既定値の順
+// Template が設定されている場合は組み立てたクレームで描画する
+// (DPoP や証明書への結び付け、ステータスの割り当てはこの後に行うため、テンプレートで上書きされない)
+func (i *Issuer) BuildClaims(opts ClaimsOptions) (*model.CustomClaims, error) {
+	claims, err := i.buildClaims(opts)
+	if err != nil {
+		return nil, err
+	}
+	if i.Template != nil {
+		if claims, err = i.Template.Render(claims, i.now()); err != nil {
+			slog.Error("failed to render claims template", "error", err)
+			return nil, err
+		}
+		if err := ValidateClaims(claims); err != nil {
+			return nil, err
+		}
+	}
+	return claims, nil
+}
+
+// buildClaims はテンプレートを描画せずにクレームを組み立てて検証する
+func (i *Issuer) buildClaims(opts ClaimsOptions) (*model.CustomClaims, error) {
+	claims := &model.CustomClaims{}
+	if opts.ClaimsFile != "" {
+		b, err := i.FileOperator.LoadTxtFile(opts.ClaimsFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, claims); err != nil {
+			return nil, fmt.Errorf("failed to parse claims file: %w", err)
+		}
+	}
+
+	if opts.Issuer != "" {
+		claims.Issuer = opts.Issuer
+	}
+	if claims.Issuer == "" {
+		claims.Issuer = opts.Defaults.Issuer
+	}
+	if claims.Issuer == "" {
+		claims.Issuer = defaultIssuer
+	}
+	if opts.Subject != "" {
+		claims.Subject = opts.Subject
+	}
+	if claims.Subject == "" {
+		claims.Subject = opts.Defaults.Subject
+	}
+	if claims.Subject == "" {
+		claims.Subject = defaultSubject
+	}
+	if len(opts.Audience) > 0 {
+		claims.Audience = jwt.ClaimStrings(opts.Audience)
+	}
+	if len(claims.Audience) == 0 && len(opts.Defaults.Audience) > 0 {
+		claims.Audience = jwt.ClaimStrings(opts.Defaults.Audience)
+	}
+
+	if !opts.IssuedAt.IsZero() {
+		claims.IssuedAt = jwt.NewNumericDate(opts.IssuedAt)
+	}
+	if claims.IssuedAt == nil {
+		claims.IssuedAt = jwt.NewNumericDate(i.now())
+	}
+	if !opts.NotBefore.IsZero() {
+		claims.NotBefore = jwt.NewNumericDate(opts.NotBefore)
+	}
+
+	if opts.Lifetime < 0 {
+		return nil, fmt.Errorf("lifetime must not be negative: %s", opts.Lifetime)
+	}
+	if opts.Defaults.Lifetime < 0 {
+		return nil, fmt.Errorf("lifetime must not be negative: %s", opts.Defaults.Lifetime)
+	}
+	if opts.Lifetime > 0 {
+		claims.ExpiresAt = jwt.NewNumericDate(claims.IssuedAt.Add(opts.Lifetime))
+	}
+	if claims.ExpiresAt == nil && opts.Defaults.Lifetime > 0 {
+		claims.ExpiresAt = jwt.NewNumericDate(claims.IssuedAt.Add(opts.Defaults.Lifetime))
+	}
+	if claims.ExpiresAt == nil {
+		claims.ExpiresAt = jwt.NewNumericDate(claims.IssuedAt.Add(time.Second * tokenExpirationTime))
+	}
+
+	for k, v := range opts.Extra {
+		if claims.Extra == nil {
+			claims.Extra = map[string]any{}
+		}
+		claims.Extra[k] = v
+	}
+	for k, v := range opts.Defaults.Extra {
+		if _, ok := claims.Extra[k]; ok {
+			continue
+		}
+		if claims.Extra == nil {
+			claims.Extra = map[string]any{}
+		}
+		claims.Extra[k] = v
+	}
+
+	if err := ValidateClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// ValidateClaims は署名前にクレームの整合性を検証する
+func ValidateClaims(c *model.CustomClaims) error {
+	for k := range c.Extra {
+		if model.IsReservedClaim(k) {
+			return fmt.Errorf("claim %q is reserved and cannot be set as an extra claim", k)
+		}
+	}
+
+	if c.ExpiresAt == nil {
+		return fmt.Errorf("exp is required")
+	}
+	if c.IssuedAt != nil && !c.ExpiresAt.After(c.IssuedAt.Time) {
+		return fmt.Errorf("exp (%s) must be after iat (%s)", c.ExpiresAt.Time, c.IssuedAt.Time)
+	}
+	if c.NotBefore != nil && !c.ExpiresAt.After(c.NotBefore.Time) {
+		return fmt.Errorf("exp (%s) must be after nbf (%s)", c.ExpiresAt.Time, c.NotBefore.Time)
+	}
+	for _, aud := range c.Audience {
+		if aud == "" {
+			return fmt.Errorf("aud must not contain an empty value")
+		}
+	}
+	return nil
+}
+
+// NewJTI はトークンを一意に識別するためのランダムな jti を生成する
+func NewJTI() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err) // crypto/rand は失敗しない
+	}
+	return hex.EncodeToString(b)
+}
+
+// ParseTime は RFC3339 形式または UNIX 秒の文字列を time.Time に変換する
+func ParseTime(s string) (time.Time, error) {
+	if sec, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q (expected RFC3339 or unix seconds)", s)
+	}
+	return t, nil
+}
+
+// ParseClaimArgs は key=value 形式の文字列をクレームのマップに変換する
+// value が JSON として解釈できる場合はその値を、できない場合は文字列として扱う
+func ParseClaimArgs(args []string) (map[string]any, error) {
+	claims := map[string]any{}
+	for _, a := range args {
+		k, v, ok := strings.Cut(a, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid claim %q (expected key=value)", a)
+		}
+
+		var value any
+		if err := json.Unmarshal([]byte(v), &value); err != nil {
+			value = v
+		}
+		claims[k] = value
+	}
+	return claims, nil
+}
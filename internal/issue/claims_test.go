@@ -0,0 +1,224 @@
+package issue
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jwks_demo/internal/model"
+)
+
+func TestIssuer_BuildClaims(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	files := map[string][]byte{
+		"claims.json":  []byte(`{"iss":"file_issuer","aud":"file_aud","exp":1700000600,"role":"admin"}`),
+		"invalid.json": []byte(`{"iss":`),
+	}
+
+	tests := []struct {
+		name    string
+		opts    ClaimsOptions
+		want    *model.CustomClaims
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			opts: ClaimsOptions{},
+			want: &model.CustomClaims{
+				RegisteredClaims: jwt.RegisteredClaims{
+					Issuer:    defaultIssuer,
+					Subject:   defaultSubject,
+					IssuedAt:  jwt.NewNumericDate(now),
+					ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+				},
+			},
+		},
+		{
+			name: "options",
+			opts: ClaimsOptions{
+				Issuer:    "my_issuer",
+				Subject:   "my_subject",
+				Audience:  []string{"aud1", "aud2"},
+				Lifetime:  5 * time.Minute,
+				NotBefore: now.Add(time.Minute),
+				Extra:     map[string]any{"scope": "read"},
+			},
+			want: &model.CustomClaims{
+				RegisteredClaims: jwt.RegisteredClaims{
+					Issuer:    "my_issuer",
+					Subject:   "my_subject",
+					Audience:  jwt.ClaimStrings{"aud1", "aud2"},
+					IssuedAt:  jwt.NewNumericDate(now),
+					NotBefore: jwt.NewNumericDate(now.Add(time.Minute)),
+					ExpiresAt: jwt.NewNumericDate(now.Add(5 * time.Minute)),
+				},
+				Extra: map[string]any{"scope": "read"},
+			},
+		},
+		{
+			name: "claims file overridden by options",
+			opts: ClaimsOptions{
+				ClaimsFile: "claims.json",
+				Issuer:     "my_issuer",
+			},
+			want: &model.CustomClaims{
+				RegisteredClaims: jwt.RegisteredClaims{
+					Issuer:    "my_issuer",
+					Subject:   defaultSubject,
+					Audience:  jwt.ClaimStrings{"file_aud"},
+					IssuedAt:  jwt.NewNumericDate(now),
+					ExpiresAt: jwt.NewNumericDate(time.Unix(1700000600, 0)),
+				},
+				Extra: map[string]any{"role": "admin"},
+			},
+		},
+		{
+			name: "defaults used when neither options nor claims file set them",
+			opts: ClaimsOptions{
+				Defaults: ClaimsDefaults{
+					Issuer:   "profile_issuer",
+					Subject:  "profile_subject",
+					Audience: []string{"profile_aud"},
+					Lifetime: 10 * time.Minute,
+					Extra:    map[string]any{"tenant": "profile"},
+				},
+			},
+			want: &model.CustomClaims{
+				RegisteredClaims: jwt.RegisteredClaims{
+					Issuer:    "profile_issuer",
+					Subject:   "profile_subject",
+					Audience:  jwt.ClaimStrings{"profile_aud"},
+					IssuedAt:  jwt.NewNumericDate(now),
+					ExpiresAt: jwt.NewNumericDate(now.Add(10 * time.Minute)),
+				},
+				Extra: map[string]any{"tenant": "profile"},
+			},
+		},
+		{
+			name: "claims file overrides defaults",
+			opts: ClaimsOptions{
+				ClaimsFile: "claims.json",
+				Defaults: ClaimsDefaults{
+					Issuer:   "profile_issuer",
+					Subject:  "profile_subject",
+					Audience: []string{"profile_aud"},
+					Lifetime: 10 * time.Minute,
+					Extra:    map[string]any{"role": "profile", "tenant": "profile"},
+				},
+			},
+			want: &model.CustomClaims{
+				RegisteredClaims: jwt.RegisteredClaims{
+					Issuer:    "file_issuer",
+					Subject:   "profile_subject",
+					Audience:  jwt.ClaimStrings{"file_aud"},
+					IssuedAt:  jwt.NewNumericDate(now),
+					ExpiresAt: jwt.NewNumericDate(time.Unix(1700000600, 0)),
+				},
+				Extra: map[string]any{"role": "admin", "tenant": "profile"},
+			},
+		},
+		{
+			name: "options override claims file and defaults",
+			opts: ClaimsOptions{
+				ClaimsFile: "claims.json",
+				Issuer:     "my_issuer",
+				Lifetime:   5 * time.Minute,
+				Extra:      map[string]any{"role": "user"},
+				Defaults: ClaimsDefaults{
+					Issuer:   "profile_issuer",
+					Lifetime: 10 * time.Minute,
+					Extra:    map[string]any{"role": "profile"},
+				},
+			},
+			want: &model.CustomClaims{
+				RegisteredClaims: jwt.RegisteredClaims{
+					Issuer:    "my_issuer",
+					Subject:   defaultSubject,
+					Audience:  jwt.ClaimStrings{"file_aud"},
+					IssuedAt:  jwt.NewNumericDate(now),
+					ExpiresAt: jwt.NewNumericDate(now.Add(5 * time.Minute)),
+				},
+				Extra: map[string]any{"role": "user"},
+			},
+		},
+		{
+			name:    "error negative default lifetime",
+			opts:    ClaimsOptions{Defaults: ClaimsDefaults{Lifetime: -time.Minute}},
+			wantErr: true,
+		},
+		{
+			name:    "error nbf after exp",
+			opts:    ClaimsOptions{Lifetime: time.Minute, NotBefore: now.Add(time.Hour)},
+			wantErr: true,
+		},
+		{
+			name:    "error reserved extra claim",
+			opts:    ClaimsOptions{Extra: map[string]any{"exp": 1}},
+			wantErr: true,
+		},
+		{
+			name:    "error negative lifetime",
+			opts:    ClaimsOptions{Lifetime: -time.Minute},
+			wantErr: true,
+		},
+		{
+			name:    "error claims file not found",
+			opts:    ClaimsOptions{ClaimsFile: "notfound.json"},
+			wantErr: true,
+		},
+		{
+			name:    "error invalid claims file",
+			opts:    ClaimsOptions{ClaimsFile: "invalid.json"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := &Issuer{
+				FileOperator: &MockFileOperator{Files: files},
+				clock:        func() time.Time { return now },
+			}
+			got, err := i.BuildClaims(tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Issuer.BuildClaims() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Issuer.BuildClaims() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseClaimArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    map[string]any
+		wantErr bool
+	}{
+		{
+			name: "string and json values",
+			args: []string{"name=alice", "admin=true", "groups=[\"a\",\"b\"]"},
+			want: map[string]any{"name": "alice", "admin": true, "groups": []any{"a", "b"}},
+		},
+		{
+			name:    "error missing value",
+			args:    []string{"name"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseClaimArgs(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseClaimArgs() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseClaimArgs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
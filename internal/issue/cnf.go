@@ -0,0 +1,56 @@
+package issue
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/jwks_demo/internal/model"
+	"github.com/jwks_demo/internal/mtls"
+)
+
+// SetConfirmation はクレームの cnf に確認メソッドを追加する (RFC 7800)
+// クレームファイルなどで既に設定された cnf のメンバーは残し、cnf で指定したメンバーを上書きする
+func SetConfirmation(claims *model.CustomClaims, cnf model.Confirmation) error {
+	merged := map[string]any{}
+	if current, ok := claims.Extra["cnf"]; ok {
+		b, err := json.Marshal(current)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(b, &merged); err != nil {
+			return fmt.Errorf("invalid cnf claim: %w", err)
+		}
+	}
+
+	// 空のメンバーは omitempty で出力されないため上書きしない
+	b, err := json.Marshal(cnf)
+	if err != nil {
+		return err
+	}
+	var members map[string]any
+	if err := json.Unmarshal(b, &members); err != nil {
+		return err
+	}
+	for k, v := range members {
+		merged[k] = v
+	}
+
+	if claims.Extra == nil {
+		claims.Extra = map[string]any{}
+	}
+	claims.Extra["cnf"] = merged
+	return nil
+}
+
+// BindCertificate は certPath のクライアント証明書の SHA-256 thumbprint を cnf["x5t#S256"] としてクレームに設定する (RFC 8705)
+func (i *Issuer) BindCertificate(claims *model.CustomClaims, certPath string) error {
+	b, err := i.FileOperator.LoadTxtFile(certPath)
+	if err != nil {
+		return err
+	}
+	cert, err := mtls.ParseCertificatePEM(b)
+	if err != nil {
+		return err
+	}
+	return SetConfirmation(claims, model.Confirmation{X5tS256: mtls.Thumbprint(cert)})
+}
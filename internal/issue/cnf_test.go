@@ -0,0 +1,63 @@
+package issue
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jwks_demo/internal/model"
+)
+
+// openssl で作成したクライアント証明書とその x5t#S256
+const (
+	testClientCertPem = `-----BEGIN CERTIFICATE-----
+MIHkMIGXAhRl6g9KcAI5VG+xNV7Oei9ATszEIzAFBgMrZXAwEjEQMA4GA1UEAwwH
+dGVzdC1jYTAgFw0yNjEwMTcxMzI0MjBaGA8yMTI2MDkyMzEzMjQyMFowFjEUMBIG
+A1UEAwwLdGVzdC1jbGllbnQwKjAFBgMrZXADIQDwwSzB2Izrrse9NEOdm1jUGS1j
+1B2PDjmGpIH8ewxFdTAFBgMrZXADQQBru2OyA77G5Uf7x6PqOv8thBEUxlC9C0+c
+jCNcaf10eRolyxgGIPobc/3fdPW4YH2HGccIoNuHI2GUFVjgenUO
+-----END CERTIFICATE-----
+`
+	testClientCertThumbprint = "4yBDlTT3nkKEfbRxbdD3bSEh-199kneaNqF8vxWGHHM"
+)
+
+func TestIssuer_BindCertificate(t *testing.T) {
+	i := NewIssuer(&MockFileOperator{Files: map[string][]byte{
+		"client.pem":  []byte(testClientCertPem),
+		"invalid.pem": []byte(testPrivateKeyPem),
+	}})
+
+	tests := []struct {
+		name     string
+		claims   *model.CustomClaims
+		certPath string
+		want     map[string]any
+		wantErr  bool
+	}{
+		{
+			name:     "bind",
+			claims:   &model.CustomClaims{},
+			certPath: "client.pem",
+			want:     map[string]any{"x5t#S256": testClientCertThumbprint},
+		},
+		{
+			name:     "keeps DPoP binding",
+			claims:   &model.CustomClaims{Extra: map[string]any{"cnf": model.Confirmation{JKT: "jkt"}}},
+			certPath: "client.pem",
+			want:     map[string]any{"jkt": "jkt", "x5t#S256": testClientCertThumbprint},
+		},
+		{name: "error not a certificate", claims: &model.CustomClaims{}, certPath: "invalid.pem", wantErr: true},
+		{name: "error file not found", claims: &model.CustomClaims{}, certPath: "notfound.pem", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := i.BindCertificate(tt.claims, tt.certPath)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Issuer.BindCertificate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(tt.claims.Extra["cnf"], tt.want) {
+				t.Errorf("Issuer.BindCertificate() cnf = %v, want %v", tt.claims.Extra["cnf"], tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package issue
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jwks_demo/internal/dpop"
+	"github.com/jwks_demo/internal/model"
+)
+
+// BindDPoP は DPoP proof を検証し、その公開鍵の JWK Thumbprint を cnf.jkt としてクレームに設定する (RFC 9449)
+// method と uri が空でない場合は proof の htm / htu がそれぞれ一致することも確認する
+func (i *Issuer) BindDPoP(claims *model.CustomClaims, proof, method, uri string) error {
+	p, err := dpop.ParseProof(proof, i.now(), dpop.DefaultMaxAge)
+	if err != nil {
+		return err
+	}
+	if method != "" || uri != "" {
+		if err := p.Check(method, uri, ""); err != nil {
+			return err
+		}
+	}
+	return SetConfirmation(claims, model.Confirmation{JKT: p.Thumbprint})
+}
+
+// DPoPProof は privateKeyPath の Ed25519 鍵で、リクエスト (htm, htu) に対する DPoP proof を作成する
+// accessToken が空でない場合はそのハッシュを ath として含める (リソースサーバーへの proof)
+func (i *Issuer) DPoPProof(privateKeyPath, htm, htu, accessToken string) (string, error) {
+	signer, _, err := i.backend().Signer(privateKeyPath)
+	if err != nil {
+		return "", err
+	}
+	pub, ok := signer.Public().(ed25519.PublicKey)
+	if !ok {
+		return "", fmt.Errorf("DPoP proofs require an Ed25519 key: %T", signer.Public())
+	}
+
+	claims := &model.CustomClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:       NewJTI(),
+			IssuedAt: jwt.NewNumericDate(i.now()),
+		},
+		Extra: map[string]any{"htm": htm, "htu": htu},
+	}
+	if accessToken != "" {
+		claims.Extra["ath"] = dpop.AccessTokenHash(accessToken)
+	}
+	header := map[string]any{
+		"typ": dpop.ProofType,
+		"jwk": model.Key{Kty: "OKP", Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(pub)},
+	}
+
+	s := &Signer{signer: signer, method: jwt.SigningMethodEdDSA}
+	token, _, err := s.Sign(header, claims)
+	return token, err
+}
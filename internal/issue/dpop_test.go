@@ -0,0 +1,90 @@
+package issue
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jwks_demo/internal/dpop"
+	"github.com/jwks_demo/internal/jwk"
+	"github.com/jwks_demo/internal/model"
+)
+
+func TestIssuer_BindDPoP(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	privPem, _ := newEd25519Pems(t)
+	rsaPem := newRSAPem(t, 2048, false, nil)
+	i := &Issuer{
+		FileOperator: &MockFileOperator{Files: map[string][]byte{"client.pem": privPem, "rsa.pem": rsaPem}},
+		clock:        func() time.Time { return now },
+	}
+	const tokenEndpoint = "https://as.example.com/token"
+
+	proof, err := i.DPoPProof("client.pem", "POST", tokenEndpoint, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, _, _ := i.backend().Signer("client.pem")
+	wantJKT, _ := jwk.Thumbprint(signer.Public())
+
+	if _, err := i.DPoPProof("rsa.pem", "POST", tokenEndpoint, ""); err == nil {
+		t.Error("Issuer.DPoPProof() with RSA key succeeded")
+	}
+
+	tests := []struct {
+		name    string
+		claims  *model.CustomClaims
+		method  string
+		uri     string
+		want    map[string]any
+		wantErr bool
+	}{
+		{name: "bind", claims: &model.CustomClaims{}, want: map[string]any{"jkt": wantJKT}},
+		{name: "bind with htm and htu", claims: &model.CustomClaims{}, method: "POST", uri: tokenEndpoint, want: map[string]any{"jkt": wantJKT}},
+		{
+			name:   "overrides jkt in claims file",
+			claims: &model.CustomClaims{Extra: map[string]any{"cnf": map[string]any{"jkt": "old", "kid": "client-key"}}},
+			want:   map[string]any{"jkt": wantJKT, "kid": "client-key"},
+		},
+		{name: "error htu mismatch", claims: &model.CustomClaims{}, method: "POST", uri: "https://as.example.com/other", wantErr: true},
+		{name: "error invalid cnf", claims: &model.CustomClaims{Extra: map[string]any{"cnf": "invalid"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := i.BindDPoP(tt.claims, proof, tt.method, tt.uri)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Issuer.BindDPoP() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := tt.claims.Extra["cnf"]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Issuer.BindDPoP() cnf = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("error expired proof", func(t *testing.T) {
+		late := &Issuer{FileOperator: i.FileOperator, clock: func() time.Time { return now.Add(dpop.DefaultMaxAge + time.Second) }}
+		if err := late.BindDPoP(&model.CustomClaims{}, proof, "", ""); err == nil {
+			t.Error("Issuer.BindDPoP() with expired proof succeeded")
+		}
+	})
+}
+
+func TestIssuer_DPoPProof_ath(t *testing.T) {
+	privPem, _ := newEd25519Pems(t)
+	i := NewIssuer(&MockFileOperator{Files: map[string][]byte{"client.pem": privPem}})
+	proof, err := i.DPoPProof("client.pem", "GET", "https://rs.example.com/resource", "access-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := dpop.ParseProof(proof, time.Now(), dpop.DefaultMaxAge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Check("GET", "https://rs.example.com/resource", "access-token"); err != nil {
+		t.Errorf("Proof.Check() error = %v", err)
+	}
+}
@@ -0,0 +1,30 @@
+package issue
+
+import (
+	"log/slog"
+
+	"github.com/jwks_demo/internal/jwe"
+)
+
+// Encrypt は署名済みのトークンを recipientKeyPath の公開鍵宛ての JWE で包む (入れ子の JWT, cty: "JWT")
+// kid には受信者の暗号化鍵の kid を指定する
+func (i *Issuer) Encrypt(signedToken string, recipientKeyPath string, kid string) (string, error) {
+	pubPem, err := i.FileOperator.LoadTxtFile(recipientKeyPath)
+	if err != nil {
+		return "", err
+	}
+
+	pub, err := jwe.ParsePublicKeyPEM(pubPem)
+	if err != nil {
+		return "", err
+	}
+
+	encrypted, err := jwe.Encrypt([]byte(signedToken), pub, kid, "JWT")
+	if err != nil {
+		slog.Error("failed to encrypt token", "error", err)
+		return "", err
+	}
+
+	slog.Info("successfully encrypted JWT", "kid", kid, "recipient", recipientKeyPath)
+	return encrypted, nil
+}
@@ -0,0 +1,56 @@
+package issue
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/jwks_demo/internal/jwe"
+)
+
+func TestIssuer_Encrypt(t *testing.T) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(key.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i := NewIssuer(&MockFileOperator{Files: map[string][]byte{
+		"enc_pub.pem": pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}),
+		"invalid.pem": []byte("invalid"),
+	}})
+
+	tests := []struct {
+		name    string
+		keyPath string
+		wantErr bool
+	}{
+		{name: "normal", keyPath: "enc_pub.pem"},
+		{name: "error invalid key", keyPath: "invalid.pem", wantErr: true},
+		{name: "error key not found", keyPath: "missing.pem", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := i.Encrypt("signed.jwt.token", tt.keyPath, "enc-key")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Issuer.Encrypt() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			payload, header, err := jwe.Decrypt(got, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(payload) != "signed.jwt.token" || header.Cty != "JWT" || header.Kid != "enc-key" {
+				t.Errorf("Issuer.Encrypt() payload = %s, header = %+v", payload, header)
+			}
+		})
+	}
+}
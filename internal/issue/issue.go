@@ -1,19 +1,35 @@
 package issue
 
 import (
-	"crypto/ed25519"
-	"crypto/x509"
-	"encoding/pem"
+	"crypto"
+	"errors"
 	"fmt"
 	"log/slog"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/jwks_demo/internal/lifecycle"
+	"github.com/jwks_demo/internal/model"
+	"github.com/jwks_demo/internal/passphrase"
 )
 
 const tokenExpirationTime = 3600 // トークンの有効期限 (秒)
 type Issuer struct {
 	FileOperator FileOperator
+	Algorithm    string            // 署名アルゴリズム (空の場合は鍵の種類から決定)
+	Passphrase   passphrase.Source // 暗号化された秘密鍵のパスフレーズ (nil の場合は暗号化された鍵を扱えない)
+	Backend      KeyBackend        // 署名鍵のバックエンド (nil の場合は FileOperator で PEM ファイルを読む)
+	Template     *ClaimsTemplate   // BuildClaims / BuildBatchClaims でトークンごとに描画するクレームテンプレート (nil の場合は使わない)
+
+	// 署名前に追加のクレームを取得する外部クレームプロバイダー (nil の場合は使わない)
+	// プロバイダーがエラーを返した場合は発行しない
+	Provider         ClaimsProvider
+	ProviderConflict string // プロバイダーのクレームが既存のクレームと衝突した場合の扱い (空の場合は ConflictError)
+
+	// 鍵のライフサイクル (nil の場合は確認しない)。active でない kid では署名しない
+	Lifecycle *lifecycle.Manifest
+
+	clock func() time.Time // テスト用に差し替え可能な現在時刻
 }
 
 type FileOperator interface {
@@ -26,60 +42,156 @@ func NewIssuer(f FileOperator) *Issuer {
 	}
 }
 
-func (i *Issuer) Issue(privateKeyPath string, kid string) error {
-	privateKeyLine, err := i.FileOperator.LoadTxtFile(privateKeyPath)
+// backend は署名に使う KeyBackend を返す
+func (i *Issuer) backend() KeyBackend {
+	if i.Backend != nil {
+		return i.Backend
+	}
+	return &PEMBackend{FileOperator: i.FileOperator, Passphrase: i.Passphrase}
+}
+
+func (i *Issuer) now() time.Time {
+	if i.clock != nil {
+		return i.clock()
+	}
+	return time.Now()
+}
+
+// IssuedToken は署名済みの JWT とそのヘッダー・クレームを保持する
+type IssuedToken struct {
+	Token  string              // compact 形式の署名済みトークン
+	Header map[string]any      // JOSE ヘッダー
+	Claims *model.CustomClaims // 署名したクレーム
+}
+
+// Issue はクレームを検証して署名する
+// Provider が設定されている場合はそのクレームを追加して発行する
+// Template は DPoP や証明書への結び付け、ステータスの割り当ての前に BuildClaims で描画するため、
+// Template が設定されている場合は描画されていないクレームには署名しない
+func (i *Issuer) Issue(privateKeyPath string, kid string, claims *model.CustomClaims) (*IssuedToken, error) {
+	if i.Template != nil && !claims.TemplateRendered {
+		slog.Error("claims are not rendered with the claims template")
+		return nil, errors.New("claims template is set but the claims are not rendered; build the claims with BuildClaims")
+	}
+
+	if i.Provider != nil {
+		merged, err := i.applyProvider(claims)
+		if err != nil {
+			slog.Error("failed to get claims from the claims provider", "error", err)
+			return nil, err
+		}
+		claims = merged
+	}
+
+	if err := ValidateClaims(claims); err != nil {
+		slog.Error("invalid claims", "error", err)
+		return nil, err
+	}
+
+	signedToken, header, err := i.Sign(privateKeyPath, kid, nil, claims)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// PEMデータをデコード
-	block, rest := pem.Decode(privateKeyLine)
-	if block == nil {
-		slog.Error("failed to decode PEM block", "rest", string(rest))
-		return err
+	slog.Info("successfully issued JWT", "kid", kid, "alg", header["alg"], "exp", claims.ExpiresAt)
+	return &IssuedToken{
+		Token:  signedToken,
+		Header: header,
+		Claims: claims,
+	}, nil
+}
+
+// Sign は privateKeyPath の秘密鍵で任意のクレームに署名し、compact 形式のトークンと JOSE ヘッダーを返す
+// header で指定した値は既定のヘッダー (alg, typ, kid) に追加・上書きされる (alg は上書きできない)
+// Issue と異なりクレームの検証は行わない
+func (i *Issuer) Sign(privateKeyPath string, kid string, header map[string]any, claims jwt.Claims) (string, map[string]any, error) {
+	signer, err := i.NewSigner(privateKeyPath, kid)
+	if err != nil {
+		return "", nil, err
 	}
-	if block.Type != "PRIVATE KEY" {
-		slog.Error("unsupported key type", "type", block.Type)
-		return err
+	return signer.Sign(header, claims)
+}
+
+// Signer は読み込み済みの秘密鍵で署名する
+// 秘密鍵のパースは NewSigner で一度だけ行うため、多数のトークンに署名する場合に使う
+// 複数の goroutine から同時に使ってよい
+type Signer struct {
+	signer crypto.Signer
+	method jwt.SigningMethod
+	kid    string
+}
+
+// NewSigner は privateKeyPath の秘密鍵をバックエンドから取得し、kid を設定して署名する Signer を返す
+// Lifecycle が設定されている場合、kid が active でなければエラーを返す (マニフェストに無い kid は default_status が無ければ署名しない)
+// アルゴリズムは Issuer.Algorithm、鍵に設定されたアルゴリズム (PEM ヘッダーの Alg)、鍵の種類の既定値の順に優先する
+func (i *Issuer) NewSigner(privateKeyPath string, kid string) (*Signer, error) {
+	if i.Lifecycle != nil {
+		if !i.Lifecycle.Listed(kid) {
+			slog.Warn("signing key is not in the key manifest", "kid", kid, "default_status", i.Lifecycle.DefaultStatus)
+		}
+		if err := i.Lifecycle.CheckSigning(kid, i.now()); err != nil {
+			slog.Error("refused to sign with inactive key", "kid", kid, "error", err)
+			return nil, err
+		}
 	}
 
-	// PKCS#8 形式の秘密鍵をパース
-	parsedKeyInterface, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	signer, keyAlg, err := i.backend().Signer(privateKeyPath)
 	if err != nil {
-		slog.Error("failed to parse PKCS#8 private key from PEM block", "error", err, "pem_block_bytes_length", len(block.Bytes))
-		return err
+		return nil, err
 	}
 
-	// パースされた鍵が *ed25519.PrivateKey かどうかを型アサーションで確認
-	privateKey, ok := parsedKeyInterface.(ed25519.PrivateKey)
-	if !ok {
-		// ed25519 以外の鍵の場合
-		keyType := fmt.Sprintf("%T", parsedKeyInterface)
-		slog.Error("parsed key is not an Ed25519 private key", "actual_type", keyType, "err", err)
-		return err
+	alg := i.Algorithm
+	if alg == "" {
+		alg = keyAlg
+	}
+	method, err := SigningMethodForKey(signer.Public(), alg)
+	if err != nil {
+		slog.Error("failed to determine signing method", "key_type", fmt.Sprintf("%T", signer.Public()), "alg", alg, "error", err)
+		return nil, err
 	}
 
-	claims := jwt.MapClaims{
-		"iss": "jwks_demo_issuer",
-		"sub": "jwks_demo_subject",
-		"exp": time.Now().Add(time.Second * 1 * tokenExpirationTime).Unix(),
+	if kid == "" {
+		slog.Warn("kid is empty. 'kid' header will not be set")
 	}
+	return &Signer{signer: signer, method: method, kid: kid}, nil
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+// Sign は任意のクレームに署名し、compact 形式のトークンと JOSE ヘッダーを返す
+// header の扱いは Issuer.Sign と同じ
+func (s *Signer) Sign(header map[string]any, claims jwt.Claims) (string, map[string]any, error) {
+	token := jwt.NewWithClaims(s.method, claims)
 
 	// ヘッダーに Key ID (kid) を設定
-	if kid != "" {
-		token.Header["kid"] = kid
-	} else {
-		slog.Warn("kid is empty. 'kid' header will not be set")
+	if s.kid != "" {
+		token.Header["kid"] = s.kid
+	}
+	for k, v := range header {
+		if k == "alg" {
+			continue
+		}
+		token.Header[k] = v
 	}
 
-	signedToken, err := token.SignedString(privateKey)
+	signingString, err := token.SigningString()
+	if err != nil {
+		slog.Error("failed to encode token", "error", err)
+		return "", nil, fmt.Errorf("failed to encode token: %w", err)
+	}
+	sig, err := signJWS(s.signer, s.method, []byte(signingString))
 	if err != nil {
 		slog.Error("failed to sign token", "error", err)
-		return fmt.Errorf("failed to sign token: %w", err)
+		return "", nil, fmt.Errorf("failed to sign token: %w", err)
 	}
 
-	slog.Info("successfully issued JWT", "kid", kid, "token", signedToken)
-	return nil
+	return signingString + "." + token.EncodeSegment(sig), token.Header, nil
+}
+
+// PublicKey は privateKeyPath の秘密鍵に対応する公開鍵を返す
+// 鍵ファイルから kid を決める (JWK Thumbprint など) ときに使う
+func (i *Issuer) PublicKey(privateKeyPath string) (crypto.PublicKey, error) {
+	signer, _, err := i.backend().Signer(privateKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	return signer.Public(), nil
 }
@@ -0,0 +1,155 @@
+package issue
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jwks_demo/internal/passphrase"
+	"github.com/jwks_demo/internal/pkcs8"
+)
+
+const minRSAKeyBits = 2048 // 受け付ける RSA 鍵の最小モジュラス長 (bit)
+
+// pemAlgHeader は PEM ヘッダーで署名アルゴリズムを指定するためのキー
+// 例: "Alg: PS256"
+const pemAlgHeader = "Alg"
+
+// ecdsaAlgByCurve は EC 曲線に対応する署名アルゴリズム
+var ecdsaAlgByCurve = map[elliptic.Curve]string{
+	elliptic.P256(): "ES256",
+	elliptic.P384(): "ES384",
+	elliptic.P521(): "ES512",
+}
+
+// ParsePrivateKeyPEM は PEM 形式の秘密鍵をパースし、秘密鍵と PEM ヘッダーの Alg (無い場合は空) を返す
+// 暗号化された PKCS#8 (ENCRYPTED PRIVATE KEY) の場合は pass から取得したパスフレーズで復号する
+func ParsePrivateKeyPEM(pemBytes []byte, pass passphrase.Source) (crypto.Signer, string, error) {
+	// PEMデータをデコード
+	block, rest := pem.Decode(pemBytes)
+	// openssl ecparam -genkey が出力する EC PARAMETERS ブロックは読み飛ばす
+	for block != nil && block.Type == "EC PARAMETERS" {
+		block, rest = pem.Decode(rest)
+	}
+	if block == nil {
+		slog.Error("failed to decode PEM block", "rest", string(rest))
+		return nil, "", fmt.Errorf("failed to decode PEM block containing private key")
+	}
+
+	var key crypto.PrivateKey
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		// PKCS#8 形式の秘密鍵をパース
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			slog.Error("failed to parse PKCS#8 private key from PEM block", "error", err, "pem_block_bytes_length", len(block.Bytes))
+			return nil, "", err
+		}
+	case pkcs8.PEMType:
+		// パスフレーズで暗号化された PKCS#8 形式の秘密鍵を復号
+		key, err = pkcs8.DecryptPEMBlock(block, pass)
+		if err != nil {
+			slog.Error("failed to decrypt encrypted PKCS#8 private key from PEM block", "error", err)
+			return nil, "", err
+		}
+	case "RSA PRIVATE KEY":
+		// PKCS#1 形式の RSA 秘密鍵をパース
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			slog.Error("failed to parse PKCS#1 private key from PEM block", "error", err, "pem_block_bytes_length", len(block.Bytes))
+			return nil, "", err
+		}
+	case "EC PRIVATE KEY":
+		// SEC1 形式の EC 秘密鍵をパース
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			slog.Error("failed to parse SEC1 private key from PEM block", "error", err, "pem_block_bytes_length", len(block.Bytes))
+			return nil, "", err
+		}
+	default:
+		slog.Error("unsupported key type", "type", block.Type)
+		return nil, "", fmt.Errorf("unsupported PEM block type: %q", block.Type)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, "", fmt.Errorf("unsupported private key type: %T", key)
+	}
+	return signer, block.Headers[pemAlgHeader], nil
+}
+
+// ErrUnsupportedSigningKey は署名・検証に使えない種類の公開鍵を表す
+var ErrUnsupportedSigningKey = errors.New("unsupported signing key")
+
+// ParsePublicKeyPEM は PEM 形式 (SPKI) の署名用の公開鍵をパースする
+// serve が JWKS で公開する鍵 (Ed25519, EC P-256/P-384/P-521, 2048 bit 以上の RSA) 以外は ErrUnsupportedSigningKey を返す
+func ParsePublicKeyPEM(pemBytes []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM block containing public key")
+	}
+	if block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("unexpected PEM block type: %q (expected \"PUBLIC KEY\")", block.Type)
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := SigningMethodForKey(pub, ""); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnsupportedSigningKey, err)
+	}
+	return pub, nil
+}
+
+// SigningMethodForKey は公開鍵の種類と alg の組み合わせを検証し、署名アルゴリズムを返す
+// alg が空の場合は鍵の種類に応じた既定のアルゴリズムを返す
+func SigningMethodForKey(pub crypto.PublicKey, alg string) (jwt.SigningMethod, error) {
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+		if alg == "" {
+			alg = jwt.SigningMethodEdDSA.Alg()
+		}
+		if alg != jwt.SigningMethodEdDSA.Alg() {
+			return nil, fmt.Errorf("algorithm %q cannot be used with an Ed25519 key", alg)
+		}
+		return jwt.SigningMethodEdDSA, nil
+
+	case *rsa.PublicKey:
+		if bits := k.N.BitLen(); bits < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA key size %d is smaller than the minimum %d bits", bits, minRSAKeyBits)
+		}
+		if alg == "" {
+			alg = jwt.SigningMethodRS256.Alg()
+		}
+		switch alg {
+		case "RS256", "RS384", "RS512", "PS256", "PS384", "PS512":
+			return jwt.GetSigningMethod(alg), nil
+		}
+		return nil, fmt.Errorf("algorithm %q cannot be used with an RSA key", alg)
+
+	case *ecdsa.PublicKey:
+		// ES* のアルゴリズムは曲線によって一意に決まる
+		curveAlg, ok := ecdsaAlgByCurve[k.Curve]
+		if !ok {
+			return nil, fmt.Errorf("unsupported EC curve: %s", k.Curve.Params().Name)
+		}
+		if alg == "" {
+			alg = curveAlg
+		}
+		if alg != curveAlg {
+			return nil, fmt.Errorf("algorithm %q cannot be used with a %s key (expected %q)", alg, k.Curve.Params().Name, curveAlg)
+		}
+		return jwt.GetSigningMethod(alg), nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type: %T", pub)
+}
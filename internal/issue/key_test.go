@@ -0,0 +1,191 @@
+package issue
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+
+	"github.com/jwks_demo/internal/passphrase"
+	"github.com/jwks_demo/internal/pkcs8"
+)
+
+func newRSAPem(t *testing.T, bits int, pkcs1 bool, headers map[string]string) []byte {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkcs1 {
+		return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Headers: headers, Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Headers: headers, Bytes: der})
+}
+
+func newECPem(t *testing.T, curve elliptic.Curve, sec1 bool) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sec1 {
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func TestIssuer_NewSigner(t *testing.T) {
+	rsaPKCS8 := newRSAPem(t, 2048, false, nil)
+	rsaPKCS1 := newRSAPem(t, 2048, true, nil)
+	rsaWithHeader := newRSAPem(t, 2048, true, map[string]string{pemAlgHeader: "PS384"})
+	rsaSmall := newRSAPem(t, 1024, false, nil)
+	ecP256 := newECPem(t, elliptic.P256(), false)
+	ecP384 := newECPem(t, elliptic.P384(), true)
+	ecP521 := newECPem(t, elliptic.P521(), true)
+	ecP224 := newECPem(t, elliptic.P224(), false)
+	// openssl ecparam -genkey の出力形式
+	ecWithParams := append([]byte("-----BEGIN EC PARAMETERS-----\nBggqhkjOPQMBBw==\n-----END EC PARAMETERS-----\n"), newECPem(t, elliptic.P256(), true)...)
+
+	tests := []struct {
+		name    string
+		pem     []byte
+		alg     string
+		wantAlg string
+		wantErr bool
+	}{
+		{name: "ed25519 default", pem: []byte(testPrivateKeyPem), wantAlg: "EdDSA"},
+		{name: "error ed25519 with RS256", pem: []byte(testPrivateKeyPem), alg: "RS256", wantErr: true},
+		{name: "rsa pkcs8 default", pem: rsaPKCS8, wantAlg: "RS256"},
+		{name: "rsa pkcs8 PS512", pem: rsaPKCS8, alg: "PS512", wantAlg: "PS512"},
+		{name: "rsa pkcs1 RS384", pem: rsaPKCS1, alg: "RS384", wantAlg: "RS384"},
+		{name: "rsa pem header", pem: rsaWithHeader, wantAlg: "PS384"},
+		{name: "rsa flag overrides pem header", pem: rsaWithHeader, alg: "RS512", wantAlg: "RS512"},
+		{name: "error rsa with EdDSA", pem: rsaPKCS8, alg: "EdDSA", wantErr: true},
+		{name: "error rsa too small", pem: rsaSmall, wantErr: true},
+		{name: "ec P-256 pkcs8", pem: ecP256, wantAlg: "ES256"},
+		{name: "ec P-384 sec1", pem: ecP384, wantAlg: "ES384"},
+		{name: "ec P-521 sec1", pem: ecP521, alg: "ES512", wantAlg: "ES512"},
+		{name: "ec with EC PARAMETERS", pem: ecWithParams, wantAlg: "ES256"},
+		{name: "error ec curve mismatch", pem: ecP256, alg: "ES384", wantErr: true},
+		{name: "error ec with RS256", pem: ecP384, alg: "RS256", wantErr: true},
+		{name: "error ec unsupported curve", pem: ecP224, wantErr: true},
+		{name: "error invalid pem", pem: []byte("invalid"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := NewIssuer(&MockFileOperator{Files: map[string][]byte{"key.pem": tt.pem}})
+			i.Algorithm = tt.alg
+			got, err := i.NewSigner("key.pem", "kid")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Issuer.NewSigner() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && got.method.Alg() != tt.wantAlg {
+				t.Errorf("Issuer.NewSigner() alg = %v, want %v", got.method.Alg(), tt.wantAlg)
+			}
+		})
+	}
+}
+
+func TestIssuer_NewSigner_encrypted(t *testing.T) {
+	block, _ := pem.Decode([]byte(testPrivateKeyPem))
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := pkcs8.EncryptPrivateKey(key, []byte("passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted := pem.EncodeToMemory(&pem.Block{Type: pkcs8.PEMType, Bytes: der})
+
+	source := func(s string) passphrase.Source {
+		return func() ([]byte, error) { return []byte(s), nil }
+	}
+
+	tests := []struct {
+		name    string
+		pass    passphrase.Source
+		wantErr bool
+	}{
+		{name: "correct passphrase", pass: source("passphrase")},
+		{name: "error wrong passphrase", pass: source("wrong"), wantErr: true},
+		{name: "error no passphrase source", wantErr: true},
+		{name: "error passphrase source fails", pass: func() ([]byte, error) { return nil, errors.New("no tty") }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := NewIssuer(&MockFileOperator{Files: map[string][]byte{"key.pem": encrypted}})
+			i.Passphrase = tt.pass
+			got, err := i.NewSigner("key.pem", "kid")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Issuer.NewSigner() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && got.method.Alg() != "EdDSA" {
+				t.Errorf("Issuer.NewSigner() alg = %v, want EdDSA", got.method.Alg())
+			}
+		})
+	}
+}
+
+func TestParsePublicKeyPEM(t *testing.T) {
+	publicPem := func(pub any) []byte {
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	}
+	edPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	smallKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+	p224Key, _ := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	x25519Key, _ := ecdh.X25519().GenerateKey(rand.Reader)
+
+	tests := []struct {
+		name            string
+		pem             []byte
+		wantErr         bool
+		wantUnsupported bool
+	}{
+		{name: "Ed25519", pem: publicPem(edPub)},
+		{name: "EC P-521", pem: publicPem(&ecKey.PublicKey)},
+		{name: "RSA", pem: publicPem(&rsaKey.PublicKey)},
+		{name: "error RSA smaller than 2048 bits", pem: publicPem(&smallKey.PublicKey), wantErr: true, wantUnsupported: true},
+		{name: "error EC P-224", pem: publicPem(&p224Key.PublicKey), wantErr: true, wantUnsupported: true},
+		{name: "error X25519", pem: publicPem(x25519Key.PublicKey()), wantErr: true, wantUnsupported: true},
+		{name: "error private key", pem: newECPem(t, elliptic.P256(), false), wantErr: true},
+		{name: "error not PEM", pem: []byte("not a key"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParsePublicKeyPEM(tt.pem)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePublicKeyPEM() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrUnsupportedSigningKey) != tt.wantUnsupported {
+				t.Errorf("ParsePublicKeyPEM() error = %v, want ErrUnsupportedSigningKey %v", err, tt.wantUnsupported)
+			}
+		})
+	}
+}
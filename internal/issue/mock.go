@@ -0,0 +1,107 @@
+package issue
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// MockFileOperator は FileOperator インターフェースのモック実装です。
+type MockFileOperator struct {
+	Files          map[string][]byte    // filePath -> 内容
+	ModTimes       map[string]time.Time // filePath -> 更新日時
+	ErrLoadTxtFile error
+}
+
+// LoadTxtFile は Files に登録された内容を返します。
+// ErrLoadTxtFile が設定されていればそのエラーを返します。
+func (m *MockFileOperator) LoadTxtFile(filePath string) ([]byte, error) {
+	if m.ErrLoadTxtFile != nil {
+		return nil, m.ErrLoadTxtFile
+	}
+	b, ok := m.Files[filePath]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return b, nil
+}
+
+// GetFileNames は Files に登録されたファイルのうち dirPath 直下のファイル名を返します。
+func (m *MockFileOperator) GetFileNames(dirPath string) ([]string, error) {
+	var names []string
+	for p := range m.Files {
+		if filepath.Dir(p) == filepath.Clean(dirPath) {
+			names = append(names, filepath.Base(p))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// ModTime は ModTimes に登録された更新日時を返します。
+func (m *MockFileOperator) ModTime(filePath string) (time.Time, error) {
+	if _, ok := m.Files[filePath]; !ok {
+		return time.Time{}, os.ErrNotExist
+	}
+	return m.ModTimes[filePath], nil
+}
+
+// MockHTTPClient は HTTPClient インターフェースのモック実装です。
+type MockHTTPClient struct {
+	StatusCode int
+	Body       string
+	Err        error
+}
+
+// Do は設定されたレスポンスを返します。
+func (m *MockHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	return &http.Response{
+		StatusCode: m.StatusCode,
+		Body:       io.NopCloser(bytes.NewBufferString(m.Body)),
+		Header:     make(http.Header),
+	}, nil
+}
+
+// MockKeyBackend は KeyBackend インターフェースのモック実装です。
+type MockKeyBackend struct {
+	Signers map[string]crypto.Signer // keyRef -> crypto.Signer
+	Alg     string                   // 鍵に設定された署名アルゴリズム
+
+	Calls int // Signer が呼ばれた回数
+}
+
+// Signer は Signers に登録された crypto.Signer と Alg を返します。
+func (m *MockKeyBackend) Signer(keyRef string) (crypto.Signer, string, error) {
+	m.Calls++
+	s, ok := m.Signers[keyRef]
+	if !ok {
+		return nil, "", os.ErrNotExist
+	}
+	return s, m.Alg, nil
+}
+
+// MockClaimsProvider は ClaimsProvider インターフェースのモック実装です。
+type MockClaimsProvider struct {
+	Result map[string]any // Claims が返すクレーム
+	Err    error
+
+	Requests []ProviderRequest // Claims に渡された値
+}
+
+// Claims は渡された値を記録し、Result または Err を返します。
+func (m *MockClaimsProvider) Claims(ctx context.Context, req ProviderRequest) (map[string]any, error) {
+	m.Requests = append(m.Requests, req)
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	return m.Result, nil
+}
@@ -0,0 +1,139 @@
+package issue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jwks_demo/internal/model"
+)
+
+// DefaultProviderTimeout は ExecProvider の Timeout が 0 の場合の実行時間の上限
+const DefaultProviderTimeout = 5 * time.Second
+
+// 外部クレームプロバイダーが返したクレームと既存のクレームが衝突した場合の扱い
+const (
+	ConflictError    = "error"    // 発行を中止する (既定)
+	ConflictOverride = "override" // プロバイダーの値で上書きする
+	ConflictKeep     = "keep"     // 既存の値を残す
+)
+
+// protectedProviderClaims は登録済みクレームに加えて、外部クレームプロバイダーが衝突の扱いに関わらず設定できないクレーム
+// トークンの結び付け (cnf)、失効 (status)、委任 (act)、クライアントと権限 (client_id, scope) を外部から変更させない
+var protectedProviderClaims = []string{"cnf", "status", "act", "client_id", "scope"}
+
+// ProviderRequest は外部クレームプロバイダーに渡す発行対象の情報
+type ProviderRequest struct {
+	Subject  string   `json:"sub"`
+	Audience []string `json:"aud"`
+}
+
+// ClaimsProvider は発行するトークンに追加するクレームを外部から取得する
+type ClaimsProvider interface {
+	Claims(ctx context.Context, req ProviderRequest) (map[string]any, error)
+}
+
+// ExecProvider は外部の実行ファイルからクレームを取得する ClaimsProvider
+// 標準入力に ProviderRequest の JSON を渡し、標準出力の JSON オブジェクトを追加のクレームとして受け取る
+// 終了コードが 0 以外の場合やタイムアウトした場合はエラーを返す
+type ExecProvider struct {
+	Path    string        // 実行ファイルのパス
+	Args    []string      // 実行ファイルに渡す引数
+	Timeout time.Duration // 実行時間の上限 (0 の場合は DefaultProviderTimeout)
+}
+
+// NewExecProvider は path の実行ファイルを args で実行する ExecProvider を返す
+func NewExecProvider(path string, args ...string) *ExecProvider {
+	return &ExecProvider{Path: path, Args: args, Timeout: DefaultProviderTimeout}
+}
+
+func (p *ExecProvider) Claims(ctx context.Context, req ProviderRequest) (map[string]any, error) {
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = DefaultProviderTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	in, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.Path, p.Args...)
+	cmd.Stdin = bytes.NewReader(in)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = time.Second // 子プロセスが出力を閉じない場合も待ち続けない
+
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("claims provider %s timed out after %s", p.Path, timeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("claims provider %s failed: %w: %s", p.Path, err, msg)
+		}
+		return nil, fmt.Errorf("claims provider %s failed: %w", p.Path, err)
+	}
+
+	claims := map[string]any{}
+	if err := json.Unmarshal(stdout.Bytes(), &claims); err != nil {
+		return nil, fmt.Errorf("claims provider %s returned invalid claims: %w", p.Path, err)
+	}
+	return claims, nil
+}
+
+// applyProvider は Provider から取得したクレームを ProviderConflict に従って claims にマージしたクレームを返す
+// プロバイダーのエラーや登録済みクレームの指定は発行を中止するためエラーとして返す
+func (i *Issuer) applyProvider(claims *model.CustomClaims) (*model.CustomClaims, error) {
+	provided, err := i.Provider.Claims(context.Background(), ProviderRequest{
+		Subject:  claims.Subject,
+		Audience: claims.Audience,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	policy := i.ProviderConflict
+	if policy == "" {
+		policy = ConflictError
+	}
+	if policy != ConflictError && policy != ConflictOverride && policy != ConflictKeep {
+		return nil, fmt.Errorf("unsupported claims conflict policy: %q (expected %q, %q or %q)", policy, ConflictError, ConflictOverride, ConflictKeep)
+	}
+
+	merged := *claims
+	merged.Extra = maps.Clone(claims.Extra)
+	if merged.Extra == nil {
+		merged.Extra = map[string]any{}
+	}
+	for k, v := range provided {
+		if model.IsReservedClaim(k) {
+			return nil, fmt.Errorf("claims provider must not set registered claim %q", k)
+		}
+		if slices.Contains(protectedProviderClaims, k) {
+			return nil, fmt.Errorf("claims provider must not set protected claim %q", k)
+		}
+		if _, ok := merged.Extra[k]; ok {
+			switch policy {
+			case ConflictError:
+				return nil, fmt.Errorf("claim %q from the claims provider conflicts with an existing claim", k)
+			case ConflictKeep:
+				slog.Info("keeping existing claim over the claims provider", "claim", k)
+				continue
+			}
+		}
+		merged.Extra[k] = v
+	}
+	slog.Info("merged claims from the claims provider", "sub", claims.Subject, "claims", len(provided))
+	return &merged, nil
+}
@@ -0,0 +1,169 @@
+package issue
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jwks_demo/internal/model"
+)
+
+// writeProviderScript は t.TempDir に実行可能なシェルスクリプトを作成する
+func writeProviderScript(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "provider.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExecProvider_Claims(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("/bin/sh is not available")
+	}
+
+	tests := []struct {
+		name    string
+		script  string
+		timeout time.Duration
+		want    map[string]any
+		wantErr bool
+	}{
+		{
+			name: "claims from stdin",
+			// 標準入力の JSON をそのまま request クレームとして返す
+			script: `printf '{"groups":["admins"],"request":%s}' "$(cat)"`,
+			want: map[string]any{
+				"groups":  []any{"admins"},
+				"request": map[string]any{"sub": "alice", "aud": []any{"api"}},
+			},
+		},
+		{name: "error exit status", script: `echo "directory unavailable" >&2; exit 3`, wantErr: true},
+		{name: "error invalid json", script: `echo "not json"`, wantErr: true},
+		{name: "error not an object", script: `echo '["admins"]'`, wantErr: true},
+		{name: "error timeout", script: `sleep 5`, timeout: 100 * time.Millisecond, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewExecProvider(writeProviderScript(t, tt.script))
+			if tt.timeout > 0 {
+				p.Timeout = tt.timeout
+			}
+			got, err := p.Claims(context.Background(), ProviderRequest{Subject: "alice", Audience: []string{"api"}})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ExecProvider.Claims() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ExecProvider.Claims() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIssuer_Issue_provider(t *testing.T) {
+	claims := &model.CustomClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "alice",
+			Audience:  jwt.ClaimStrings{"api"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+		Extra: map[string]any{"role": "user"},
+	}
+
+	tests := []struct {
+		name      string
+		provider  *MockClaimsProvider
+		conflict  string
+		wantExtra map[string]any
+		wantErr   bool
+	}{
+		{
+			name:      "merge claims",
+			provider:  &MockClaimsProvider{Result: map[string]any{"groups": []any{"admins"}}},
+			wantExtra: map[string]any{"role": "user", "groups": []any{"admins"}},
+		},
+		{
+			name:      "conflict override",
+			provider:  &MockClaimsProvider{Result: map[string]any{"role": "admin"}},
+			conflict:  ConflictOverride,
+			wantExtra: map[string]any{"role": "admin"},
+		},
+		{
+			name:      "conflict keep",
+			provider:  &MockClaimsProvider{Result: map[string]any{"role": "admin", "groups": []any{"admins"}}},
+			conflict:  ConflictKeep,
+			wantExtra: map[string]any{"role": "user", "groups": []any{"admins"}},
+		},
+		{
+			name:     "error conflict",
+			provider: &MockClaimsProvider{Result: map[string]any{"role": "admin"}},
+			wantErr:  true,
+		},
+		{
+			name:     "error unknown conflict policy",
+			provider: &MockClaimsProvider{Result: map[string]any{"groups": []any{"admins"}}},
+			conflict: "merge",
+			wantErr:  true,
+		},
+		{
+			name:     "error registered claim",
+			provider: &MockClaimsProvider{Result: map[string]any{"sub": "mallory"}},
+			conflict: ConflictOverride,
+			wantErr:  true,
+		},
+		{
+			name:     "error protected claim with override",
+			provider: &MockClaimsProvider{Result: map[string]any{"scope": "admin"}},
+			conflict: ConflictOverride,
+			wantErr:  true,
+		},
+		{
+			name:     "error protected claim with keep",
+			provider: &MockClaimsProvider{Result: map[string]any{"cnf": map[string]any{"jkt": "attacker"}}},
+			conflict: ConflictKeep,
+			wantErr:  true,
+		},
+		{
+			name:     "error protected claim not in existing claims",
+			provider: &MockClaimsProvider{Result: map[string]any{"act": map[string]any{"sub": "mallory"}}},
+			wantErr:  true,
+		},
+		{
+			name:     "error provider fails",
+			provider: &MockClaimsProvider{Err: errors.New("directory unavailable")},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := NewIssuer(&MockFileOperator{Files: map[string][]byte{"private.pem": []byte(testPrivateKeyPem)}})
+			i.Provider = tt.provider
+			i.ProviderConflict = tt.conflict
+
+			got, err := i.Issue("private.pem", "key-001", claims)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Issuer.Issue() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if req := tt.provider.Requests[0]; req.Subject != "alice" || !reflect.DeepEqual(req.Audience, []string{"api"}) {
+				t.Errorf("Issuer.Issue() provider request = %+v", req)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got.Claims.Extra, tt.wantExtra) {
+				t.Errorf("Issuer.Issue() extra = %v, want %v", got.Claims.Extra, tt.wantExtra)
+			}
+			if !reflect.DeepEqual(claims.Extra, map[string]any{"role": "user"}) {
+				t.Errorf("Issuer.Issue() modified the input claims: %v", claims.Extra)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package issue
+
+import (
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/jwks_demo/internal/jwk"
+	"github.com/jwks_demo/internal/model"
+)
+
+// DirFileOperator は鍵ディレクトリを読むための FileOperator
+type DirFileOperator interface {
+	FileOperator
+	GetFileNames(dirPath string) ([]string, error)
+	ModTime(filePath string) (time.Time, error)
+}
+
+// HTTPClient は JWKS の取得に使う HTTP クライアント
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// PublishedKeys は公開されている検証用の公開鍵 (kid -> JWK Thumbprint)
+type PublishedKeys map[string]string
+
+// LoadPublishedKeyDir は公開鍵ディレクトリ (serve が JWKS で公開するディレクトリ) の鍵のうち、serve が公開する鍵を読み込む
+// kid は serve と同じ規則 (resolver) で決める
+func LoadPublishedKeyDir(f DirFileOperator, dir string, resolver *jwk.KidResolver) (PublishedKeys, error) {
+	names, err := f.GetFileNames(dir)
+	if err != nil {
+		slog.Error("failed to get public key file names", "dir", dir, "error", err)
+		return nil, err
+	}
+
+	published := make(PublishedKeys)
+	files := make(map[string]string) // kid -> 鍵のファイル名
+	for _, name := range names {
+		b, err := f.LoadTxtFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		// serve と同じ規則で読み、serve が JWKS で公開しない鍵は公開済みとしない
+		pub, err := ParsePublicKeyPEM(b)
+		if err != nil {
+			slog.Warn("skipping public key file that serve does not publish", "file_name", name, "error", err)
+			continue
+		}
+		kid, err := resolver.Kid(name, pub)
+		if err != nil {
+			return nil, err
+		}
+		// serve は同じ kid の鍵が複数あると (同じ鍵であっても) 起動しないため、公開済みとしない
+		if dup, ok := files[kid]; ok {
+			slog.Error("duplicate kid in public key directory", "kid", kid, "file_name", name, "other_file_name", dup)
+			return nil, fmt.Errorf("kid %s of %s is already used by %s", kid, name, dup)
+		}
+		files[kid] = name
+		if err := published.add(kid, pub); err != nil {
+			return nil, err
+		}
+	}
+	return published, nil
+}
+
+// FetchPublishedKeys は JWKS URL から署名用の公開鍵を取得する
+func FetchPublishedKeys(client HTTPClient, jwksURL string) (PublishedKeys, error) {
+	req, err := http.NewRequest(http.MethodGet, jwksURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, res.Body)
+		return nil, fmt.Errorf("failed to fetch JWKS: status code %d", res.StatusCode)
+	}
+
+	var jwks model.Response
+	if err := json.NewDecoder(res.Body).Decode(&jwks); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS: %w", err)
+	}
+
+	published := make(PublishedKeys)
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := jwk.PublicKey(k)
+		if err == nil {
+			// verify が信頼しない鍵 (署名に使えない鍵や alg が鍵の種類と合わない鍵) は公開済みとしない
+			_, err = SigningMethodForKey(pub, k.Alg)
+		}
+		if err != nil {
+			slog.Warn("skipping unsupported key in JWKS", "kid", k.Kid, "error", err)
+			continue
+		}
+		if err := published.add(k.Kid, pub); err != nil {
+			return nil, err
+		}
+	}
+	return published, nil
+}
+
+func (p PublishedKeys) add(kid string, pub crypto.PublicKey) error {
+	thumbprint, err := jwk.Thumbprint(pub)
+	if err != nil {
+		return err
+	}
+	if existing, ok := p[kid]; ok && existing != thumbprint {
+		return fmt.Errorf("kid %s is published with multiple different keys", kid)
+	}
+	p[kid] = thumbprint
+	return nil
+}
+
+// Check は kid が公開されており、その公開鍵が pub と一致するかを確認する
+func (p PublishedKeys) Check(kid string, pub crypto.PublicKey) error {
+	published, ok := p[kid]
+	if !ok {
+		return fmt.Errorf("kid %s is not published", kid)
+	}
+	thumbprint, err := jwk.Thumbprint(pub)
+	if err != nil {
+		return err
+	}
+	if thumbprint != published {
+		return fmt.Errorf("public key published for kid %s does not match the private key", kid)
+	}
+	return nil
+}
+
+// SelectActiveKey は秘密鍵ディレクトリの鍵のうち、公開鍵が公開されている最も新しい鍵を選ぶ
+// Lifecycle が設定されている場合は active の鍵から選ぶ
+// 鍵ファイルのパスと kid を返す。読めない鍵や公開されていない鍵は読み飛ばす
+func (i *Issuer) SelectActiveKey(f DirFileOperator, dir string, resolver *jwk.KidResolver, published PublishedKeys) (string, string, error) {
+	names, err := f.GetFileNames(dir)
+	if err != nil {
+		slog.Error("failed to get private key file names", "dir", dir, "error", err)
+		return "", "", err
+	}
+	// 更新日時が同じ場合に結果が変わらないようファイル名順に並べておく
+	sort.Strings(names)
+
+	var (
+		selectedPath, selectedKid string
+		selectedTime              time.Time
+	)
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		pub, err := i.PublicKey(path)
+		if err != nil {
+			slog.Warn("skipping unusable private key", "file_name", name, "error", err)
+			continue
+		}
+		kid, err := resolver.Kid(name, pub)
+		if err != nil {
+			slog.Warn("skipping private key without kid", "file_name", name, "error", err)
+			continue
+		}
+		if err := published.Check(kid, pub); err != nil {
+			slog.Info("skipping private key that is not published", "file_name", name, "kid", kid, "reason", err)
+			continue
+		}
+		if i.Lifecycle != nil {
+			if err := i.Lifecycle.CheckSigning(kid, i.now()); err != nil {
+				slog.Info("skipping private key that is not active", "file_name", name, "kid", kid, "reason", err)
+				continue
+			}
+		}
+		modTime, err := f.ModTime(path)
+		if err != nil {
+			return "", "", err
+		}
+		if selectedPath == "" || modTime.After(selectedTime) {
+			selectedPath, selectedKid, selectedTime = path, kid, modTime
+		}
+	}
+
+	if selectedPath == "" {
+		return "", "", fmt.Errorf("no private key in %s has a published public key", dir)
+	}
+	slog.Info("selected active signing key", "path", selectedPath, "kid", selectedKid)
+	return selectedPath, selectedKid, nil
+}
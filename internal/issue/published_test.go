@@ -0,0 +1,260 @@
+package issue
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jwks_demo/internal/jwk"
+	"github.com/jwks_demo/internal/lifecycle"
+	"github.com/jwks_demo/internal/model"
+)
+
+const testPublicKeyPem = `-----BEGIN PUBLIC KEY-----
+MCowBQYDK2VwAyEAwYDYgYnwhxMfR9hE7isN1rWHubXvEW1EJ/gYirMuxyY=
+-----END PUBLIC KEY-----
+`
+
+func newEd25519Pems(t *testing.T) (privPem, pubPem []byte) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privDer, _ := x509.MarshalPKCS8PrivateKey(priv)
+	pubDer, _ := x509.MarshalPKIXPublicKey(pub)
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDer}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDer})
+}
+
+func testPublicKey() ed25519.PublicKey {
+	b, _ := base64.RawURLEncoding.DecodeString("wYDYgYnwhxMfR9hE7isN1rWHubXvEW1EJ_gYirMuxyY")
+	return ed25519.PublicKey(b)
+}
+
+func TestPublishedKeys_Check(t *testing.T) {
+	publicPem := func(pub crypto.PublicKey) []byte {
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	}
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	weakKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+	x25519Key, _ := ecdh.X25519().GenerateKey(rand.Reader)
+
+	f := &MockFileOperator{Files: map[string][]byte{
+		"files/public/key-001.pem":    []byte(testPublicKeyPem),
+		"files/public/key-ec.pem":     publicPem(&ecKey.PublicKey),
+		"files/public/key-weak.pem":   publicPem(&weakKey.PublicKey),
+		"files/public/key-x25519.pem": publicPem(x25519Key.PublicKey()),
+		"files/public/readme.txt":     []byte("not a key"),
+	}}
+	published, err := LoadPublishedKeyDir(f, "files/public", &jwk.KidResolver{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, _, _ := ed25519.GenerateKey(rand.Reader)
+
+	tests := []struct {
+		name    string
+		kid     string
+		pub     crypto.PublicKey
+		wantErr bool
+	}{
+		{name: "published", kid: "key-001", pub: testPublicKey()},
+		{name: "published EC key", kid: "key-ec", pub: &ecKey.PublicKey},
+		// serve が JWKS で公開しない鍵は公開済みとしない
+		{name: "error RSA key serve does not publish", kid: "key-weak", pub: &weakKey.PublicKey, wantErr: true},
+		{name: "error X25519 key serve does not publish", kid: "key-x25519", pub: x25519Key.PublicKey(), wantErr: true},
+		{name: "error kid not published", kid: "key-002", pub: testPublicKey(), wantErr: true},
+		{name: "error public key mismatch", kid: "key-001", pub: otherPub, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := published.Check(tt.kid, tt.pub); (err != nil) != tt.wantErr {
+				t.Errorf("PublishedKeys.Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadPublishedKeyDir_duplicateKid(t *testing.T) {
+	// serve と同様に、同じ鍵であっても同じ kid のファイルが複数あれば拒否する
+	f := &MockFileOperator{Files: map[string][]byte{
+		"files/public/key-001.pem": []byte(testPublicKeyPem),
+		"files/public/key-001.pub": []byte(testPublicKeyPem),
+	}}
+	if _, err := LoadPublishedKeyDir(f, "files/public", &jwk.KidResolver{}); err == nil {
+		t.Error("LoadPublishedKeyDir() with duplicate kid succeeded")
+	}
+}
+
+func TestFetchPublishedKeys(t *testing.T) {
+	jwks, _ := json.Marshal(model.Response{Keys: []model.Key{
+		{Kty: "OKP", Crv: "Ed25519", Kid: "key-001", Use: "sig", Alg: "EdDSA", X: base64.RawURLEncoding.EncodeToString(testPublicKey())},
+		{Kty: "OKP", Crv: "X25519", Kid: "enc-001", Use: "enc", Alg: "ECDH-ES", X: base64.RawURLEncoding.EncodeToString(testPublicKey())},
+		{Kty: "EC", Crv: "P-256", Kid: "unsupported", Use: "sig"},
+		{Kty: "OKP", Crv: "Ed25519", Kid: "mismatch", Use: "sig", Alg: "RS256", X: base64.RawURLEncoding.EncodeToString(testPublicKey())},
+	}})
+
+	tests := []struct {
+		name     string
+		client   *MockHTTPClient
+		wantKids []string
+		wantErr  bool
+	}{
+		{name: "normal", client: &MockHTTPClient{StatusCode: http.StatusOK, Body: string(jwks)}, wantKids: []string{"key-001"}},
+		{name: "error status code", client: &MockHTTPClient{StatusCode: http.StatusInternalServerError}, wantErr: true},
+		{name: "error invalid body", client: &MockHTTPClient{StatusCode: http.StatusOK, Body: "invalid"}, wantErr: true},
+		{name: "error network", client: &MockHTTPClient{Err: errors.New("connection refused")}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FetchPublishedKeys(tt.client, "http://localhost:8080/.well-known/jwks.json")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("FetchPublishedKeys() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if len(got) != len(tt.wantKids) {
+				t.Errorf("FetchPublishedKeys() = %v, want kids %v", got, tt.wantKids)
+			}
+			for _, kid := range tt.wantKids {
+				if err := got.Check(kid, testPublicKey()); err != nil {
+					t.Errorf("FetchPublishedKeys() kid %s: %v", kid, err)
+				}
+			}
+		})
+	}
+}
+
+func TestIssuer_SelectActiveKey(t *testing.T) {
+	unpublishedPriv, _ := newEd25519Pems(t)
+	newerPriv, newerPub := newEd25519Pems(t)
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		files     map[string][]byte
+		modTimes  map[string]time.Time
+		lifecycle *lifecycle.Manifest
+		wantPath  string
+		wantKid   string
+		wantErr   bool
+	}{
+		{
+			name: "newest published key",
+			files: map[string][]byte{
+				"files/private/key-001.pem": []byte(testPrivateKeyPem),
+				"files/private/key-002.pem": newerPriv,
+				"files/public/key-001.pem":  []byte(testPublicKeyPem),
+				"files/public/key-002.pem":  newerPub,
+			},
+			modTimes: map[string]time.Time{
+				"files/private/key-001.pem": now.Add(-time.Hour),
+				"files/private/key-002.pem": now,
+			},
+			wantPath: "files/private/key-002.pem",
+			wantKid:  "key-002",
+		},
+		{
+			name: "skip newer key that is not published",
+			files: map[string][]byte{
+				"files/private/key-001.pem": []byte(testPrivateKeyPem),
+				"files/private/key-003.pem": unpublishedPriv,
+				"files/private/invalid.pem": []byte("invalid"),
+				"files/public/key-001.pem":  []byte(testPublicKeyPem),
+			},
+			modTimes: map[string]time.Time{
+				"files/private/key-001.pem": now.Add(-time.Hour),
+				"files/private/key-003.pem": now,
+				"files/private/invalid.pem": now,
+			},
+			wantPath: "files/private/key-001.pem",
+			wantKid:  "key-001",
+		},
+		{
+			name: "skip newer key that is not active",
+			files: map[string][]byte{
+				"files/private/key-001.pem": []byte(testPrivateKeyPem),
+				"files/private/key-002.pem": newerPriv,
+				"files/public/key-001.pem":  []byte(testPublicKeyPem),
+				"files/public/key-002.pem":  newerPub,
+			},
+			modTimes: map[string]time.Time{
+				"files/private/key-001.pem": now.Add(-time.Hour),
+				"files/private/key-002.pem": now,
+			},
+			lifecycle: &lifecycle.Manifest{Keys: map[string]*lifecycle.Metadata{
+				"key-001": {Status: lifecycle.StateActive},
+				"key-002": {Status: lifecycle.StatePending},
+			}},
+			wantPath: "files/private/key-001.pem",
+			wantKid:  "key-001",
+		},
+		{
+			name: "error newer key is not in manifest",
+			files: map[string][]byte{
+				"files/private/key-002.pem": newerPriv,
+				"files/public/key-002.pem":  newerPub,
+			},
+			lifecycle: &lifecycle.Manifest{Keys: map[string]*lifecycle.Metadata{
+				"key-001": {Status: lifecycle.StateActive},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "error no active key",
+			files: map[string][]byte{
+				"files/private/key-001.pem": []byte(testPrivateKeyPem),
+				"files/public/key-001.pem":  []byte(testPublicKeyPem),
+			},
+			lifecycle: &lifecycle.Manifest{Keys: map[string]*lifecycle.Metadata{
+				"key-001": {Status: lifecycle.StateRetiring},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "error no published key",
+			files: map[string][]byte{
+				"files/private/key-003.pem": unpublishedPriv,
+				"files/public/key-001.pem":  []byte(testPublicKeyPem),
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &MockFileOperator{Files: tt.files, ModTimes: tt.modTimes}
+			resolver := &jwk.KidResolver{}
+			published, err := LoadPublishedKeyDir(f, "files/public", resolver)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			i := NewIssuer(f)
+			i.Lifecycle = tt.lifecycle
+			path, kid, err := i.SelectActiveKey(f, "files/private", resolver, published)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Issuer.SelectActiveKey() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if path != tt.wantPath || kid != tt.wantKid {
+				t.Errorf("Issuer.SelectActiveKey() = %v, %v, want %v, %v", path, kid, tt.wantPath, tt.wantKid)
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package issue
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/jwks_demo/internal/model"
+)
+
+// ClaimsTemplate はトークンごとに値を生成するクレームのテンプレート
+// JSON オブジェクトのうち "{{" を含む文字列の値を Go の text/template として扱い、
+// 署名前のクレーム (.sub, .aud など) をデータとして描画する
+type ClaimsTemplate struct {
+	root map[string]any
+}
+
+// protectedTemplateClaims はクレームテンプレートで設定できないクレーム
+// トークンの結び付け (cnf)、失効 (status)、委任 (act) はテンプレートの描画後に設定する
+var protectedTemplateClaims = []string{"cnf", "status", "act"}
+
+// numericTemplateFuncs は数値を返すテンプレート関数
+// テンプレート全体がこれらの関数で終わる 1 つのパイプラインの場合のみ、描画結果を数値として扱う
+var numericTemplateFuncs = map[string]bool{"unix": true, "randInt": true, "number": true}
+
+// LoadClaimsTemplate は JSON 形式のクレームテンプレートファイルを読み込む
+func (i *Issuer) LoadClaimsTemplate(path string) (*ClaimsTemplate, error) {
+	b, err := i.FileOperator.LoadTxtFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseClaimsTemplate(b)
+}
+
+// ParseClaimsTemplate は JSON 形式のクレームテンプレートを読み込み、全てのテンプレートの構文を検証する
+func ParseClaimsTemplate(b []byte) (*ClaimsTemplate, error) {
+	root := map[string]any{}
+	if err := json.Unmarshal(b, &root); err != nil {
+		return nil, fmt.Errorf("failed to parse claims template: %w", err)
+	}
+	for _, name := range protectedTemplateClaims {
+		if _, ok := root[name]; ok {
+			return nil, fmt.Errorf("claims template must not set protected claim %q", name)
+		}
+	}
+	t := &ClaimsTemplate{root: root}
+	if _, err := t.render(root, "", nil, time.Now()); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Render は claims をデータとしてテンプレートを描画し、描画した値で claims を上書きしたクレームを返す
+// now は now 関数が返す時刻。描画した値は文字列として扱い、テンプレート全体が
+// 数値を返す関数 (unix, randInt, number) で終わる 1 つのパイプラインの場合のみ数値として扱う
+// (iss, sub, aud, jti は常に文字列のまま扱う)
+func (t *ClaimsTemplate) Render(claims *model.CustomClaims, now time.Time) (*model.CustomClaims, error) {
+	b, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+	data := map[string]any{}
+	if err := json.Unmarshal(b, &data); err != nil {
+		return nil, err
+	}
+
+	rendered, err := t.render(t.root, "", data, now)
+	if err != nil {
+		return nil, err
+	}
+	merged := map[string]any{}
+	for k, v := range data {
+		merged[k] = v
+	}
+	for k, v := range rendered.(map[string]any) {
+		merged[k] = v
+	}
+
+	if b, err = json.Marshal(merged); err != nil {
+		return nil, err
+	}
+	c := &model.CustomClaims{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("invalid rendered claims: %w", err)
+	}
+	c.TemplateRendered = true
+	return c, nil
+}
+
+// render は v を再帰的に描画する。data が nil の場合は構文の検証のみ行う
+// path はエラーメッセージに含めるクレームの位置 (email, address.city, groups[0] など)
+func (t *ClaimsTemplate) render(v any, path string, data map[string]any, now time.Time) (any, error) {
+	switch v := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys) // エラーになるクレームを毎回同じにする
+		out := make(map[string]any, len(v))
+		for _, k := range keys {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			r, err := t.render(v[k], p, data, now)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = r
+		}
+		return out, nil
+	case []any:
+		out := make([]any, len(v))
+		for n, e := range v {
+			r, err := t.render(e, fmt.Sprintf("%s[%d]", path, n), data, now)
+			if err != nil {
+				return nil, err
+			}
+			out[n] = r
+		}
+		return out, nil
+	case string:
+		if !strings.Contains(v, "{{") {
+			return v, nil
+		}
+		tmpl, err := template.New(path).Option("missingkey=error").Funcs(templateFuncs(now)).Parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("claim %q: invalid template: %w", path, err)
+		}
+		if data == nil {
+			return v, nil
+		}
+		var sb strings.Builder
+		if err := tmpl.Execute(&sb, data); err != nil {
+			return nil, fmt.Errorf("claim %q: failed to render template: %w", path, err)
+		}
+		if stringClaims[path] || !isNumericTemplate(tmpl) {
+			return sb.String(), nil
+		}
+		var value float64
+		if err := json.Unmarshal([]byte(sb.String()), &value); err != nil {
+			return nil, fmt.Errorf("claim %q: rendered value is not a number: %q", path, sb.String())
+		}
+		return value, nil
+	}
+	return v, nil
+}
+
+// isNumericTemplate は tmpl 全体が数値を返す関数で終わる 1 つのパイプラインかどうかを返す
+func isNumericTemplate(tmpl *template.Template) bool {
+	nodes := tmpl.Tree.Root.Nodes
+	if len(nodes) != 1 {
+		return false
+	}
+	action, ok := nodes[0].(*parse.ActionNode)
+	if !ok || len(action.Pipe.Decl) > 0 {
+		return false
+	}
+	cmds := action.Pipe.Cmds
+	ident, ok := cmds[len(cmds)-1].Args[0].(*parse.IdentifierNode)
+	return ok && numericTemplateFuncs[ident.Ident]
+}
+
+// templateFuncs はクレームテンプレートで使える関数
+//
+//	uuid                  ランダムな UUID (version 4)
+//	now                   現在時刻 (time.Time)
+//	add "-5m" t           t に期間を加えた時刻 ({{ now | add "-5m" | unix }})
+//	unix t                t の UNIX 秒
+//	rfc3339 t             t の RFC3339 形式の文字列
+//	env "NAME"            環境変数の値 (未設定の場合はエラー)
+//	random n              n バイトのランダムな値の 16 進文字列
+//	randInt min max       min 以上 max 未満のランダムな整数
+//	number v              文字列や数値の v を数値として出力する ({{ env "LEVEL" | number }})
+func templateFuncs(now time.Time) template.FuncMap {
+	return template.FuncMap{
+		"uuid": newUUID,
+		"now":  func() time.Time { return now },
+		"add": func(d string, t time.Time) (time.Time, error) {
+			dur, err := time.ParseDuration(d)
+			if err != nil {
+				return time.Time{}, err
+			}
+			return t.Add(dur), nil
+		},
+		"unix":    func(t time.Time) int64 { return t.Unix() },
+		"rfc3339": func(t time.Time) string { return t.Format(time.RFC3339) },
+		"env": func(name string) (string, error) {
+			v, ok := os.LookupEnv(name)
+			if !ok {
+				return "", fmt.Errorf("environment variable %s is not set", name)
+			}
+			return v, nil
+		},
+		"random": func(n int) (string, error) {
+			if n <= 0 {
+				return "", fmt.Errorf("random: length must be positive: %d", n)
+			}
+			b := make([]byte, n)
+			if _, err := rand.Read(b); err != nil {
+				return "", err
+			}
+			return hex.EncodeToString(b), nil
+		},
+		"number": func(v any) (json.Number, error) {
+			n := json.Number(fmt.Sprint(v))
+			if _, err := n.Float64(); err != nil {
+				return "", fmt.Errorf("number: %q is not a number", v)
+			}
+			return n, nil
+		},
+		"randInt": func(min, max int64) (int64, error) {
+			if max <= min {
+				return 0, fmt.Errorf("randInt: max (%d) must be greater than min (%d)", max, min)
+			}
+			n, err := rand.Int(rand.Reader, big.NewInt(max-min))
+			if err != nil {
+				return 0, err
+			}
+			return min + n.Int64(), nil
+		},
+	}
+}
+
+// newUUID はランダムな UUID (RFC 9562 version 4) を生成する
+func newUUID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err) // crypto/rand は失敗しない
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	h := hex.EncodeToString(b)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
@@ -0,0 +1,218 @@
+package issue
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jwks_demo/internal/model"
+)
+
+func TestParseClaimsTemplate(t *testing.T) {
+	tests := []struct {
+		name      string
+		template  string
+		wantField string
+	}{
+		{name: "valid", template: `{"jti": "{{ uuid }}", "email": "{{ .sub }}@example.com", "role": "admin"}`},
+		{name: "error invalid json", template: `{"jti": `, wantField: "claims template"},
+		{name: "error unknown function", template: `{"jti": "{{ uuid }}", "email": "{{ mail .sub }}"}`, wantField: `"email"`},
+		{name: "error syntax in nested claim", template: `{"address": {"city": "{{ .city"}}`, wantField: `"address.city"`},
+		{name: "error syntax in array", template: `{"groups": ["a", "{{ if }}"]}`, wantField: `"groups[1]"`},
+		{name: "error protected claim", template: `{"cnf": {"jkt": "{{ .sub }}"}}`, wantField: `"cnf"`},
+		{name: "error protected status claim", template: `{"status": "revoked"}`, wantField: `"status"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseClaimsTemplate([]byte(tt.template))
+			if (err != nil) != (tt.wantField != "") {
+				t.Errorf("ParseClaimsTemplate() error = %v, wantErr %v", err, tt.wantField != "")
+				return
+			}
+			if err != nil && !strings.Contains(err.Error(), tt.wantField) {
+				t.Errorf("ParseClaimsTemplate() error = %v, want it to mention %s", err, tt.wantField)
+			}
+		})
+	}
+}
+
+func TestClaimsTemplate_Render(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	t.Setenv("JWKS_DEMO_TEST_TENANT", "tenant-a")
+	base := &model.CustomClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "alice",
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		},
+		Extra: map[string]any{"role": "user"},
+	}
+	uuidPattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	t.Run("dynamic values", func(t *testing.T) {
+		tmpl, err := ParseClaimsTemplate([]byte(`{
+			"jti": "{{ uuid }}",
+			"iat": "{{ now | add \"-5m\" | unix }}",
+			"email": "{{ .sub }}@example.com",
+			"tenant": {"id": "{{ env \"JWKS_DEMO_TEST_TENANT\" }}", "seed": "{{ random 4 }}"},
+			"level": "{{ randInt 1 2 }}",
+			"role": "admin"
+		}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := tmpl.Render(base, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !uuidPattern.MatchString(got.ID) {
+			t.Errorf("Render() jti = %q, want a UUID", got.ID)
+		}
+		if got.IssuedAt.Unix() != now.Add(-5*time.Minute).Unix() {
+			t.Errorf("Render() iat = %v, want %v", got.IssuedAt, now.Add(-5*time.Minute))
+		}
+		if got.Subject != "alice" || !got.ExpiresAt.Equal(base.ExpiresAt.Time) {
+			t.Errorf("Render() registered claims = %+v", got.RegisteredClaims)
+		}
+		tenant, _ := got.Extra["tenant"].(map[string]any)
+		if got.Extra["email"] != "alice@example.com" || got.Extra["level"] != float64(1) || got.Extra["role"] != "admin" ||
+			tenant["id"] != "tenant-a" || len(tenant["seed"].(string)) != 8 {
+			t.Errorf("Render() extra = %+v", got.Extra)
+		}
+		if base.Extra["role"] != "user" {
+			t.Errorf("Render() modified the input claims: %+v", base.Extra)
+		}
+	})
+
+	t.Run("registered string claims stay strings", func(t *testing.T) {
+		tmpl, _ := ParseClaimsTemplate([]byte(`{"sub": "{{ 1000 }}"}`))
+		got, err := tmpl.Render(base, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Subject != "1000" {
+			t.Errorf("Render() sub = %q, want %q", got.Subject, "1000")
+		}
+	})
+
+	t.Run("random value that is all digits stays a string", func(t *testing.T) {
+		// 1 バイトの 16 進文字列は約 4 割の確率で数字のみになる
+		tmpl, _ := ParseClaimsTemplate([]byte(`{"seed": "{{ random 1 }}"}`))
+		for range 64 {
+			got, err := tmpl.Render(base, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := got.Extra["seed"].(string); !ok {
+				t.Fatalf("Render() seed = %#v, want a string", got.Extra["seed"])
+			}
+		}
+	})
+
+	t.Run("string output keeps its type", func(t *testing.T) {
+		t.Setenv("JWKS_DEMO_TEST_CODE", "17880104")
+		t.Setenv("JWKS_DEMO_TEST_FLAG", "true")
+		t.Setenv("JWKS_DEMO_TEST_NONE", "null")
+		tmpl, err := ParseClaimsTemplate([]byte(`{
+			"code": "{{ env \"JWKS_DEMO_TEST_CODE\" }}",
+			"flag": "{{ env \"JWKS_DEMO_TEST_FLAG\" }}",
+			"none": "{{ env \"JWKS_DEMO_TEST_NONE\" }}",
+			"issued": "{{ now | unix }} seconds",
+			"level": "{{ env \"JWKS_DEMO_TEST_CODE\" | number }}"
+		}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := tmpl.Render(base, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]any{
+			"role":   "user",
+			"code":   "17880104",
+			"flag":   "true",
+			"none":   "null",
+			"issued": "1700000000 seconds",
+			"level":  float64(17880104),
+		}
+		if !reflect.DeepEqual(got.Extra, want) {
+			t.Errorf("Render() extra = %#v, want %#v", got.Extra, want)
+		}
+	})
+
+	errTests := []struct {
+		name      string
+		template  string
+		wantField string
+	}{
+		{name: "missing claim", template: `{"email": "{{ .mail }}@example.com"}`, wantField: `"email"`},
+		{name: "unset env", template: `{"tenant": {"id": "{{ env \"JWKS_DEMO_TEST_UNSET\" }}"}}`, wantField: `"tenant.id"`},
+		{name: "invalid duration", template: `{"iat": "{{ now | add \"soon\" | unix }}"}`, wantField: `"iat"`},
+		{name: "not a number", template: `{"level": "{{ .sub | number }}"}`, wantField: `"level"`},
+	}
+	for _, tt := range errTests {
+		t.Run("error "+tt.name, func(t *testing.T) {
+			tmpl, err := ParseClaimsTemplate([]byte(tt.template))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = tmpl.Render(base, now)
+			if err == nil || !strings.Contains(err.Error(), tt.wantField) {
+				t.Errorf("Render() error = %v, want it to mention %s", err, tt.wantField)
+			}
+		})
+	}
+}
+
+func TestIssuer_BuildClaims_template(t *testing.T) {
+	publicKeyBytes, _ := base64.RawURLEncoding.DecodeString("wYDYgYnwhxMfR9hE7isN1rWHubXvEW1EJ_gYirMuxyY")
+	tmpl, err := ParseClaimsTemplate([]byte(`{"jti": "{{ uuid }}", "email": "{{ .sub }}@example.com"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := NewIssuer(&MockFileOperator{Files: map[string][]byte{"private.pem": []byte(testPrivateKeyPem)}})
+	i.Template = tmpl
+	opts := ClaimsOptions{Subject: "bob"}
+
+	// トークンごとに描画されるため jti は毎回異なる
+	jtis := map[string]bool{}
+	for range 2 {
+		claims, err := i.BuildClaims(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if claims.Extra["email"] != "bob@example.com" || claims.ID == "" {
+			t.Errorf("Issuer.BuildClaims() claims = %+v", claims)
+		}
+
+		// Issue は描画済みのクレームをそのまま署名する (ステータスの割り当てなどに使った jti を変えない)
+		got, err := i.Issue("private.pem", "key-001", claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed := &model.CustomClaims{}
+		if _, err := jwt.ParseWithClaims(got.Token, parsed, func(token *jwt.Token) (interface{}, error) {
+			return ed25519.PublicKey(publicKeyBytes), nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if parsed.ID != claims.ID {
+			t.Errorf("Issuer.Issue() jti = %s, want %s", parsed.ID, claims.ID)
+		}
+		jtis[parsed.ID] = true
+	}
+	if len(jtis) != 2 {
+		t.Errorf("Issuer.BuildClaims() reused jti: %v", jtis)
+	}
+
+	// BuildClaims で描画していないクレームには署名しない
+	raw := &model.CustomClaims{RegisteredClaims: jwt.RegisteredClaims{Subject: "bob", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}}
+	if _, err := i.Issue("private.pem", "key-001", raw); err == nil {
+		t.Error("Issuer.Issue() with unrendered claims succeeded")
+	}
+}
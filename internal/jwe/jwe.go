@@ -0,0 +1,230 @@
+package jwe
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// 対応している鍵管理アルゴリズムとコンテンツ暗号化アルゴリズム (RFC 7518)
+const (
+	AlgECDHES     = "ECDH-ES"      // X25519 による直接鍵合意
+	AlgRSAOAEP256 = "RSA-OAEP-256" // RSA-OAEP (SHA-256) による鍵ラップ
+	EncA256GCM    = "A256GCM"
+)
+
+const (
+	cekSize       = 32 // A256GCM の鍵長 (byte)
+	minRSAKeyBits = 2048
+)
+
+// Header は JWE の JOSE ヘッダー
+type Header struct {
+	Alg string        `json:"alg"`
+	Enc string        `json:"enc"`
+	Kid string        `json:"kid,omitempty"`
+	Cty string        `json:"cty,omitempty"`
+	Epk *ephemeralKey `json:"epk,omitempty"`
+}
+
+// ephemeralKey は ECDH-ES の一時公開鍵 (JWK)
+type ephemeralKey struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+}
+
+// IsJWE は compact 形式のトークンが JWE (5 セグメント) かどうかを返す
+func IsJWE(token string) bool {
+	return strings.Count(token, ".") == 4
+}
+
+// Encrypt は payload を recipient の公開鍵宛ての compact 形式の JWE に暗号化する
+// cty には入れ子の JWT の場合 "JWT" を指定する
+func Encrypt(payload []byte, recipient crypto.PublicKey, kid, cty string) (string, error) {
+	header := Header{Enc: EncA256GCM, Kid: kid, Cty: cty}
+
+	var cek, encryptedKey []byte
+	switch pub := recipient.(type) {
+	case *ecdh.PublicKey:
+		if pub.Curve() != ecdh.X25519() {
+			return "", fmt.Errorf("unsupported ECDH curve for JWE")
+		}
+		ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+		if err != nil {
+			return "", err
+		}
+		z, err := ephemeral.ECDH(pub)
+		if err != nil {
+			return "", err
+		}
+		header.Alg = AlgECDHES
+		header.Epk = &ephemeralKey{Kty: "OKP", Crv: "X25519", X: base64.RawURLEncoding.EncodeToString(ephemeral.PublicKey().Bytes())}
+		// ECDH-ES の直接鍵合意では encrypted key は空になる
+		cek = concatKDF(z, EncA256GCM, cekSize)
+
+	case *rsa.PublicKey:
+		if bits := pub.N.BitLen(); bits < minRSAKeyBits {
+			return "", fmt.Errorf("RSA key size %d is smaller than the minimum %d bits", bits, minRSAKeyBits)
+		}
+		cek = make([]byte, cekSize)
+		if _, err := rand.Read(cek); err != nil {
+			return "", err
+		}
+		var err error
+		encryptedKey, err = rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, cek, nil)
+		if err != nil {
+			return "", err
+		}
+		header.Alg = AlgRSAOAEP256
+
+	default:
+		return "", fmt.Errorf("unsupported recipient key type: %T", recipient)
+	}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	protected := base64.RawURLEncoding.EncodeToString(headerJSON)
+
+	gcm, err := newGCM(cek)
+	if err != nil {
+		return "", err
+	}
+	iv := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+	// AAD は base64url エンコードした保護ヘッダー (RFC 7516 Section 5.1)
+	sealed := gcm.Seal(nil, iv, payload, []byte(protected))
+	ciphertext, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+
+	return strings.Join([]string{
+		protected,
+		base64.RawURLEncoding.EncodeToString(encryptedKey),
+		base64.RawURLEncoding.EncodeToString(iv),
+		base64.RawURLEncoding.EncodeToString(ciphertext),
+		base64.RawURLEncoding.EncodeToString(tag),
+	}, "."), nil
+}
+
+// Decrypt は compact 形式の JWE を秘密鍵で復号し、payload とヘッダーを返す
+func Decrypt(token string, key crypto.PrivateKey) ([]byte, *Header, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 {
+		return nil, nil, errors.New("JWE must have 5 segments")
+	}
+	segments := make([][]byte, 5)
+	for i, p := range parts {
+		b, err := base64.RawURLEncoding.DecodeString(p)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decode JWE segment %d: %w", i, err)
+		}
+		segments[i] = b
+	}
+	headerJSON, encryptedKey, iv, ciphertext, tag := segments[0], segments[1], segments[2], segments[3], segments[4]
+
+	header := &Header{}
+	if err := json.Unmarshal(headerJSON, header); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse JWE header: %w", err)
+	}
+	if header.Enc != EncA256GCM {
+		return nil, nil, fmt.Errorf("unsupported JWE enc: %q", header.Enc)
+	}
+
+	var cek []byte
+	switch header.Alg {
+	case AlgECDHES:
+		priv, ok := key.(*ecdh.PrivateKey)
+		if !ok || priv.Curve() != ecdh.X25519() {
+			return nil, nil, fmt.Errorf("JWE alg %s requires an X25519 private key", header.Alg)
+		}
+		if header.Epk == nil || header.Epk.Kty != "OKP" || header.Epk.Crv != "X25519" {
+			return nil, nil, errors.New("JWE epk header is missing or invalid")
+		}
+		epkBytes, err := base64.RawURLEncoding.DecodeString(header.Epk.X)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decode epk: %w", err)
+		}
+		epk, err := ecdh.X25519().NewPublicKey(epkBytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		z, err := priv.ECDH(epk)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(encryptedKey) != 0 {
+			return nil, nil, errors.New("JWE encrypted key must be empty for ECDH-ES")
+		}
+		cek = concatKDF(z, EncA256GCM, cekSize)
+
+	case AlgRSAOAEP256:
+		priv, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, nil, fmt.Errorf("JWE alg %s requires an RSA private key", header.Alg)
+		}
+		var err error
+		cek, err = rsa.DecryptOAEP(sha256.New(), nil, priv, encryptedKey, nil)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decrypt content encryption key: %w", err)
+		}
+
+	default:
+		return nil, nil, fmt.Errorf("unsupported JWE alg: %q", header.Alg)
+	}
+
+	gcm, err := newGCM(cek)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(iv) != gcm.NonceSize() {
+		return nil, nil, errors.New("invalid JWE initialization vector")
+	}
+	payload, err := gcm.Open(nil, iv, append(ciphertext, tag...), []byte(parts[0]))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decrypt JWE: %w", err)
+	}
+	return payload, header, nil
+}
+
+func newGCM(cek []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// concatKDF は ECDH-ES の共有鍵 z からコンテンツ暗号鍵を導出する (RFC 7518 Section 4.6.2)
+// PartyUInfo / PartyVInfo は空とする
+func concatKDF(z []byte, algID string, keySize int) []byte {
+	// OtherInfo = AlgorithmID || PartyUInfo || PartyVInfo || SuppPubInfo (各値は 32bit の長さを前置する)
+	var otherInfo []byte
+	otherInfo = binary.BigEndian.AppendUint32(otherInfo, uint32(len(algID)))
+	otherInfo = append(otherInfo, algID...)
+	otherInfo = binary.BigEndian.AppendUint32(otherInfo, 0) // PartyUInfo
+	otherInfo = binary.BigEndian.AppendUint32(otherInfo, 0) // PartyVInfo
+	otherInfo = binary.BigEndian.AppendUint32(otherInfo, uint32(keySize*8))
+
+	var key []byte
+	for counter := uint32(1); len(key) < keySize; counter++ {
+		h := sha256.New()
+		h.Write(binary.BigEndian.AppendUint32(nil, counter))
+		h.Write(z)
+		h.Write(otherInfo)
+		key = h.Sum(key)
+	}
+	return key[:keySize]
+}
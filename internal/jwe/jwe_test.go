@@ -0,0 +1,177 @@
+package jwe
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+)
+
+func newX25519Pems(t *testing.T) (privPem, pubPem []byte) {
+	t.Helper()
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encodePems(t, key, key.PublicKey())
+}
+
+func newRSAPems(t *testing.T, bits int) (privPem, pubPem []byte) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encodePems(t, key, &key.PublicKey)
+}
+
+func encodePems(t *testing.T, priv crypto.PrivateKey, pub crypto.PublicKey) ([]byte, []byte) {
+	t.Helper()
+	privDer, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubDer, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDer}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDer})
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	x25519Priv, x25519Pub := newX25519Pems(t)
+	rsaPriv, rsaPub := newRSAPems(t, 2048)
+	otherPriv, _ := newX25519Pems(t)
+
+	tests := []struct {
+		name    string
+		pubPem  []byte
+		privPem []byte
+		wantAlg string
+		tamper  bool
+		wantErr bool
+	}{
+		{
+			name:    "X25519",
+			pubPem:  x25519Pub,
+			privPem: x25519Priv,
+			wantAlg: AlgECDHES,
+		},
+		{
+			name:    "RSA",
+			pubPem:  rsaPub,
+			privPem: rsaPriv,
+			wantAlg: AlgRSAOAEP256,
+		},
+		{
+			name:    "error tampered ciphertext",
+			pubPem:  x25519Pub,
+			privPem: x25519Priv,
+			tamper:  true,
+			wantErr: true,
+		},
+		{
+			name:    "error wrong key",
+			pubPem:  x25519Pub,
+			privPem: otherPriv,
+			wantErr: true,
+		},
+		{
+			name:    "error key type does not match alg",
+			pubPem:  x25519Pub,
+			privPem: rsaPriv,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pub, err := ParsePublicKeyPEM(tt.pubPem)
+			if err != nil {
+				t.Fatal(err)
+			}
+			priv, err := ParsePrivateKeyPEM(tt.privPem, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			token, err := Encrypt([]byte("inner.jws.token"), pub, "enc-key", "JWT")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !IsJWE(token) {
+				t.Fatalf("Encrypt() = %s, want 5 segments", token)
+			}
+			if tt.tamper {
+				parts := strings.Split(token, ".")
+				b := []byte(parts[3])
+				b[0] ^= 'A' ^ 'B'
+				parts[3] = string(b)
+				token = strings.Join(parts, ".")
+			}
+
+			payload, header, err := Decrypt(token, priv)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Decrypt() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if string(payload) != "inner.jws.token" {
+				t.Errorf("Decrypt() payload = %s", payload)
+			}
+			if header.Alg != tt.wantAlg || header.Enc != EncA256GCM || header.Kid != "enc-key" || header.Cty != "JWT" {
+				t.Errorf("Decrypt() header = %+v", header)
+			}
+		})
+	}
+}
+
+func TestParsePublicKeyPEM(t *testing.T) {
+	_, smallRSA := newRSAPems(t, 1024)
+	_, x25519Pub := newX25519Pems(t)
+
+	tests := []struct {
+		name    string
+		pem     []byte
+		wantErr bool
+	}{
+		{name: "X25519", pem: x25519Pub},
+		{name: "error RSA key smaller than 2048 bits", pem: smallRSA, wantErr: true},
+		{name: "error not PEM", pem: []byte("invalid"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParsePublicKeyPEM(tt.pem); (err != nil) != tt.wantErr {
+				t.Errorf("ParsePublicKeyPEM() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPublicJWK(t *testing.T) {
+	_, x25519Pub := newX25519Pems(t)
+	_, rsaPub := newRSAPems(t, 2048)
+
+	for _, p := range [][]byte{x25519Pub, rsaPub} {
+		pub, err := ParsePublicKeyPEM(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := PublicJWK("enc-key", pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key.Use != "enc" || key.Kid != "enc-key" {
+			t.Errorf("PublicJWK() = %+v", key)
+		}
+		if key.Kty == "RSA" && (key.N == "" || key.E != "AQAB") {
+			t.Errorf("PublicJWK() = %+v", key)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package jwe
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+
+	"github.com/jwks_demo/internal/model"
+	"github.com/jwks_demo/internal/passphrase"
+	"github.com/jwks_demo/internal/pkcs8"
+)
+
+// ParsePublicKeyPEM は暗号化に使う受信者の公開鍵 (SPKI PEM) をパースする
+func ParsePublicKeyPEM(pemBytes []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM block containing public key")
+	}
+	if block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("unexpected PEM block type: %q (expected \"PUBLIC KEY\")", block.Type)
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkKeyType(pub); err != nil {
+		return nil, err
+	}
+	return pub, nil
+}
+
+// ParsePrivateKeyPEM は復号に使う秘密鍵 (PKCS#8 または PKCS#1 PEM) をパースする
+// 暗号化された PKCS#8 の場合は pass から取得したパスフレーズで復号する
+func ParsePrivateKeyPEM(pemBytes []byte, pass passphrase.Source) (crypto.PrivateKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM block containing private key")
+	}
+
+	var key crypto.PrivateKey
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case pkcs8.PEMType:
+		key, err = pkcs8.DecryptPEMBlock(block, pass)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type: %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := key.(type) {
+	case *ecdh.PrivateKey:
+		return k, checkKeyType(k.PublicKey())
+	case *rsa.PrivateKey:
+		return k, checkKeyType(&k.PublicKey)
+	}
+	return nil, fmt.Errorf("unsupported private key type for JWE: %T", key)
+}
+
+func checkKeyType(pub crypto.PublicKey) error {
+	switch k := pub.(type) {
+	case *ecdh.PublicKey:
+		if k.Curve() != ecdh.X25519() {
+			return fmt.Errorf("unsupported ECDH curve for JWE")
+		}
+		return nil
+	case *rsa.PublicKey:
+		if bits := k.N.BitLen(); bits < minRSAKeyBits {
+			return fmt.Errorf("RSA key size %d is smaller than the minimum %d bits", bits, minRSAKeyBits)
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported public key type for JWE: %T", pub)
+}
+
+// PublicJWK は暗号化用の公開鍵を JWKS で公開する形式 (use: "enc") に変換する
+func PublicJWK(kid string, pub crypto.PublicKey) (model.Key, error) {
+	switch k := pub.(type) {
+	case *ecdh.PublicKey:
+		if k.Curve() != ecdh.X25519() {
+			return model.Key{}, fmt.Errorf("unsupported ECDH curve for JWE")
+		}
+		return model.Key{
+			Kty: "OKP",
+			Crv: "X25519",
+			Kid: kid,
+			Use: "enc",
+			Alg: AlgECDHES,
+			X:   base64.RawURLEncoding.EncodeToString(k.Bytes()),
+		}, nil
+	case *rsa.PublicKey:
+		return model.Key{
+			Kty: "RSA",
+			Kid: kid,
+			Use: "enc",
+			Alg: AlgRSAOAEP256,
+			N:   base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+		}, nil
+	}
+	return model.Key{}, fmt.Errorf("unsupported public key type for JWE: %T", pub)
+}
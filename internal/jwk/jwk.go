@@ -0,0 +1,363 @@
+package jwk
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"path/filepath"
+	"strings"
+
+	"github.com/jwks_demo/internal/model"
+)
+
+// kid の決め方
+const (
+	KidModeFilename   = "filename"   // 拡張子なしのファイル名 (既定)
+	KidModeThumbprint = "thumbprint" // 公開鍵の JWK Thumbprint (RFC 7638)
+)
+
+// thumbprint の計算に使う必須メンバー (RFC 7638 Section 3.2)
+// フィールドは辞書順に並べ、空のメンバーは出力しない
+type thumbprintMembers struct {
+	Crv string `json:"crv,omitempty"`
+	E   string `json:"e,omitempty"`
+	Kty string `json:"kty"`
+	N   string `json:"n,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// Thumbprint は公開鍵の JWK Thumbprint (RFC 7638, SHA-256) を base64url で返す
+// Ed25519 / X25519 / ECDSA / RSA の公開鍵に対応する
+func Thumbprint(pub crypto.PublicKey) (string, error) {
+	var m thumbprintMembers
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+		m = thumbprintMembers{Crv: "Ed25519", Kty: "OKP", X: b64(k)}
+	case *ecdh.PublicKey:
+		if k.Curve() != ecdh.X25519() {
+			return "", fmt.Errorf("unsupported ECDH curve for thumbprint")
+		}
+		m = thumbprintMembers{Crv: "X25519", Kty: "OKP", X: b64(k.Bytes())}
+	case *ecdsa.PublicKey:
+		ecdhKey, err := k.ECDH()
+		if err != nil {
+			return "", err
+		}
+		// 非圧縮形式 (0x04 || X || Y) から曲線のサイズに揃えた座標を取り出す
+		point := ecdhKey.Bytes()[1:]
+		size := len(point) / 2
+		m = thumbprintMembers{Crv: k.Curve.Params().Name, Kty: "EC", X: b64(point[:size]), Y: b64(point[size:])}
+	case *rsa.PublicKey:
+		m = thumbprintMembers{E: b64(big.NewInt(int64(k.E)).Bytes()), Kty: "RSA", N: b64(k.N.Bytes())}
+	default:
+		return "", fmt.Errorf("unsupported public key type for thumbprint: %T", pub)
+	}
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return b64(sum[:]), nil
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+type FileOperator interface {
+	LoadTxtFile(filePath string) ([]byte, error)
+}
+
+// KidResolver は鍵ファイルと公開鍵から kid を決める
+// 発行側 (issue) と公開側 (serve) で同じ設定を使うことで、トークンの kid と JWKS の kid を一致させる
+type KidResolver struct {
+	Mode string // KidModeFilename または KidModeThumbprint (空の場合は KidModeFilename)
+
+	// kid の上書き (thumbprint または拡張子なしのファイル名 -> kid)
+	Overrides map[string]string
+}
+
+// NewKidResolver は mode と kid の上書きファイル (空の場合は上書きなし) から KidResolver を作る
+// 上書きファイルは {"<thumbprint またはファイル名>": "<kid>"} 形式の JSON
+func NewKidResolver(f FileOperator, mode, overridesPath string) (*KidResolver, error) {
+	switch mode {
+	case "", KidModeFilename, KidModeThumbprint:
+	default:
+		return nil, fmt.Errorf("unsupported kid mode: %q (expected %q or %q)", mode, KidModeFilename, KidModeThumbprint)
+	}
+
+	r := &KidResolver{Mode: mode}
+	if overridesPath == "" {
+		return r, nil
+	}
+	b, err := f.LoadTxtFile(overridesPath)
+	if err != nil {
+		slog.Error("failed to load kid override file", "path", overridesPath, "error", err)
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &r.Overrides); err != nil {
+		return nil, fmt.Errorf("failed to parse kid override file: %w", err)
+	}
+	return r, nil
+}
+
+// Kid は鍵ファイル fileName と公開鍵 pub に対応する kid を返す
+// 上書きは thumbprint、ファイル名の順に探し、無い場合は Mode に従って決める
+func (r *KidResolver) Kid(fileName string, pub crypto.PublicKey) (string, error) {
+	base := strings.TrimSuffix(filepath.Base(fileName), filepath.Ext(fileName))
+
+	// thumbprint は上書きの検索にも使うため、上書きがある場合は常に計算する
+	var thumbprint string
+	if r.Mode == KidModeThumbprint || len(r.Overrides) > 0 {
+		var err error
+		if thumbprint, err = Thumbprint(pub); err != nil {
+			return "", err
+		}
+	}
+
+	if kid, ok := r.Overrides[thumbprint]; ok && thumbprint != "" {
+		return kid, nil
+	}
+	if kid, ok := r.Overrides[base]; ok {
+		return kid, nil
+	}
+
+	if r.Mode == KidModeThumbprint {
+		return thumbprint, nil
+	}
+	if base == "" {
+		return "", fmt.Errorf("failed to derive kid from file name: %s", fileName)
+	}
+	return base, nil
+}
+
+// PublicKey は JWKS の鍵 (OKP Ed25519 / X25519, EC, RSA) を公開鍵に変換する
+func PublicKey(k model.Key) (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode x of kid %s: %w", k.Kid, err)
+		}
+		switch k.Crv {
+		case "Ed25519":
+			pub, err := ParseEd25519Key(k)
+			if err != nil {
+				return nil, fmt.Errorf("invalid Ed25519 public key of kid %s: %w", k.Kid, err)
+			}
+			return pub, nil
+		case "X25519":
+			return ecdh.X25519().NewPublicKey(x)
+		}
+		return nil, fmt.Errorf("unsupported OKP curve of kid %s: %q", k.Kid, k.Crv)
+
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode n of kid %s: %w", k.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode e of kid %s: %w", k.Kid, err)
+		}
+		if len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("invalid RSA public key of kid %s", k.Kid)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+
+	case "EC":
+		curve, ok := ecCurves[k.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported EC curve of kid %s: %q", k.Kid, k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode x of kid %s: %w", k.Kid, err)
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode y of kid %s: %w", k.Kid, err)
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		// 曲線上の点であることを確認する
+		if _, err := pub.ECDH(); err != nil {
+			return nil, fmt.Errorf("invalid EC public key of kid %s: %w", k.Kid, err)
+		}
+		return pub, nil
+	}
+	return nil, fmt.Errorf("unsupported key type of kid %s: %q", k.Kid, k.Kty)
+}
+
+// ecCurves は JWK の crv に対応する EC 曲線
+var ecCurves = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+	"P-521": elliptic.P521(),
+}
+
+// ParseEd25519Key は OKP (Ed25519) の JWK を公開鍵に変換する
+// JWKS の鍵と DPoP proof の jwk ヘッダーの両方で使う
+func ParseEd25519Key(k model.Key) (ed25519.PublicKey, error) {
+	if k.Kty != "OKP" || k.Crv != "Ed25519" {
+		return nil, fmt.Errorf("unsupported key type: kty %q, crv %q (expected OKP Ed25519)", k.Kty, k.Crv)
+	}
+
+	// x パラメータ (base64urlエンコードされた公開鍵) をデコード
+	publicKeyBytes, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode base64url public key 'x': %w", err)
+	}
+
+	// バイト数が Ed25519 公開鍵として正しいか確認
+	if len(publicKeyBytes) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("decoded public key has incorrect size for Ed25519: %d (expected %d)", len(publicKeyBytes), ed25519.PublicKeySize)
+	}
+
+	// デコードしたバイト列は ed25519.PublicKey 型として扱える
+	return ed25519.PublicKey(publicKeyBytes), nil
+}
+
+// PrivateKey は秘密鍵のパラメータを含む JWK (RFC 7518 Section 6)
+type PrivateKey struct {
+	model.Key
+	D  string `json:"d"`
+	P  string `json:"p,omitempty"`  // RSA の素因数
+	Q  string `json:"q,omitempty"`  // RSA の素因数
+	DP string `json:"dp,omitempty"` // RSA の d mod (p-1)
+	DQ string `json:"dq,omitempty"` // RSA の d mod (q-1)
+	QI string `json:"qi,omitempty"` // RSA の q^-1 mod p
+}
+
+// FromPublicKey は署名用の公開鍵 (Ed25519 / ECDSA / RSA) を JWKS で公開する形式 (use: "sig") に変換する
+func FromPublicKey(kid string, pub crypto.PublicKey, alg string) (model.Key, error) {
+	key := model.Key{Kid: kid, Use: "sig", Alg: alg}
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+		key.Kty, key.Crv, key.X = "OKP", "Ed25519", b64(k)
+	case *ecdsa.PublicKey:
+		ecdhKey, err := k.ECDH()
+		if err != nil {
+			return model.Key{}, err
+		}
+		// 非圧縮形式 (0x04 || X || Y) から曲線のサイズに揃えた座標を取り出す
+		point := ecdhKey.Bytes()[1:]
+		size := len(point) / 2
+		key.Kty, key.Crv, key.X, key.Y = "EC", k.Curve.Params().Name, b64(point[:size]), b64(point[size:])
+	case *rsa.PublicKey:
+		key.Kty, key.N, key.E = "RSA", b64(k.N.Bytes()), b64(big.NewInt(int64(k.E)).Bytes())
+	default:
+		return model.Key{}, fmt.Errorf("unsupported public key type for JWK: %T", pub)
+	}
+	return key, nil
+}
+
+// FromPrivateKey は署名用の秘密鍵 (Ed25519 / ECDSA / RSA) を秘密鍵のパラメータを含む JWK に変換する
+func FromPrivateKey(kid string, priv crypto.Signer, alg string) (*PrivateKey, error) {
+	pub, err := FromPublicKey(kid, priv.Public(), alg)
+	if err != nil {
+		return nil, err
+	}
+	key := &PrivateKey{Key: pub}
+	switch k := priv.(type) {
+	case ed25519.PrivateKey:
+		key.D = b64(k.Seed())
+	case *ecdsa.PrivateKey:
+		ecdhKey, err := k.ECDH()
+		if err != nil {
+			return nil, err
+		}
+		key.D = b64(ecdhKey.Bytes())
+	case *rsa.PrivateKey:
+		if len(k.Primes) != 2 {
+			return nil, fmt.Errorf("multi-prime RSA keys are not supported for JWK")
+		}
+		k.Precompute()
+		key.D = b64(k.D.Bytes())
+		key.P, key.Q = b64(k.Primes[0].Bytes()), b64(k.Primes[1].Bytes())
+		key.DP, key.DQ, key.QI = b64(k.Precomputed.Dp.Bytes()), b64(k.Precomputed.Dq.Bytes()), b64(k.Precomputed.Qinv.Bytes())
+	default:
+		return nil, fmt.Errorf("unsupported private key type for JWK: %T", priv)
+	}
+	return key, nil
+}
+
+// Signer は秘密鍵のパラメータを含む JWK (OKP Ed25519, EC, RSA) を秘密鍵に変換する
+// 公開鍵のパラメータと秘密鍵が対応しない場合はエラーを返す
+func (k *PrivateKey) Signer() (crypto.Signer, error) {
+	if k.D == "" {
+		return nil, fmt.Errorf("JWK of kid %s has no private key parameter d", k.Kid)
+	}
+	pub, err := PublicKey(k.Key)
+	if err != nil {
+		return nil, err
+	}
+	d, err := base64.RawURLEncoding.DecodeString(k.D)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode d of kid %s: %w", k.Kid, err)
+	}
+
+	var priv crypto.Signer
+	switch pub := pub.(type) {
+	case ed25519.PublicKey:
+		if len(d) != ed25519.SeedSize {
+			return nil, fmt.Errorf("invalid Ed25519 private key of kid %s", k.Kid)
+		}
+		priv = ed25519.NewKeyFromSeed(d)
+	case *ecdsa.PublicKey:
+		ecdhPub, err := pub.ECDH()
+		if err != nil {
+			return nil, err
+		}
+		// ecdsa.PrivateKey の Public は PublicKey をそのまま返すため、d から公開鍵を計算して確認する
+		ecdhPriv, err := ecdhPub.Curve().NewPrivateKey(d)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC private key of kid %s: %w", k.Kid, err)
+		}
+		if !ecdhPriv.PublicKey().Equal(ecdhPub) {
+			return nil, fmt.Errorf("private key of kid %s does not match its public key", k.Kid)
+		}
+		priv = &ecdsa.PrivateKey{PublicKey: *pub, D: new(big.Int).SetBytes(d)}
+	case *rsa.PublicKey:
+		// CRT のパラメータは素因数から計算し直すため、p と q だけを使う
+		p, err := base64.RawURLEncoding.DecodeString(k.P)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode p of kid %s: %w", k.Kid, err)
+		}
+		q, err := base64.RawURLEncoding.DecodeString(k.Q)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode q of kid %s: %w", k.Kid, err)
+		}
+		if len(p) == 0 || len(q) == 0 {
+			return nil, fmt.Errorf("RSA private key of kid %s has no prime factors p and q", k.Kid)
+		}
+		rsaKey := &rsa.PrivateKey{
+			PublicKey: *pub,
+			D:         new(big.Int).SetBytes(d),
+			Primes:    []*big.Int{new(big.Int).SetBytes(p), new(big.Int).SetBytes(q)},
+		}
+		if err := rsaKey.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid RSA private key of kid %s: %w", k.Kid, err)
+		}
+		rsaKey.Precompute()
+		priv = rsaKey
+	default:
+		return nil, fmt.Errorf("unsupported private key type of kid %s: %T", k.Kid, pub)
+	}
+
+	// d から計算した公開鍵が x (と y) と一致すること
+	if !priv.Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(pub) {
+		return nil, fmt.Errorf("private key of kid %s does not match its public key", k.Kid)
+	}
+	return priv, nil
+}
@@ -0,0 +1,304 @@
+package jwk
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/jwks_demo/internal/model"
+)
+
+func mustDecode(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestThumbprint(t *testing.T) {
+	// RFC 7638 Section 3.1 の例
+	rsaKey := &rsa.PublicKey{
+		N: new(big.Int).SetBytes(mustDecode(t, "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw")),
+		E: 65537,
+	}
+	// RFC 8037 Appendix A.3 の例
+	ed25519Key := ed25519.PublicKey(mustDecode(t, "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"))
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	tests := []struct {
+		name    string
+		pub     crypto.PublicKey
+		want    string
+		wantErr bool
+	}{
+		{name: "RSA (RFC 7638)", pub: rsaKey, want: "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"},
+		{name: "Ed25519 (RFC 8037)", pub: ed25519Key, want: "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k"},
+		{name: "EC P-256", pub: &ecKey.PublicKey},
+		{name: "error unsupported key", pub: "invalid", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Thumbprint(tt.pub)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Thumbprint() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.want != "" && got != tt.want {
+				t.Errorf("Thumbprint() = %v, want %v", got, tt.want)
+			}
+			if !tt.wantErr && len(got) != 43 {
+				t.Errorf("Thumbprint() = %v, want 43 characters", got)
+			}
+		})
+	}
+}
+
+func TestKidResolver_Kid(t *testing.T) {
+	pub := ed25519.PublicKey(mustDecode(t, "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"))
+	const thumbprint = "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k"
+
+	tests := []struct {
+		name      string
+		mode      string
+		overrides map[string]string
+		fileName  string
+		want      string
+		wantErr   bool
+	}{
+		{name: "filename", fileName: "files/public/key-001.pem", want: "key-001"},
+		{name: "thumbprint", mode: KidModeThumbprint, fileName: "files/public/key-001.pem", want: thumbprint},
+		{name: "override by thumbprint", overrides: map[string]string{thumbprint: "custom"}, fileName: "key-001.pem", want: "custom"},
+		{name: "override by file name", mode: KidModeThumbprint, overrides: map[string]string{"key-001": "custom"}, fileName: "files/private/key-001.pem", want: "custom"},
+		{name: "no matching override", mode: KidModeThumbprint, overrides: map[string]string{"other": "custom"}, fileName: "key-001.pem", want: thumbprint},
+		{name: "error hidden file name", fileName: "files/public/.pem", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &KidResolver{Mode: tt.mode, Overrides: tt.overrides}
+			got, err := r.Kid(tt.fileName, pub)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("KidResolver.Kid() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("KidResolver.Kid() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewKidResolver(t *testing.T) {
+	f := &MockFileOperator{Files: map[string][]byte{
+		"kids.json":    []byte(`{"key-001": "custom"}`),
+		"invalid.json": []byte(`invalid`),
+	}}
+
+	tests := []struct {
+		name    string
+		mode    string
+		path    string
+		wantErr bool
+	}{
+		{name: "default"},
+		{name: "thumbprint with overrides", mode: KidModeThumbprint, path: "kids.json"},
+		{name: "error unknown mode", mode: "random", wantErr: true},
+		{name: "error invalid override file", path: "invalid.json", wantErr: true},
+		{name: "error missing override file", path: "missing.json", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewKidResolver(f, tt.mode, tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewKidResolver() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPublicKey(t *testing.T) {
+	const x = "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	rsaJWK := model.Key{
+		Kty: "RSA",
+		Kid: "rsa",
+		N:   base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+		E:   "AQAB",
+	}
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecJWK, err := FromPublicKey("ec", &ecKey.PublicKey, "ES256")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		key     model.Key
+		want    crypto.PublicKey
+		wantErr bool
+	}{
+		{name: "Ed25519", key: model.Key{Kty: "OKP", Crv: "Ed25519", X: x}, want: ed25519.PublicKey(mustDecode(t, x))},
+		{name: "RSA", key: rsaJWK, want: &rsaKey.PublicKey},
+		{name: "X25519", key: model.Key{Kty: "OKP", Crv: "X25519", X: x}},
+		{name: "error Ed25519 wrong size", key: model.Key{Kty: "OKP", Crv: "Ed25519", X: "c2hvcnQ"}, wantErr: true},
+		{name: "error invalid base64", key: model.Key{Kty: "OKP", Crv: "Ed25519", X: "invalid-base64!"}, wantErr: true},
+		{name: "EC", key: ecJWK, want: &ecKey.PublicKey},
+		{name: "error EC not on curve", key: model.Key{Kty: "EC", Crv: "P-256", X: ecJWK.X, Y: ecJWK.X}, wantErr: true},
+		{name: "error EC unsupported curve", key: model.Key{Kty: "EC", Crv: "secp256k1", X: ecJWK.X, Y: ecJWK.Y}, wantErr: true},
+		{name: "error unsupported kty", key: model.Key{Kty: "oct"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PublicKey(tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("PublicKey() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.want != nil && !tt.want.(interface{ Equal(crypto.PublicKey) bool }).Equal(got) {
+				t.Errorf("PublicKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromPrivateKey(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	tests := []struct {
+		name    string
+		key     crypto.Signer
+		alg     string
+		wantKty string
+		wantCrv string
+		// JWK の秘密鍵のパラメータから秘密鍵を復元できること
+		check func(t *testing.T, got *PrivateKey)
+	}{
+		{
+			name: "Ed25519", key: edKey, alg: "EdDSA", wantKty: "OKP", wantCrv: "Ed25519",
+			check: func(t *testing.T, got *PrivateKey) {
+				if !ed25519.NewKeyFromSeed(mustDecode(t, got.D)).Equal(edKey) {
+					t.Error("d does not restore the private key")
+				}
+			},
+		},
+		{
+			name: "P-384", key: ecKey, alg: "ES384", wantKty: "EC", wantCrv: "P-384",
+			check: func(t *testing.T, got *PrivateKey) {
+				if len(mustDecode(t, got.X)) != 48 || len(mustDecode(t, got.Y)) != 48 || len(mustDecode(t, got.D)) != 48 {
+					t.Errorf("coordinates are not padded to the curve size: %+v", got)
+				}
+				if new(big.Int).SetBytes(mustDecode(t, got.D)).Cmp(ecKey.D) != 0 {
+					t.Error("d does not match the private key")
+				}
+			},
+		},
+		{
+			name: "RSA", key: rsaKey, alg: "RS256", wantKty: "RSA",
+			check: func(t *testing.T, got *PrivateKey) {
+				restored := &rsa.PrivateKey{
+					PublicKey: rsaKey.PublicKey,
+					D:         new(big.Int).SetBytes(mustDecode(t, got.D)),
+					Primes:    []*big.Int{new(big.Int).SetBytes(mustDecode(t, got.P)), new(big.Int).SetBytes(mustDecode(t, got.Q))},
+				}
+				if err := restored.Validate(); err != nil {
+					t.Errorf("restored RSA key is invalid: %v", err)
+				}
+				if got.DP == "" || got.DQ == "" || got.QI == "" {
+					t.Errorf("CRT parameters are missing: %+v", got)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FromPrivateKey("key-001", tt.key, tt.alg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Kid != "key-001" || got.Use != "sig" || got.Alg != tt.alg || got.Kty != tt.wantKty || got.Crv != tt.wantCrv {
+				t.Errorf("FromPrivateKey() = %+v", got.Key)
+			}
+
+			// 公開鍵のメンバーから計算した thumbprint が元の公開鍵と一致すること
+			b, _ := json.Marshal(thumbprintMembers{Crv: got.Crv, E: got.E, Kty: got.Kty, N: got.N, X: got.X, Y: got.Y})
+			sum := sha256.Sum256(b)
+			want, _ := Thumbprint(tt.key.Public())
+			if b64(sum[:]) != want {
+				t.Errorf("FromPrivateKey() public members do not match the public key")
+			}
+			tt.check(t, got)
+		})
+	}
+
+	x25519Key, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	if _, err := FromPublicKey("key-001", x25519Key.PublicKey(), "ECDH-ES"); err == nil {
+		t.Error("FromPublicKey() with an unsupported key succeeded")
+	}
+}
+
+func TestPrivateKey_Signer(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	_, otherEdKey, _ := ed25519.GenerateKey(rand.Reader)
+	otherECKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	mustJWK := func(key crypto.Signer, alg string) *PrivateKey {
+		k, err := FromPrivateKey("key-001", key, alg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+	// 別の鍵の d を組み合わせた JWK
+	mismatched := func(key, other crypto.Signer, alg string) *PrivateKey {
+		k := mustJWK(key, alg)
+		k.D = mustJWK(other, alg).D
+		return k
+	}
+	noPrimes := mustJWK(rsaKey, "RS256")
+	noPrimes.P, noPrimes.Q = "", ""
+	noD := mustJWK(edKey, "EdDSA")
+	noD.D = ""
+
+	tests := []struct {
+		name    string
+		key     *PrivateKey
+		want    crypto.Signer
+		wantErr bool
+	}{
+		{name: "Ed25519", key: mustJWK(edKey, "EdDSA"), want: edKey},
+		{name: "EC", key: mustJWK(ecKey, "ES256"), want: ecKey},
+		{name: "RSA", key: mustJWK(rsaKey, "RS256"), want: rsaKey},
+		{name: "error no d", key: noD, wantErr: true},
+		{name: "error Ed25519 mismatched d", key: mismatched(edKey, otherEdKey, "EdDSA"), wantErr: true},
+		{name: "error EC mismatched d", key: mismatched(ecKey, otherECKey, "ES256"), wantErr: true},
+		{name: "error RSA no primes", key: noPrimes, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.key.Signer()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PrivateKey.Signer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !tt.want.(interface{ Equal(crypto.PrivateKey) bool }).Equal(got) {
+				t.Errorf("PrivateKey.Signer() does not restore the private key")
+			}
+		})
+	}
+}
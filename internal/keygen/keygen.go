@@ -0,0 +1,218 @@
+package keygen
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jwks_demo/internal/jwk"
+	"github.com/jwks_demo/internal/model"
+)
+
+const (
+	defaultPrivateKeyDir = "files/private"
+	defaultPublicKeyDir  = "files/public"
+)
+
+// 生成できる鍵の種類
+const (
+	AlgEd25519 = "Ed25519"
+	AlgRSA2048 = "RSA-2048"
+	AlgRSA3072 = "RSA-3072"
+	AlgRSA4096 = "RSA-4096"
+	AlgP256    = "P-256"
+	AlgP384    = "P-384"
+	AlgP521    = "P-521"
+)
+
+// algorithm は鍵の生成方法とその鍵で署名する JWS のアルゴリズム
+// RSA 鍵は RS* と PS* のどちらでも署名できるため、serve が公開する JWK と同様にアルゴリズムを決めない
+type algorithm struct {
+	jwsAlg   string
+	generate func() (crypto.Signer, error)
+}
+
+var algorithms = map[string]algorithm{
+	AlgEd25519: {"EdDSA", func() (crypto.Signer, error) {
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		return priv, err
+	}},
+	AlgRSA2048: {"", rsaGenerator(2048)},
+	AlgRSA3072: {"", rsaGenerator(3072)},
+	AlgRSA4096: {"", rsaGenerator(4096)},
+	AlgP256:    {"ES256", ecdsaGenerator(elliptic.P256())},
+	AlgP384:    {"ES384", ecdsaGenerator(elliptic.P384())},
+	AlgP521:    {"ES512", ecdsaGenerator(elliptic.P521())},
+}
+
+func rsaGenerator(bits int) func() (crypto.Signer, error) {
+	return func() (crypto.Signer, error) {
+		return rsa.GenerateKey(rand.Reader, bits)
+	}
+}
+
+func ecdsaGenerator(curve elliptic.Curve) func() (crypto.Signer, error) {
+	return func() (crypto.Signer, error) {
+		return ecdsa.GenerateKey(curve, rand.Reader)
+	}
+}
+
+// Algorithms は生成できる鍵の種類を返す
+func Algorithms() []string {
+	return []string{AlgEd25519, AlgRSA2048, AlgRSA3072, AlgRSA4096, AlgP256, AlgP384, AlgP521}
+}
+
+// ErrKidExists は生成しようとした kid の鍵ファイルが既に存在することを表す
+var ErrKidExists = errors.New("key with the kid already exists")
+
+type FileOperator interface {
+	GetFileNames(dirPath string) ([]string, error)
+	WriteTxtFile(filePath string, data []byte, perm os.FileMode) error
+}
+
+// Generator は署名用の鍵ペアを生成して秘密鍵と公開鍵のディレクトリに書き込む
+// ファイル名は <kid>.pem とし、serve が拡張子なしのファイル名を kid として JWKS に公開できるようにする
+type Generator struct {
+	FileOperator  FileOperator
+	PrivateKeyDir string
+	PublicKeyDir  string
+	Algorithm     string // 生成する鍵の種類 (空の場合は AlgEd25519)
+	Force         bool   // true の場合は同じ kid の既存の鍵ファイルを上書きする
+}
+
+// KeyPair は生成した鍵ペア
+type KeyPair struct {
+	Kid        string
+	Algorithm  string        // 鍵で署名する JWS のアルゴリズム (EdDSA, ES256 など。RSA 鍵の場合は空)
+	PrivateKey crypto.Signer // 生成した秘密鍵
+
+	// PEM を書き込んだファイル (WritePEM を呼んだ場合のみ)
+	PrivateKeyPath string
+	PublicKeyPath  string
+}
+
+// PublicJWK は公開鍵を JWK (use: "sig") で返す
+func (p *KeyPair) PublicJWK() (model.Key, error) {
+	return jwk.FromPublicKey(p.Kid, p.PrivateKey.Public(), p.Algorithm)
+}
+
+// PrivateJWK は秘密鍵のパラメータを含む JWK を返す
+func (p *KeyPair) PrivateJWK() (*jwk.PrivateKey, error) {
+	return jwk.FromPrivateKey(p.Kid, p.PrivateKey, p.Algorithm)
+}
+
+func NewGenerator(f FileOperator) *Generator {
+	return &Generator{
+		FileOperator:  f,
+		PrivateKeyDir: defaultPrivateKeyDir,
+		PublicKeyDir:  defaultPublicKeyDir,
+		Algorithm:     AlgEd25519,
+	}
+}
+
+// NewKey は Algorithm の鍵ペアを生成する (ファイルには書き込まない)
+func (g *Generator) NewKey(kid string) (*KeyPair, error) {
+	if err := validateKid(kid); err != nil {
+		return nil, err
+	}
+	name := g.Algorithm
+	if name == "" {
+		name = AlgEd25519
+	}
+	a, ok := algorithms[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported key algorithm: %q (expected one of %s)", name, strings.Join(Algorithms(), ", "))
+	}
+	priv, err := a.generate()
+	if err != nil {
+		return nil, err
+	}
+	return &KeyPair{Kid: kid, Algorithm: a.jwsAlg, PrivateKey: priv}, nil
+}
+
+// Generate は Algorithm の鍵ペアを生成し、PEM で書き込む
+func (g *Generator) Generate(kid string) (*KeyPair, error) {
+	pair, err := g.NewKey(kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.WritePEM(pair); err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// WritePEM は PKCS#8 の秘密鍵 (0600) と SPKI の公開鍵 (0644) を <kid>.pem として書き込む
+// Force が false の場合は同じ kid の鍵ファイルがあればエラーを返す
+func (g *Generator) WritePEM(pair *KeyPair) error {
+	if !g.Force {
+		if err := g.checkKidUnused(pair.Kid); err != nil {
+			return err
+		}
+	}
+
+	privDer, err := x509.MarshalPKCS8PrivateKey(pair.PrivateKey)
+	if err != nil {
+		return err
+	}
+	pubDer, err := x509.MarshalPKIXPublicKey(pair.PrivateKey.Public())
+	if err != nil {
+		return err
+	}
+
+	privPath := filepath.Join(g.PrivateKeyDir, pair.Kid+".pem")
+	pubPath := filepath.Join(g.PublicKeyDir, pair.Kid+".pem")
+	// 公開鍵だけが公開されて秘密鍵が無い状態にならないよう、秘密鍵を先に書き込む
+	if err := g.FileOperator.WriteTxtFile(privPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDer}), 0600); err != nil {
+		return fmt.Errorf("failed to write private key: %w", err)
+	}
+	if err := g.FileOperator.WriteTxtFile(pubPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDer}), 0644); err != nil {
+		return fmt.Errorf("failed to write public key: %w", err)
+	}
+	pair.PrivateKeyPath, pair.PublicKeyPath = privPath, pubPath
+
+	slog.Info("generated key pair", "kid", pair.Kid, "alg", pair.Algorithm, "private_key", privPath, "public_key", pubPath)
+	return nil
+}
+
+// checkKidUnused は秘密鍵・公開鍵のディレクトリに kid と同じ名前 (拡張子なし) のファイルが無いことを確認する
+func (g *Generator) checkKidUnused(kid string) error {
+	for _, dir := range []string{g.PrivateKeyDir, g.PublicKeyDir} {
+		names, err := g.FileOperator.GetFileNames(dir)
+		if err != nil {
+			return fmt.Errorf("failed to list %s: %w", dir, err)
+		}
+		for _, name := range names {
+			if strings.TrimSuffix(name, filepath.Ext(name)) == kid {
+				return fmt.Errorf("%w: %s (use force to overwrite)", ErrKidExists, filepath.Join(dir, name))
+			}
+		}
+	}
+	return nil
+}
+
+// validateKid は kid がそのままファイル名として使えることを確認する
+func validateKid(kid string) error {
+	if kid == "" {
+		return errors.New("kid is required")
+	}
+	if strings.ContainsAny(kid, `/\`) || kid == ".." {
+		return fmt.Errorf("kid must not contain path separators: %q", kid)
+	}
+	// 隠しファイルは serve で kid を決められない
+	if strings.HasPrefix(kid, ".") {
+		return fmt.Errorf("kid must not start with \".\": %q", kid)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package keygen
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+)
+
+func TestGenerator_Generate(t *testing.T) {
+	existing := map[string][]byte{
+		"files/private/key-001.pem": []byte("private"),
+		"files/public/key-002.pem":  []byte("public"),
+	}
+
+	tests := []struct {
+		name      string
+		kid       string
+		force     bool
+		errWrite  error
+		wantErrIs error
+		wantErr   bool
+	}{
+		{name: "new kid", kid: "key-003"},
+		{name: "overwrite with force", kid: "key-001", force: true},
+		{name: "error private key exists", kid: "key-001", wantErrIs: ErrKidExists, wantErr: true},
+		{name: "error public key exists", kid: "key-002", wantErrIs: ErrKidExists, wantErr: true},
+		{name: "error empty kid", kid: "", wantErr: true},
+		{name: "error path separator", kid: "../key-003", wantErr: true},
+		{name: "error hidden file", kid: ".key", wantErr: true},
+		{name: "error write failed", kid: "key-003", errWrite: errors.New("permission denied"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := map[string][]byte{}
+			for k, v := range existing {
+				files[k] = v
+			}
+			f := &MockFileOperator{Files: files, ErrWrite: tt.errWrite}
+			g := NewGenerator(f)
+			g.Force = tt.force
+
+			got, err := g.Generate(tt.kid)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Generator.Generate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErrIs != nil && !errors.Is(err, tt.wantErrIs) {
+				t.Errorf("Generator.Generate() error = %v, want %v", err, tt.wantErrIs)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			wantPriv, wantPub := "files/private/"+tt.kid+".pem", "files/public/"+tt.kid+".pem"
+			if got.Kid != tt.kid || got.PrivateKeyPath != wantPriv || got.PublicKeyPath != wantPub {
+				t.Errorf("Generator.Generate() = %+v", got)
+			}
+			if f.Perms[wantPriv] != 0600 || f.Perms[wantPub] != 0644 {
+				t.Errorf("Generator.Generate() perms = %v", f.Perms)
+			}
+
+			// 書き込んだ秘密鍵と公開鍵が対応していること
+			privBlock, _ := pem.Decode(f.Files[wantPriv])
+			pubBlock, _ := pem.Decode(f.Files[wantPub])
+			if privBlock == nil || privBlock.Type != "PRIVATE KEY" || pubBlock == nil || pubBlock.Type != "PUBLIC KEY" {
+				t.Fatalf("Generator.Generate() wrote invalid PEM")
+			}
+			priv, err := x509.ParsePKCS8PrivateKey(privBlock.Bytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pub, err := x509.ParsePKIXPublicKey(pubBlock.Bytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !priv.(ed25519.PrivateKey).Public().(ed25519.PublicKey).Equal(pub) {
+				t.Errorf("Generator.Generate() public key does not match the private key")
+			}
+		})
+	}
+}
+
+func TestGenerator_Generate_algorithm(t *testing.T) {
+	tests := []struct {
+		name    string
+		alg     string
+		wantAlg string
+		wantKty string
+		wantErr bool
+	}{
+		{name: "default", alg: "", wantAlg: "EdDSA", wantKty: "OKP"},
+		{name: "Ed25519", alg: AlgEd25519, wantAlg: "EdDSA", wantKty: "OKP"},
+		{name: "RSA-2048", alg: AlgRSA2048, wantAlg: "", wantKty: "RSA"},
+		{name: "P-256", alg: AlgP256, wantAlg: "ES256", wantKty: "EC"},
+		{name: "P-384", alg: AlgP384, wantAlg: "ES384", wantKty: "EC"},
+		{name: "P-521", alg: AlgP521, wantAlg: "ES512", wantKty: "EC"},
+		{name: "error unsupported", alg: "P-192", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &MockFileOperator{Files: map[string][]byte{}}
+			g := NewGenerator(f)
+			g.Algorithm = tt.alg
+
+			got, err := g.Generate("key-001")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Generator.Generate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Algorithm != tt.wantAlg {
+				t.Errorf("Generator.Generate() Algorithm = %v, want %v", got.Algorithm, tt.wantAlg)
+			}
+
+			// 書き込んだ公開鍵が生成した鍵と一致すること
+			pubBlock, _ := pem.Decode(f.Files["files/public/key-001.pem"])
+			if pubBlock == nil {
+				t.Fatalf("Generator.Generate() wrote invalid PEM")
+			}
+			pub, err := x509.ParsePKIXPublicKey(pubBlock.Bytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !pub.(interface{ Equal(crypto.PublicKey) bool }).Equal(got.PrivateKey.Public()) {
+				t.Errorf("Generator.Generate() public key does not match the private key")
+			}
+
+			key, err := got.PublicJWK()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if key.Kty != tt.wantKty || key.Kid != "key-001" || key.Alg != tt.wantAlg || key.Use != "sig" {
+				t.Errorf("KeyPair.PublicJWK() = %+v", key)
+			}
+			priv, err := got.PrivateJWK()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if priv.D == "" || priv.Key != key {
+				t.Errorf("KeyPair.PrivateJWK() = %+v, want public members %+v", priv, key)
+			}
+		})
+	}
+}
+
+func TestGenerator_NewKey(t *testing.T) {
+	// NewKey はファイルを書き込まない
+	f := &MockFileOperator{Files: map[string][]byte{}}
+	got, err := NewGenerator(f).NewKey("key-001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Files) != 0 || got.PrivateKeyPath != "" || got.PublicKeyPath != "" {
+		t.Errorf("Generator.NewKey() wrote files: %v", f.Files)
+	}
+}
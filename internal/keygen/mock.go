@@ -0,0 +1,40 @@
+package keygen
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// MockFileOperator は FileOperator インターフェースのモック実装です。
+type MockFileOperator struct {
+	Files    map[string][]byte      // filePath -> 内容
+	Perms    map[string]os.FileMode // filePath -> 書き込み時のパーミッション
+	ErrWrite error
+}
+
+// GetFileNames は Files に登録されたファイルのうち dirPath 直下のファイル名を返します。
+func (m *MockFileOperator) GetFileNames(dirPath string) ([]string, error) {
+	var names []string
+	for p := range m.Files {
+		if filepath.Dir(p) == filepath.Clean(dirPath) {
+			names = append(names, filepath.Base(p))
+		}
+	}
+	return names, nil
+}
+
+// WriteTxtFile は内容とパーミッションを記録します。
+func (m *MockFileOperator) WriteTxtFile(filePath string, data []byte, perm os.FileMode) error {
+	if m.ErrWrite != nil {
+		return m.ErrWrite
+	}
+	if m.Files == nil {
+		m.Files = map[string][]byte{}
+	}
+	if m.Perms == nil {
+		m.Perms = map[string]os.FileMode{}
+	}
+	m.Files[filePath] = data
+	m.Perms[filePath] = perm
+	return nil
+}
@@ -0,0 +1,166 @@
+package lifecycle
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// 鍵の状態
+// 時刻による状態は pending -> active -> retiring -> retired の順に進み、revoked は手動でのみ設定する
+const (
+	StatePending  = "pending"  // 公開するが署名には使わない (有効化前に JWKS のキャッシュに載せる)
+	StateActive   = "active"   // 公開し、署名に使う
+	StateRetiring = "retiring" // 発行済みのトークンの検証のために公開するが、署名には使わない
+	StateRetired  = "retired"  // retire_at を過ぎた鍵。公開も署名もしない
+	StateRevoked  = "revoked"  // 失効させた鍵。公開も署名もしない
+	StateUnlisted = "unlisted" // マニフェストに無い鍵 (default_status が無い場合)。公開も署名もしない
+)
+
+// 状態の進み具合 (大きいほど後の状態)
+var stateRank = map[string]int{
+	StatePending:  1,
+	StateActive:   2,
+	StateRetiring: 3,
+	StateRetired:  4,
+	StateRevoked:  5,
+}
+
+// ErrNotActive は active でない鍵で署名しようとした場合のエラー
+var ErrNotActive = errors.New("signing key is not active")
+
+type FileOperator interface {
+	LoadTxtFile(filePath string) ([]byte, error)
+}
+
+// Metadata は鍵 1 つのライフサイクル
+// 時刻が指定されていない段階はその段階に進まない (activate_at が無い場合は作成時から active)
+type Metadata struct {
+	Created       *time.Time `json:"created,omitempty"`         // 鍵を作成した時刻 (記録のみ)
+	ActivateAt    *time.Time `json:"activate_at,omitempty"`     // 署名に使い始める時刻
+	StopSigningAt *time.Time `json:"stop_signing_at,omitempty"` // 署名に使うのをやめる時刻
+	RetireAt      *time.Time `json:"retire_at,omitempty"`       // JWKS から外す時刻
+
+	// 手動で設定した状態 (pending, active, retiring, revoked)
+	// 時刻による状態より前には戻らないため、鍵を前倒しで有効化・退役・失効させるときに使う
+	// (pending は activate_at が無い場合のみ有効化を止める)
+	Status string `json:"status,omitempty"`
+}
+
+// Manifest は kid ごとの鍵のライフサイクル
+// Manifest に無い鍵は DefaultStatus の状態、DefaultStatus が無い場合は unlisted (公開も署名もしない) として扱う
+type Manifest struct {
+	Keys map[string]*Metadata `json:"keys"`
+
+	// マニフェストに無い鍵の状態 (pending, active, retiring, revoked)
+	DefaultStatus string `json:"default_status,omitempty"`
+}
+
+// Load は JSON 形式のマニフェストファイルを読み込み、時刻の順序と状態を検証する
+func Load(f FileOperator, path string) (*Manifest, error) {
+	b, err := f.LoadTxtFile(path)
+	if err != nil {
+		slog.Error("failed to load key manifest", "path", path, "error", err)
+		return nil, err
+	}
+
+	m := &Manifest{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(m); err != nil {
+		return nil, fmt.Errorf("failed to parse key manifest %s: %w", path, err)
+	}
+	switch m.DefaultStatus {
+	case "", StatePending, StateActive, StateRetiring, StateRevoked:
+	default:
+		return nil, fmt.Errorf("key manifest %s: unsupported default_status: %q (expected %q, %q, %q or %q)", path, m.DefaultStatus, StatePending, StateActive, StateRetiring, StateRevoked)
+	}
+	for kid, meta := range m.Keys {
+		if meta == nil {
+			return nil, fmt.Errorf("key manifest %s: kid %s has no metadata", path, kid)
+		}
+		if err := meta.validate(); err != nil {
+			return nil, fmt.Errorf("key manifest %s: kid %s: %w", path, kid, err)
+		}
+	}
+	slog.Info("loaded key manifest", "path", path, "keys", len(m.Keys))
+	return m, nil
+}
+
+func (m *Metadata) validate() error {
+	switch m.Status {
+	case "", StatePending, StateActive, StateRetiring, StateRevoked:
+	default:
+		return fmt.Errorf("unsupported status: %q (expected %q, %q, %q or %q)", m.Status, StatePending, StateActive, StateRetiring, StateRevoked)
+	}
+
+	// 指定された時刻は created <= activate_at <= stop_signing_at <= retire_at の順に並ぶこと
+	names := []string{"created", "activate_at", "stop_signing_at", "retire_at"}
+	var prev *time.Time
+	var prevName string
+	for n, t := range []*time.Time{m.Created, m.ActivateAt, m.StopSigningAt, m.RetireAt} {
+		if t == nil {
+			continue
+		}
+		if prev != nil && t.Before(*prev) {
+			return fmt.Errorf("%s (%s) is before %s (%s)", names[n], t.Format(time.RFC3339), prevName, prev.Format(time.RFC3339))
+		}
+		prev, prevName = t, names[n]
+	}
+	return nil
+}
+
+// State は now における kid の状態を返す
+// 時刻による状態と手動で設定した状態のうち、後の状態を返す
+func (m *Manifest) State(kid string, now time.Time) string {
+	meta, ok := m.Keys[kid]
+	if !ok {
+		if m.DefaultStatus != "" {
+			return m.DefaultStatus
+		}
+		return StateUnlisted
+	}
+
+	state := StateActive
+	switch {
+	case meta.RetireAt != nil && !now.Before(*meta.RetireAt):
+		state = StateRetired
+	case meta.StopSigningAt != nil && !now.Before(*meta.StopSigningAt):
+		state = StateRetiring
+	case meta.ActivateAt != nil && now.Before(*meta.ActivateAt):
+		state = StatePending
+	case meta.ActivateAt == nil && meta.Status == StatePending:
+		// activate_at が無い場合は status を変えるまで有効化しない
+		state = StatePending
+	}
+	if stateRank[meta.Status] > stateRank[state] {
+		state = meta.Status
+	}
+	return state
+}
+
+// Listed は kid がマニフェストに記載されているかどうかを返す
+func (m *Manifest) Listed(kid string) bool {
+	_, ok := m.Keys[kid]
+	return ok
+}
+
+// Visible は now に kid の公開鍵を JWKS で公開するかどうかを返す
+func (m *Manifest) Visible(kid string, now time.Time) bool {
+	switch m.State(kid, now) {
+	case StatePending, StateActive, StateRetiring:
+		return true
+	}
+	return false
+}
+
+// CheckSigning は now に kid で署名してよいかを確認し、active でない場合は ErrNotActive を返す
+func (m *Manifest) CheckSigning(kid string, now time.Time) error {
+	if state := m.State(kid, now); state != StateActive {
+		return fmt.Errorf("%w: kid %s is %s", ErrNotActive, kid, state)
+	}
+	return nil
+}
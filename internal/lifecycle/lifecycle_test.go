@@ -0,0 +1,103 @@
+package lifecycle
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		noFile  bool
+		wantErr bool
+	}{
+		{
+			name: "normal",
+			content: `{"keys": {
+				"key-001": {"created": "2025-01-01T00:00:00Z", "activate_at": "2025-01-02T00:00:00Z", "stop_signing_at": "2025-04-01T00:00:00Z", "retire_at": "2025-05-01T00:00:00Z"},
+				"key-002": {"status": "revoked"}
+			}}`,
+		},
+		{name: "empty", content: `{"keys": {}}`},
+		{name: "default status", content: `{"keys": {}, "default_status": "pending"}`},
+		{name: "error unsupported default status", content: `{"keys": {}, "default_status": "retired"}`, wantErr: true},
+		{name: "error unsupported status", content: `{"keys": {"key-001": {"status": "retired"}}}`, wantErr: true},
+		{name: "error unknown field", content: `{"keys": {"key-001": {"activate": "2025-01-02T00:00:00Z"}}}`, wantErr: true},
+		{name: "error times out of order", content: `{"keys": {"key-001": {"activate_at": "2025-05-01T00:00:00Z", "retire_at": "2025-04-01T00:00:00Z"}}}`, wantErr: true},
+		{name: "error null metadata", content: `{"keys": {"key-001": null}}`, wantErr: true},
+		{name: "error invalid time", content: `{"keys": {"key-001": {"retire_at": "tomorrow"}}}`, wantErr: true},
+		{name: "error no file", noFile: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &MockFileOperator{Files: map[string][]byte{}}
+			if !tt.noFile {
+				f.Files["files/keys.json"] = []byte(tt.content)
+			}
+			_, err := Load(f, "files/keys.json")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestManifest_State(t *testing.T) {
+	at := func(day int) *time.Time {
+		t := time.Date(2025, 1, day, 0, 0, 0, 0, time.UTC)
+		return &t
+	}
+	m := &Manifest{Keys: map[string]*Metadata{
+		"rotated":   {Created: at(1), ActivateAt: at(2), StopSigningAt: at(10), RetireAt: at(20)},
+		"no-retire": {StopSigningAt: at(10)},
+		"revoked":   {ActivateAt: at(2), Status: StateRevoked},
+		"early":     {ActivateAt: at(2), RetireAt: at(20), Status: StateRetiring},
+		"forced":    {ActivateAt: at(10), Status: StateActive},
+		"pending":   {Status: StatePending},
+	}}
+
+	tests := []struct {
+		name          string
+		kid           string
+		day           int
+		defaultStatus string
+		want          string
+		wantVisible   bool
+	}{
+		{name: "before activation", kid: "rotated", day: 1, want: StatePending, wantVisible: true},
+		{name: "at activation", kid: "rotated", day: 2, want: StateActive, wantVisible: true},
+		{name: "after stop signing", kid: "rotated", day: 10, want: StateRetiring, wantVisible: true},
+		{name: "after retirement", kid: "rotated", day: 20, want: StateRetired},
+		{name: "retiring without retire_at", kid: "no-retire", day: 28, want: StateRetiring, wantVisible: true},
+		{name: "revoked before its times", kid: "revoked", day: 5, want: StateRevoked},
+		{name: "status retires early", kid: "early", day: 5, want: StateRetiring, wantVisible: true},
+		{name: "time is ahead of status", kid: "early", day: 20, want: StateRetired},
+		{name: "status activates early", kid: "forced", day: 5, want: StateActive, wantVisible: true},
+		{name: "pending by status", kid: "pending", day: 5, want: StatePending, wantVisible: true},
+		{name: "unlisted kid is neither published nor signed", kid: "unknown", day: 5, want: StateUnlisted},
+		{name: "unlisted kid with default status", kid: "unknown", day: 5, defaultStatus: StateActive, want: StateActive, wantVisible: true},
+		{name: "unlisted kid with pending default status", kid: "unknown", day: 5, defaultStatus: StatePending, want: StatePending, wantVisible: true},
+		{name: "default status does not apply to listed kid", kid: "revoked", day: 5, defaultStatus: StateActive, want: StateRevoked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := *at(tt.day)
+			m.DefaultStatus = tt.defaultStatus
+			if got := m.State(tt.kid, now); got != tt.want {
+				t.Errorf("Manifest.State() = %v, want %v", got, tt.want)
+			}
+			if got := m.Visible(tt.kid, now); got != tt.wantVisible {
+				t.Errorf("Manifest.Visible() = %v, want %v", got, tt.wantVisible)
+			}
+			err := m.CheckSigning(tt.kid, now)
+			if (err == nil) != (tt.want == StateActive) {
+				t.Errorf("Manifest.CheckSigning() error = %v, state %v", err, tt.want)
+			}
+			if err != nil && !errors.Is(err, ErrNotActive) {
+				t.Errorf("Manifest.CheckSigning() error = %v, want %v", err, ErrNotActive)
+			}
+		})
+	}
+}
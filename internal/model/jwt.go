@@ -1,10 +1,79 @@
 package model
 
-import "github.com/golang-jwt/jwt/v5"
+import (
+	"encoding/json"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ReservedClaims: RegisteredClaims で型付けされているクレーム名
+var ReservedClaims = []string{"iss", "sub", "aud", "exp", "nbf", "iat", "jti"}
 
 // CustomClaims: このシステムにおける JWT のクレームを定義する構造体
+// 登録済みクレーム以外の任意のクレームは Extra に保持する
 type CustomClaims struct {
 	jwt.RegisteredClaims
+	Extra map[string]any `json:"-"`
+
+	// クレームテンプレートで描画済みかどうか (トークンには含めない)
+	// テンプレートを設定した Issuer は描画されていないクレームに署名しない
+	TemplateRendered bool `json:"-"`
+}
+
+// IsReservedClaim は name が RegisteredClaims で扱うクレーム名かどうかを返す
+func IsReservedClaim(name string) bool {
+	for _, c := range ReservedClaims {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// MarshalJSON は RegisteredClaims と Extra を 1 つの JSON オブジェクトとして出力する
+func (c CustomClaims) MarshalJSON() ([]byte, error) {
+	b, err := json.Marshal(c.RegisteredClaims)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.Extra) == 0 {
+		return b, nil
+	}
+
+	m := map[string]any{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	for k, v := range c.Extra {
+		if _, ok := m[k]; ok {
+			continue // 登録済みクレームを優先する
+		}
+		m[k] = v
+	}
+	return json.Marshal(m)
+}
+
+// UnmarshalJSON は登録済みクレームを RegisteredClaims に、それ以外を Extra に格納する
+func (c *CustomClaims) UnmarshalJSON(b []byte) error {
+	var registered jwt.RegisteredClaims
+	if err := json.Unmarshal(b, &registered); err != nil {
+		return err
+	}
+
+	var m map[string]any
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	for _, name := range ReservedClaims {
+		delete(m, name)
+	}
+
+	c.RegisteredClaims = registered
+	c.Extra = nil
+	if len(m) > 0 {
+		c.Extra = m
+	}
+	return nil
 }
 
 type Response struct {
@@ -12,10 +81,26 @@ type Response struct {
 }
 
 type Key struct {
-	Kty string `json:"kty"` // 鍵のタイプ
-	Crv string `json:"crv"` // 鍵の曲線
-	Kid string `json:"kid"` // 鍵のID
-	Use string `json:"use"` // 鍵の用途
-	Alg string `json:"alg"` // 鍵のアルゴリズム
-	X   string `json:"x"`   // 鍵の値
+	Kty string `json:"kty"`           // 鍵のタイプ
+	Crv string `json:"crv,omitempty"` // 鍵の曲線
+	Kid string `json:"kid"`           // 鍵のID
+	Use string `json:"use"`           // 鍵の用途
+	Alg string `json:"alg,omitempty"` // 鍵のアルゴリズム
+	X   string `json:"x,omitempty"`   // 鍵の値
+	Y   string `json:"y,omitempty"`   // EC 鍵の y 座標
+	N   string `json:"n,omitempty"`   // RSA 鍵のモジュラス
+	E   string `json:"e,omitempty"`   // RSA 鍵の公開指数
+}
+
+// Confirmation: トークンを鍵に結び付ける cnf クレーム (RFC 7800)
+type Confirmation struct {
+	JKT     string `json:"jkt,omitempty"`      // DPoP proof の公開鍵の JWK Thumbprint (RFC 9449)
+	X5tS256 string `json:"x5t#S256,omitempty"` // クライアント証明書の SHA-256 thumbprint (RFC 8705)
+}
+
+// Actor: トークン交換で委任先の主体を表す act クレーム (RFC 8693 Section 4.1)
+// 入れ子の Act はそれ以前に委任を受けた主体を表す
+type Actor struct {
+	Sub string `json:"sub"`
+	Act *Actor `json:"act,omitempty"`
 }
@@ -0,0 +1,34 @@
+package model
+
+import "github.com/golang-jwt/jwt/v5"
+
+// ステータスリストトークンの typ ヘッダーとメディアタイプ
+const (
+	StatusListTokenType      = "statuslist+jwt"
+	StatusListTokenMediaType = "application/statuslist+jwt"
+)
+
+// StatusClaim: Token Status List で状態を参照するための status クレーム
+// https://datatracker.ietf.org/doc/draft-ietf-oauth-status-list/
+type StatusClaim struct {
+	StatusList StatusListReference `json:"status_list"`
+}
+
+// StatusListReference: status クレームが参照するステータスリストの位置
+type StatusListReference struct {
+	Idx int    `json:"idx"` // ステータスリスト内のインデックス
+	URI string `json:"uri"` // ステータスリストトークンの URI
+}
+
+// StatusList: ステータスリストトークンの status_list クレーム
+type StatusList struct {
+	Bits int    `json:"bits"` // 1 つのステータスのビット数 (1, 2, 4, 8)
+	Lst  string `json:"lst"`  // zlib で圧縮し base64url でエンコードしたステータスのバイト列
+}
+
+// StatusListTokenClaims: ステータスリストトークンのクレーム
+type StatusListTokenClaims struct {
+	jwt.RegisteredClaims
+	TTL        int64      `json:"ttl,omitempty"` // キャッシュしてよい最大の秒数
+	StatusList StatusList `json:"status_list"`
+}
@@ -0,0 +1,26 @@
+package mtls
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+)
+
+// ParseCertificatePEM は PEM 形式の証明書の先頭の CERTIFICATE ブロックをパースする
+// 証明書チェーンの場合は先頭 (クライアント証明書) を返す
+func ParseCertificatePEM(pemBytes []byte) (*x509.Certificate, error) {
+	for block, rest := pem.Decode(pemBytes); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type == "CERTIFICATE" {
+			return x509.ParseCertificate(block.Bytes)
+		}
+	}
+	return nil, fmt.Errorf("failed to decode PEM block containing certificate")
+}
+
+// Thumbprint は証明書の DER の SHA-256 を base64url で返す (cnf の x5t#S256, RFC 8705 Section 3.1)
+func Thumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
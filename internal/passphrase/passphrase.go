@@ -0,0 +1,85 @@
+package passphrase
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+// Source は暗号化された秘密鍵のパスフレーズを返す
+type Source func() ([]byte, error)
+
+// FromEnv は環境変数 name の値をパスフレーズとして返す Source を作る
+func FromEnv(name string) Source {
+	return func() ([]byte, error) {
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, fmt.Errorf("passphrase environment variable %s is not set", name)
+		}
+		return []byte(v), nil
+	}
+}
+
+// FromFD はファイルディスクリプタ fd から読んだ 1 行目をパスフレーズとして返す Source を作る
+// fd は一度しか読めないため Cached と組み合わせて使う
+func FromFD(fd int) Source {
+	return func() ([]byte, error) {
+		f := os.NewFile(uintptr(fd), fmt.Sprintf("fd%d", fd))
+		if f == nil {
+			return nil, fmt.Errorf("invalid passphrase file descriptor: %d", fd)
+		}
+		defer f.Close()
+		return readLine(f)
+	}
+}
+
+// Prompt は端末にプロンプトを表示し、エコーせずに入力されたパスフレーズを返す Source を作る
+// 標準入力が端末でない場合は /dev/tty から読む
+func Prompt(prompt string) Source {
+	return func() ([]byte, error) {
+		tty := os.Stdin
+		if !term.IsTerminal(int(tty.Fd())) {
+			var err error
+			if tty, err = os.OpenFile("/dev/tty", os.O_RDWR, 0); err != nil {
+				return nil, errors.New("passphrase is required but no terminal is available")
+			}
+			defer tty.Close()
+		}
+
+		// stdout はコマンドの出力に使うためプロンプトは stderr に出す
+		fmt.Fprint(os.Stderr, prompt)
+		b, err := term.ReadPassword(int(tty.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read passphrase: %w", err)
+		}
+		return b, nil
+	}
+}
+
+// Cached は最初に取得したパスフレーズを保持し、2 回目以降はその値を返す Source を作る
+func Cached(s Source) Source {
+	var (
+		once sync.Once
+		b    []byte
+		err  error
+	)
+	return func() ([]byte, error) {
+		once.Do(func() { b, err = s() })
+		return b, err
+	}
+}
+
+func readLine(r io.Reader) ([]byte, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	return []byte(strings.TrimRight(line, "\r\n")), nil
+}
@@ -0,0 +1,68 @@
+package passphrase
+
+import (
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("JWKS_DEMO_TEST_PASSPHRASE", "secret")
+
+	got, err := FromEnv("JWKS_DEMO_TEST_PASSPHRASE")()
+	if err != nil || string(got) != "secret" {
+		t.Errorf("FromEnv() = %s, %v, want secret", got, err)
+	}
+	if _, err := FromEnv("JWKS_DEMO_TEST_PASSPHRASE_UNSET")(); err == nil {
+		t.Error("FromEnv() with unset variable succeeded")
+	}
+}
+
+func TestFromFD(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "line", input: "secret\nignored\n", want: "secret"},
+		{name: "crlf", input: "secret\r\n", want: "secret"},
+		{name: "without newline", input: "secret", want: "secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, w, err := os.Pipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.WriteString(tt.input)
+			w.Close()
+			// FromFD は fd を閉じるため複製した fd を渡す
+			fd, err := syscall.Dup(int(r.Fd()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Close()
+
+			got, err := FromFD(fd)()
+			if err != nil || string(got) != tt.want {
+				t.Errorf("FromFD() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCached(t *testing.T) {
+	calls := 0
+	s := Cached(func() ([]byte, error) {
+		calls++
+		return []byte("secret"), nil
+	})
+	for range 3 {
+		if got, err := s(); err != nil || string(got) != "secret" {
+			t.Errorf("Cached() = %s, %v", got, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Cached() called source %d times, want 1", calls)
+	}
+}
@@ -0,0 +1,305 @@
+package pkcs8
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// PEMType は暗号化された PKCS#8 秘密鍵の PEM ブロックタイプ
+const PEMType = "ENCRYPTED PRIVATE KEY"
+
+// ErrIncorrectPassphrase はパスフレーズが誤っている (または鍵が壊れている) ことを表す
+var ErrIncorrectPassphrase = errors.New("incorrect passphrase or corrupted private key")
+
+// PBES2 で使うアルゴリズムの OID (RFC 8018, RFC 7914)
+var (
+	oidPBES2  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidScrypt = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11591, 4, 11}
+
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+
+	oidAES128CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// prfByOID は PBKDF2 の擬似乱数関数
+var prfByOID = map[string]func() hash.Hash{
+	oidHMACWithSHA1.String():   sha1.New,
+	oidHMACWithSHA256.String(): sha256.New,
+	oidHMACWithSHA384.String(): sha512.New384,
+	oidHMACWithSHA512.String(): sha512.New,
+}
+
+// aesKeySizeByOID は AES-CBC の鍵長 (byte)
+var aesKeySizeByOID = map[string]int{
+	oidAES128CBC.String(): 16,
+	oidAES192CBC.String(): 24,
+	oidAES256CBC.String(): 32,
+}
+
+// EncryptPrivateKey で使う scrypt のパラメータ
+const (
+	scryptCost            = 1 << 15
+	scryptBlockSize       = 8
+	scryptParallelization = 1
+	saltSize              = 16
+)
+
+// 鍵ファイルから読んだ鍵導出パラメータの上限
+// 細工された鍵ファイルで CPU やメモリを使い切らないように、これを超える値は導出前に拒否する
+const (
+	maxPBKDF2Iterations      = 10_000_000
+	maxScryptCost            = 1 << 20
+	maxScryptMemory          = 1 << 30 // scrypt が使うメモリ (128 * N * r バイト) の上限
+	maxScryptParallelization = 16
+)
+
+type encryptedPrivateKeyInfo struct {
+	EncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedData       []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"` // 省略時は hmacWithSHA1
+}
+
+type scryptParams struct {
+	Salt                     []byte
+	CostParameter            int
+	BlockSize                int
+	ParallelizationParameter int
+	KeyLength                int `asn1:"optional"`
+}
+
+// IsEncryptedPEM は PEM データに ENCRYPTED PRIVATE KEY ブロックが含まれるかどうかを返す
+func IsEncryptedPEM(pemBytes []byte) bool {
+	for block, rest := pem.Decode(pemBytes); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type == PEMType {
+			return true
+		}
+	}
+	return false
+}
+
+// DecryptPEMBlock は ENCRYPTED PRIVATE KEY の PEM ブロックを passphrase が返すパスフレーズで復号し、秘密鍵を返す
+// passphrase は暗号化された鍵を読むときにだけ呼ばれる
+func DecryptPEMBlock(block *pem.Block, passphrase func() ([]byte, error)) (any, error) {
+	if block.Type != PEMType {
+		return nil, fmt.Errorf("unexpected PEM block type: %q (expected %q)", block.Type, PEMType)
+	}
+	if passphrase == nil {
+		return nil, errors.New("private key is encrypted but no passphrase source is configured")
+	}
+	pass, err := passphrase()
+	if err != nil {
+		return nil, err
+	}
+	return ParseEncryptedPrivateKey(block.Bytes, pass)
+}
+
+// ParseEncryptedPrivateKey は ENCRYPTED PRIVATE KEY (PBES2) の DER をパスフレーズで復号し、秘密鍵を返す
+// 鍵導出は PBKDF2 (HMAC-SHA1/256/384/512) と scrypt、暗号化は AES-CBC に対応する
+func ParseEncryptedPrivateKey(der []byte, passphrase []byte) (any, error) {
+	var info encryptedPrivateKeyInfo
+	if rest, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("failed to parse encrypted private key: %w", err)
+	} else if len(rest) != 0 {
+		return nil, errors.New("trailing data after encrypted private key")
+	}
+	if !info.EncryptionAlgorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported private key encryption algorithm: %s (only PBES2 is supported)", info.EncryptionAlgorithm.Algorithm)
+	}
+
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.EncryptionAlgorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("failed to parse PBES2 parameters: %w", err)
+	}
+
+	keySize, ok := aesKeySizeByOID[params.EncryptionScheme.Algorithm.String()]
+	if !ok {
+		return nil, fmt.Errorf("unsupported PBES2 encryption scheme: %s", params.EncryptionScheme.Algorithm)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, fmt.Errorf("failed to parse AES-CBC IV: %w", err)
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, errors.New("invalid AES-CBC IV length")
+	}
+
+	key, err := deriveKey(params.KeyDerivationFunc, passphrase, keySize)
+	if err != nil {
+		return nil, err
+	}
+
+	plain, err := decryptCBC(key, iv, info.EncryptedData)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, err := x509.ParsePKCS8PrivateKey(plain)
+	if err != nil {
+		// パディングが偶然正しくなった場合も誤ったパスフレーズとして扱う
+		return nil, ErrIncorrectPassphrase
+	}
+	return privateKey, nil
+}
+
+// deriveKey は PBES2 の鍵導出関数で暗号鍵を導出する
+func deriveKey(kdf pkix.AlgorithmIdentifier, passphrase []byte, keySize int) ([]byte, error) {
+	switch {
+	case kdf.Algorithm.Equal(oidPBKDF2):
+		var p pbkdf2Params
+		if _, err := asn1.Unmarshal(kdf.Parameters.FullBytes, &p); err != nil {
+			return nil, fmt.Errorf("failed to parse PBKDF2 parameters: %w", err)
+		}
+		if p.KeyLength != 0 && p.KeyLength != keySize {
+			return nil, fmt.Errorf("PBKDF2 key length %d does not match the cipher key size %d", p.KeyLength, keySize)
+		}
+		prf := sha1.New
+		if len(p.PRF.Algorithm) != 0 {
+			var ok bool
+			if prf, ok = prfByOID[p.PRF.Algorithm.String()]; !ok {
+				return nil, fmt.Errorf("unsupported PBKDF2 PRF: %s", p.PRF.Algorithm)
+			}
+		}
+		if p.IterationCount <= 0 || p.IterationCount > maxPBKDF2Iterations {
+			return nil, fmt.Errorf("PBKDF2 iteration count %d is out of range (1-%d)", p.IterationCount, maxPBKDF2Iterations)
+		}
+		return pbkdf2.Key(passphrase, p.Salt, p.IterationCount, keySize, prf), nil
+
+	case kdf.Algorithm.Equal(oidScrypt):
+		var p scryptParams
+		if _, err := asn1.Unmarshal(kdf.Parameters.FullBytes, &p); err != nil {
+			return nil, fmt.Errorf("failed to parse scrypt parameters: %w", err)
+		}
+		if p.KeyLength != 0 && p.KeyLength != keySize {
+			return nil, fmt.Errorf("scrypt key length %d does not match the cipher key size %d", p.KeyLength, keySize)
+		}
+		if err := validateScryptParams(p); err != nil {
+			return nil, err
+		}
+		return scrypt.Key(passphrase, p.Salt, p.CostParameter, p.BlockSize, p.ParallelizationParameter, keySize)
+	}
+	return nil, fmt.Errorf("unsupported PBES2 key derivation function: %s", kdf.Algorithm)
+}
+
+// validateScryptParams は scrypt のパラメータが上限内かどうかを確認する
+func validateScryptParams(p scryptParams) error {
+	n, r := p.CostParameter, p.BlockSize
+	if n <= 1 || n > maxScryptCost || n&(n-1) != 0 {
+		return fmt.Errorf("scrypt cost parameter %d must be a power of two between 2 and %d", n, maxScryptCost)
+	}
+	if r <= 0 || r > maxScryptMemory/(128*n) {
+		return fmt.Errorf("scrypt block size %d is out of range (memory limit %d bytes)", r, maxScryptMemory)
+	}
+	if p.ParallelizationParameter <= 0 || p.ParallelizationParameter > maxScryptParallelization {
+		return fmt.Errorf("scrypt parallelization parameter %d is out of range (1-%d)", p.ParallelizationParameter, maxScryptParallelization)
+	}
+	return nil
+}
+
+func decryptCBC(key, iv, ciphertext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, errors.New("invalid encrypted private key length")
+	}
+	plain := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, ciphertext)
+
+	// PKCS#7 パディングを取り除く
+	n := int(plain[len(plain)-1])
+	if n == 0 || n > aes.BlockSize || !bytes.Equal(plain[len(plain)-n:], bytes.Repeat([]byte{byte(n)}, n)) {
+		return nil, ErrIncorrectPassphrase
+	}
+	return plain[:len(plain)-n], nil
+}
+
+// EncryptPrivateKey は秘密鍵を PKCS#8 に変換し、パスフレーズで暗号化した ENCRYPTED PRIVATE KEY の DER を返す
+// 鍵導出は scrypt、暗号化は AES-256-CBC を使う
+func EncryptPrivateKey(key any, passphrase []byte) ([]byte, error) {
+	plain, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, saltSize)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+
+	const keySize = 32
+	derived, err := scrypt.Key(passphrase, salt, scryptCost, scryptBlockSize, scryptParallelization, keySize)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(derived)
+	if err != nil {
+		return nil, err
+	}
+	n := aes.BlockSize - len(plain)%aes.BlockSize
+	plain = append(plain, bytes.Repeat([]byte{byte(n)}, n)...)
+	encrypted := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, plain)
+
+	kdfParams, err := asn1.Marshal(scryptParams{
+		Salt:                     salt,
+		CostParameter:            scryptCost,
+		BlockSize:                scryptBlockSize,
+		ParallelizationParameter: scryptParallelization,
+	})
+	if err != nil {
+		return nil, err
+	}
+	ivParams, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+	params, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{Algorithm: oidScrypt, Parameters: asn1.RawValue{FullBytes: kdfParams}},
+		EncryptionScheme:  pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivParams}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(encryptedPrivateKeyInfo{
+		EncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}},
+		EncryptedData:       encrypted,
+	})
+}
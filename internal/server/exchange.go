@@ -0,0 +1,191 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jwks_demo/internal/client"
+	"github.com/jwks_demo/internal/issue"
+	"github.com/jwks_demo/internal/model"
+	"github.com/jwks_demo/internal/verify"
+)
+
+// トークン交換 (RFC 8693) のグラントタイプとトークンタイプ
+const (
+	grantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+	tokenTypeAccessToken   = "urn:ietf:params:oauth:token-type:access_token"
+	tokenTypeJWT           = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// TokenVerifier はトークン交換で提示された subject_token / actor_token を検証する
+type TokenVerifier interface {
+	VerifyClaims(jwtString string) (*verify.MyCustomClaims, error)
+}
+
+// serverTokenVerifier はこのサーバーが発行したトークンを、公開中の鍵とステータスの保存ファイルで直接検証する
+// verify コマンドの検証と同様に、鍵や証明書に結び付けられたトークンは所持の証明が無いため受け付けない
+type serverTokenVerifier struct {
+	s *Server
+}
+
+func (v *serverTokenVerifier) VerifyClaims(jwtString string) (*verify.MyCustomClaims, error) {
+	claims := &verify.MyCustomClaims{}
+	if err := v.s.parseToken(jwtString, claims); err != nil {
+		return nil, err
+	}
+	if claims.Cnf != nil && claims.Cnf.JKT != "" {
+		return nil, errors.New("token is bound to a DPoP key; a DPoP proof is required")
+	}
+	if claims.Cnf != nil && claims.Cnf.X5tS256 != "" {
+		return nil, errors.New("token is bound to a client certificate; the presenting certificate is required")
+	}
+	if err := v.s.checkTokenStatus(claims.Status); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// tokenExchangeGrant はトークン交換グラントで subject_token を下流のオーディエンス向けのトークンに交換する (RFC 8693)
+// 発行するトークンの act クレームには現在の主体 (actor_token の sub またはクライアント) を、
+// その内側には subject_token の act クレーム (以前の委任) を入れ子にして記録する
+func (s *Server) tokenExchangeGrant(w http.ResponseWriter, r *http.Request, c *client.Client) {
+	if s.TokenVerifier == nil {
+		slog.Error("token verifier is not configured")
+		http.Error(w, "token exchange is not available", http.StatusInternalServerError)
+		return
+	}
+
+	if requested := r.PostForm.Get("requested_token_type"); requested != "" && !isJWTTokenType(requested) {
+		writeOAuthError(w, newOAuthError(http.StatusBadRequest, errInvalidRequest, fmt.Sprintf("requested_token_type %q is not supported", requested)))
+		return
+	}
+
+	subject, oerr := s.verifyExchangeToken(r, "subject_token", true)
+	if oerr != nil {
+		slog.Info("subject token is rejected", "client_id", c.ClientID, "error", oerr)
+		writeOAuthError(w, oerr)
+		return
+	}
+	actor, oerr := s.verifyExchangeToken(r, "actor_token", false)
+	if oerr != nil {
+		slog.Info("actor token is rejected", "client_id", c.ClientID, "error", oerr)
+		writeOAuthError(w, oerr)
+		return
+	}
+
+	// オーディエンスはクライアントごとのポリシーで許可されたものに限る
+	audiences := r.PostForm["audience"]
+	if len(audiences) == 0 {
+		writeOAuthError(w, newOAuthError(http.StatusBadRequest, errInvalidRequest, "audience is required"))
+		return
+	}
+	for _, aud := range audiences {
+		if !c.AllowsExchangeAudience(aud) {
+			writeOAuthError(w, newOAuthError(http.StatusBadRequest, errInvalidTarget, fmt.Sprintf("audience %q is not allowed for token exchange by the client", aud)))
+			return
+		}
+	}
+
+	// スコープは subject_token のスコープの範囲に絞り込む
+	subjectScopes := strings.Fields(subject.Scope)
+	scopes := strings.Fields(r.PostForm.Get("scope"))
+	if len(scopes) == 0 {
+		scopes = subjectScopes
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(subjectScopes, scope) {
+			writeOAuthError(w, newOAuthError(http.StatusBadRequest, errInvalidScope, fmt.Sprintf("scope %q is not granted to the subject token", scope)))
+			return
+		}
+	}
+
+	act := &model.Actor{Sub: c.ClientID, Act: subject.Act}
+	if actor != nil {
+		act.Sub = actor.Subject
+	}
+
+	// 交換したトークンの有効期限は subject_token より長くしない
+	now := time.Now()
+	expiresAt := now.Add(s.TokenLifetime)
+	if subject.ExpiresAt != nil && subject.ExpiresAt.Before(expiresAt) {
+		expiresAt = subject.ExpiresAt.Time
+	}
+
+	claims := &model.CustomClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.IssuerName,
+			Subject:   subject.Subject,
+			Audience:  jwt.ClaimStrings(audiences),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			ID:        issue.NewJTI(),
+		},
+		Extra: map[string]any{
+			"client_id": c.ClientID,
+			"act":       act,
+		},
+	}
+	if len(scopes) > 0 {
+		claims.Extra["scope"] = strings.Join(scopes, " ")
+	}
+
+	issued, err := s.signToken(claims)
+	if err != nil {
+		slog.Error("failed to issue token", "client_id", c.ClientID, "error", err)
+		http.Error(w, "failed to issue token", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("issued token", "client_id", c.ClientID, "grant_type", grantTypeTokenExchange, "jti", claims.ID, "sub", claims.Subject, "act", act.Sub)
+	writeTokenResponse(w, tokenResponse{
+		AccessToken:     issued.Token,
+		IssuedTokenType: tokenTypeAccessToken,
+		TokenType:       "Bearer",
+		ExpiresIn:       int64(expiresAt.Sub(now).Seconds()),
+		Scope:           strings.Join(scopes, " "),
+	})
+}
+
+// verifyExchangeToken はフォームの name (subject_token または actor_token) と name_type を検証し、クレームを返す
+// required が false でトークンが指定されていない場合は nil を返す
+func (s *Server) verifyExchangeToken(r *http.Request, name string, required bool) (*verify.MyCustomClaims, *oauthError) {
+	token := r.PostForm.Get(name)
+	tokenType := r.PostForm.Get(name + "_type")
+	if token == "" {
+		if required {
+			return nil, newOAuthError(http.StatusBadRequest, errInvalidRequest, name+" is required")
+		}
+		if tokenType != "" {
+			return nil, newOAuthError(http.StatusBadRequest, errInvalidRequest, name+"_type is given without "+name)
+		}
+		return nil, nil
+	}
+	if tokenType == "" {
+		return nil, newOAuthError(http.StatusBadRequest, errInvalidRequest, name+"_type is required")
+	}
+	if !isJWTTokenType(tokenType) {
+		return nil, newOAuthError(http.StatusBadRequest, errInvalidRequest, fmt.Sprintf("%s_type %q is not supported", name, tokenType))
+	}
+
+	claims, err := s.TokenVerifier.VerifyClaims(token)
+	if err != nil {
+		// 無効なトークンの詳細は呼び出し元に返さない
+		slog.Info("exchange token is invalid", "token", name, "error", err)
+		return nil, newOAuthError(http.StatusBadRequest, errInvalidRequest, name+" is invalid")
+	}
+	if claims.Subject == "" {
+		return nil, newOAuthError(http.StatusBadRequest, errInvalidRequest, name+" has no sub claim")
+	}
+	return claims, nil
+}
+
+// isJWTTokenType はこのサーバーが扱える (JWT 形式の) トークンタイプかどうかを返す
+func isJWTTokenType(tokenType string) bool {
+	return tokenType == tokenTypeAccessToken || tokenType == tokenTypeJWT
+}
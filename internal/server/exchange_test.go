@@ -0,0 +1,313 @@
+package server
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jwks_demo/internal/lifecycle"
+	"github.com/jwks_demo/internal/model"
+	"github.com/jwks_demo/internal/verify"
+)
+
+func TestServer_tokenHandler_tokenExchange(t *testing.T) {
+	subjectExp := time.Now().Add(10 * time.Minute).Truncate(time.Second)
+	verifier := &MockTokenVerifier{Claims: map[string]*verify.MyCustomClaims{
+		"user.token": {
+			RegisteredClaims: jwt.RegisteredClaims{Subject: "alice", ExpiresAt: jwt.NewNumericDate(subjectExp)},
+			Scope:            "read write",
+		},
+		"delegated.token": {
+			RegisteredClaims: jwt.RegisteredClaims{Subject: "alice", ExpiresAt: jwt.NewNumericDate(subjectExp)},
+			Scope:            "read",
+			Act:              &model.Actor{Sub: "frontend"},
+		},
+		"service.token": {
+			RegisteredClaims: jwt.RegisteredClaims{Subject: "gateway-service"},
+		},
+	}}
+	exchange := func(values url.Values) url.Values {
+		form := url.Values{
+			"grant_type":         {grantTypeTokenExchange},
+			"client_id":          {"client-1"},
+			"client_secret":      {"secret"},
+			"subject_token_type": {tokenTypeAccessToken},
+			"audience":           {"downstream"},
+		}
+		for k, v := range values {
+			form[k] = v
+		}
+		return form
+	}
+
+	tests := []struct {
+		name       string
+		form       url.Values
+		wantStatus int
+		wantError  string
+		wantScope  string
+		wantAct    *model.Actor
+	}{
+		{
+			name:       "client acts for the subject",
+			form:       exchange(url.Values{"subject_token": {"user.token"}, "scope": {"read"}}),
+			wantStatus: http.StatusOK,
+			wantScope:  "read",
+			wantAct:    &model.Actor{Sub: "client-1"},
+		},
+		{
+			name:       "actor token with default scope",
+			form:       exchange(url.Values{"subject_token": {"user.token"}, "actor_token": {"service.token"}, "actor_token_type": {tokenTypeJWT}}),
+			wantStatus: http.StatusOK,
+			wantScope:  "read write",
+			wantAct:    &model.Actor{Sub: "gateway-service"},
+		},
+		{
+			name:       "delegation chain",
+			form:       exchange(url.Values{"subject_token": {"delegated.token"}, "actor_token": {"service.token"}, "actor_token_type": {tokenTypeAccessToken}}),
+			wantStatus: http.StatusOK,
+			wantScope:  "read",
+			wantAct:    &model.Actor{Sub: "gateway-service", Act: &model.Actor{Sub: "frontend"}},
+		},
+		{
+			name:       "error missing subject_token",
+			form:       exchange(nil),
+			wantStatus: http.StatusBadRequest,
+			wantError:  errInvalidRequest,
+		},
+		{
+			name:       "error invalid subject_token",
+			form:       exchange(url.Values{"subject_token": {"forged.token"}}),
+			wantStatus: http.StatusBadRequest,
+			wantError:  errInvalidRequest,
+		},
+		{
+			name:       "error unsupported subject_token_type",
+			form:       exchange(url.Values{"subject_token": {"user.token"}, "subject_token_type": {"urn:ietf:params:oauth:token-type:saml2"}}),
+			wantStatus: http.StatusBadRequest,
+			wantError:  errInvalidRequest,
+		},
+		{
+			name:       "error actor_token without type",
+			form:       exchange(url.Values{"subject_token": {"user.token"}, "actor_token": {"service.token"}}),
+			wantStatus: http.StatusBadRequest,
+			wantError:  errInvalidRequest,
+		},
+		{
+			name:       "error invalid actor_token",
+			form:       exchange(url.Values{"subject_token": {"user.token"}, "actor_token": {"forged.token"}, "actor_token_type": {tokenTypeJWT}}),
+			wantStatus: http.StatusBadRequest,
+			wantError:  errInvalidRequest,
+		},
+		{
+			name:       "error audience not allowed by policy",
+			form:       exchange(url.Values{"subject_token": {"user.token"}, "audience": {"api"}}),
+			wantStatus: http.StatusBadRequest,
+			wantError:  errInvalidTarget,
+		},
+		{
+			name:       "error missing audience",
+			form:       exchange(url.Values{"subject_token": {"user.token"}, "audience": nil}),
+			wantStatus: http.StatusBadRequest,
+			wantError:  errInvalidRequest,
+		},
+		{
+			name:       "error scope broader than subject token",
+			form:       exchange(url.Values{"subject_token": {"delegated.token"}, "scope": {"read write"}}),
+			wantStatus: http.StatusBadRequest,
+			wantError:  errInvalidScope,
+		},
+		{
+			name:       "error unsupported requested_token_type",
+			form:       exchange(url.Values{"subject_token": {"user.token"}, "requested_token_type": {"urn:ietf:params:oauth:token-type:refresh_token"}}),
+			wantStatus: http.StatusBadRequest,
+			wantError:  errInvalidRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuer := &MockTokenIssuer{}
+			s := newTestTokenServer(issuer)
+			s.Clients.Clients["client-1"].ExchangeAudiences = []string{"downstream"}
+			s.TokenVerifier = verifier
+
+			req := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+			s.tokenHandler(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("tokenHandler() status = %d, want %d, body = %s", rec.Code, tt.wantStatus, rec.Body.String())
+				return
+			}
+			if tt.wantError != "" {
+				var res oauthError
+				if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+					t.Fatal(err)
+				}
+				if res.Code != tt.wantError {
+					t.Errorf("tokenHandler() error = %v, want %v", res.Code, tt.wantError)
+				}
+				return
+			}
+
+			var res tokenResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			if res.IssuedTokenType != tokenTypeAccessToken || res.Scope != tt.wantScope || res.ExpiresIn > 600 {
+				t.Errorf("tokenHandler() response = %+v", res)
+			}
+
+			claims := issuer.Claims
+			if claims.Subject != "alice" || claims.Audience[0] != "downstream" || !claims.ExpiresAt.Equal(subjectExp) {
+				t.Errorf("tokenHandler() claims = %+v", claims)
+			}
+			got, _ := json.Marshal(claims.Extra["act"])
+			want, _ := json.Marshal(tt.wantAct)
+			if string(got) != string(want) {
+				t.Errorf("tokenHandler() act = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func Test_serverTokenVerifier_VerifyClaims(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const statusListURI = "http://localhost:8080/statuslist"
+
+	newTypedToken := func(typ, iss string, extra map[string]any) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, model.CustomClaims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    iss,
+				Subject:   "alice",
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			},
+			Extra: extra,
+		})
+		token.Header["kid"] = "key-001"
+		token.Header["typ"] = typ
+		s, err := token.SignedString(priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	newToken := func(iss string, extra map[string]any) string {
+		return newTypedToken("JWT", iss, extra)
+	}
+	withStatus := func(idx int, uri string) map[string]any {
+		return map[string]any{"status": model.StatusClaim{StatusList: model.StatusListReference{Idx: idx, URI: uri}}}
+	}
+
+	tests := []struct {
+		name           string
+		token          string
+		statusListFile string
+		lifecycle      *lifecycle.Manifest
+		wantErr        error
+		wantAnyErr     bool
+	}{
+		{
+			name:  "valid token",
+			token: newToken(defaultIssuerName, nil),
+		},
+		{
+			name:           "valid token with status",
+			token:          newToken(defaultIssuerName, withStatus(0, statusListURI)),
+			statusListFile: "statuslist.json",
+		},
+		{
+			name:           "revoked token",
+			token:          newToken(defaultIssuerName, withStatus(1, statusListURI)),
+			statusListFile: "statuslist.json",
+			wantErr:        verify.ErrTokenRevoked,
+		},
+		{
+			name:           "suspended token",
+			token:          newToken(defaultIssuerName, withStatus(2, statusListURI)),
+			statusListFile: "statuslist.json",
+			wantErr:        verify.ErrTokenSuspended,
+		},
+		{
+			name:           "status list of other server",
+			token:          newToken(defaultIssuerName, withStatus(0, "https://other.example.com/statuslist")),
+			statusListFile: "statuslist.json",
+			wantAnyErr:     true,
+		},
+		{
+			name:       "status list is not served",
+			token:      newToken(defaultIssuerName, withStatus(0, statusListURI)),
+			wantAnyErr: true,
+		},
+		{
+			name:       "token from other issuer",
+			token:      newToken("other_issuer", nil),
+			wantAnyErr: true,
+		},
+		{
+			name:       "token bound to a DPoP key",
+			token:      newToken(defaultIssuerName, map[string]any{"cnf": model.Confirmation{JKT: "thumbprint"}}),
+			wantAnyErr: true,
+		},
+		{
+			name:       "token bound to a client certificate",
+			token:      newToken(defaultIssuerName, map[string]any{"cnf": model.Confirmation{X5tS256: "thumbprint"}}),
+			wantAnyErr: true,
+		},
+		{
+			name:       "status list token",
+			token:      newTypedToken(model.StatusListTokenType, defaultIssuerName, nil),
+			wantAnyErr: true,
+		},
+		{
+			name:       "introspection response token",
+			token:      newTypedToken("token-introspection+jwt", defaultIssuerName, nil),
+			wantAnyErr: true,
+		},
+		{
+			name:       "token signed by revoked key",
+			token:      newToken(defaultIssuerName, nil),
+			lifecycle:  &lifecycle.Manifest{Keys: map[string]*lifecycle.Metadata{"key-001": {Status: lifecycle.StateRevoked}}},
+			wantAnyErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestTokenServer(&MockTokenIssuer{})
+			s.publicKeys = map[string]crypto.PublicKey{"key-001": pub}
+			s.Lifecycle = tt.lifecycle
+			s.FileOperator = &MockStatusFileOperator{Content: []byte(`{"bits":2,"statuses":[0,1,2],"jtis":{}}`)}
+			s.StatusListFile = tt.statusListFile
+			s.StatusListURI = statusListURI
+
+			v := &serverTokenVerifier{s: s}
+			claims, err := v.VerifyClaims(tt.token)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("VerifyClaims() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if (err != nil) != tt.wantAnyErr {
+				t.Errorf("VerifyClaims() error = %v, wantAnyErr %v", err, tt.wantAnyErr)
+				return
+			}
+			if err == nil && claims.Subject != "alice" {
+				t.Errorf("VerifyClaims() sub = %s, want alice", claims.Subject)
+			}
+		})
+	}
+}
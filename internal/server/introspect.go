@@ -0,0 +1,186 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jwks_demo/internal/issue"
+	"github.com/jwks_demo/internal/model"
+)
+
+// introspectionJWTContentType は JWT 形式のイントロスペクションレスポンスのメディアタイプ (RFC 9701 Section 4)
+const introspectionJWTContentType = "application/token-introspection+jwt"
+
+// introspectHandler は POST /introspect を処理する (RFC 7662)
+func (s *Server) introspectHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, newOAuthError(http.StatusBadRequest, errInvalidRequest, "failed to parse request body"))
+		return
+	}
+
+	// イントロスペクションを要求するリソースサーバーもクライアントレジストリで認証する
+	c, oerr := s.authenticateClient(r)
+	if oerr != nil {
+		slog.Info("client authentication failed", "error", oerr)
+		writeOAuthError(w, oerr)
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		writeOAuthError(w, newOAuthError(http.StatusBadRequest, errInvalidRequest, "token is required"))
+		return
+	}
+
+	res := map[string]any{"active": false}
+	claims, err := s.validateToken(token)
+	if err != nil {
+		// 無効なトークンの詳細は呼び出し元に返さない (RFC 7662 Section 2.2)
+		slog.Info("introspected token is inactive", "client_id", c.ClientID, "error", err)
+	} else {
+		res, err = introspectionResponse(claims)
+		if err != nil {
+			slog.Error("failed to build introspection response", "error", err)
+			http.Error(w, "failed to build introspection response", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if s.IntrospectionJWT || acceptsIntrospectionJWT(r) {
+		s.writeIntrospectionJWT(w, c.ClientID, res)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		slog.Error("failed to encode response", "error", err)
+	}
+}
+
+// validateToken はこのサーバーが発行したトークンを公開中の鍵とステータスの保存ファイルで検証する
+func (s *Server) validateToken(tokenString string) (*model.CustomClaims, error) {
+	claims := &model.CustomClaims{}
+	if err := s.parseToken(tokenString, claims); err != nil {
+		return nil, err
+	}
+	if v, ok := claims.Extra["status"]; ok {
+		claim, err := parseStatusClaim(v)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.checkTokenStatus(claim); err != nil {
+			return nil, err
+		}
+	}
+	return claims, nil
+}
+
+// parseStatusClaim は Extra に格納された status クレームを StatusClaim に変換する
+func parseStatusClaim(v any) (*model.StatusClaim, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	claim := &model.StatusClaim{}
+	if err := json.Unmarshal(b, claim); err != nil {
+		return nil, fmt.Errorf("invalid status claim: %w", err)
+	}
+	return claim, nil
+}
+
+// parseToken はこのサーバーが発行したアクセストークンを公開中の鍵で検証し、クレームを claims に格納する
+// 同じ鍵で署名するステータスリストトークンやイントロスペクションレスポンスは typ ヘッダーで区別して受け付けない
+func (s *Server) parseToken(tokenString string, claims jwt.Claims) error {
+	token, err := jwt.ParseWithClaims(tokenString, claims, s.keyFunc, jwt.WithIssuer(s.IssuerName))
+	if err != nil {
+		return err
+	}
+	if typ, ok := token.Header["typ"]; ok {
+		if v, _ := typ.(string); !strings.EqualFold(v, "JWT") {
+			return fmt.Errorf("unexpected token type: %v", typ)
+		}
+	}
+	return nil
+}
+
+// keyFunc はトークンの kid に対応する公開中の鍵を返す
+func (s *Server) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, ok := token.Header["kid"].(string)
+	if !ok || kid == "" {
+		return nil, errors.New("kid header missing or not a string")
+	}
+	publicKey, ok := s.publicKeys[kid]
+	// 退役・失効した鍵で署名されたトークンは有効としない
+	if !ok || !s.visible(kid, time.Now()) {
+		return nil, fmt.Errorf("verification key not found for kid: %s", kid)
+	}
+	// alg は鍵の種類で使えるものに限る
+	if _, err := issue.SigningMethodForKey(publicKey, token.Method.Alg()); err != nil {
+		return nil, fmt.Errorf("unexpected signing method: %w", err)
+	}
+	return publicKey, nil
+}
+
+// introspectionResponse は有効なトークンのクレームからイントロスペクションレスポンスを作成する
+func introspectionResponse(claims *model.CustomClaims) (map[string]any, error) {
+	b, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+	res := map[string]any{}
+	if err := json.Unmarshal(b, &res); err != nil {
+		return nil, err
+	}
+	res["active"] = true
+	res["token_type"] = "Bearer"
+	return res, nil
+}
+
+// acceptsIntrospectionJWT はクライアントが JWT 形式のレスポンスを要求しているかどうかを返す
+func acceptsIntrospectionJWT(r *http.Request) bool {
+	for _, v := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(v))
+		if err == nil && mediaType == introspectionJWTContentType {
+			return true
+		}
+	}
+	return false
+}
+
+// writeIntrospectionJWT はイントロスペクションレスポンスを署名付き JWT で返す (RFC 9701 Section 5)
+func (s *Server) writeIntrospectionJWT(w http.ResponseWriter, audience string, res map[string]any) {
+	path, kid, err := s.signingKey()
+	if err != nil {
+		slog.Error("failed to get signing key", "error", err)
+		http.Error(w, "failed to sign introspection response", http.StatusInternalServerError)
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":                 s.IssuerName,
+		"aud":                 audience,
+		"iat":                 time.Now().Unix(),
+		"token_introspection": res,
+	}
+	header := map[string]any{"typ": "token-introspection+jwt"}
+	token, _, err := s.Issuer.Sign(path, kid, header, claims)
+	if err != nil {
+		slog.Error("failed to sign introspection response", "error", err)
+		http.Error(w, "failed to sign introspection response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", introspectionJWTContentType)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(token))
+}
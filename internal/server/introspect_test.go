@@ -0,0 +1,223 @@
+package server
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jwks_demo/internal/lifecycle"
+	"github.com/jwks_demo/internal/model"
+)
+
+func TestServer_introspectHandler(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const statusListURI = "http://localhost:8080/statuslist"
+
+	newSignedTokenWithHeader := func(method jwt.SigningMethod, key crypto.Signer, kid, iss string, exp time.Time, typ string, extra map[string]any) string {
+		claims := map[string]any{"scope": "read", "client_id": "client-1"}
+		for k, v := range extra {
+			claims[k] = v
+		}
+		token := jwt.NewWithClaims(method, model.CustomClaims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    iss,
+				Subject:   "client-1",
+				ExpiresAt: jwt.NewNumericDate(exp),
+			},
+			Extra: claims,
+		})
+		token.Header["kid"] = kid
+		token.Header["typ"] = typ
+		s, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	newSignedToken := func(method jwt.SigningMethod, key crypto.Signer, kid, iss string, exp time.Time) string {
+		return newSignedTokenWithHeader(method, key, kid, iss, exp, "JWT", nil)
+	}
+	withStatus := func(idx int) string {
+		status := model.StatusClaim{StatusList: model.StatusListReference{Idx: idx, URI: statusListURI}}
+		return newSignedTokenWithHeader(jwt.SigningMethodEdDSA, priv, "key-001", defaultIssuerName, time.Now().Add(time.Hour), "JWT", map[string]any{"status": status})
+	}
+	newToken := func(key ed25519.PrivateKey, iss string, exp time.Time) string {
+		return newSignedToken(jwt.SigningMethodEdDSA, key, "key-001", iss, exp)
+	}
+	validToken := newToken(priv, defaultIssuerName, time.Now().Add(time.Hour))
+
+	tests := []struct {
+		name             string
+		form             url.Values
+		accept           string
+		introspectionJWT bool
+		lifecycle        *lifecycle.Manifest
+		wantStatus       int
+		wantActive       bool
+		wantJWT          bool
+	}{
+		{
+			name:       "active token",
+			form:       url.Values{"token": {validToken}},
+			wantStatus: http.StatusOK,
+			wantActive: true,
+		},
+		{
+			name:       "expired token",
+			form:       url.Values{"token": {newToken(priv, defaultIssuerName, time.Now().Add(-time.Hour))}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "token signed by other key",
+			form:       url.Values{"token": {newToken(otherKey, defaultIssuerName, time.Now().Add(time.Hour))}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "token from other issuer",
+			form:       url.Values{"token": {newToken(priv, "other_issuer", time.Now().Add(time.Hour))}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "token signed by EC key",
+			form:       url.Values{"token": {newSignedToken(jwt.SigningMethodES256, ecKey, "key-ec", defaultIssuerName, time.Now().Add(time.Hour))}},
+			wantStatus: http.StatusOK,
+			wantActive: true,
+		},
+		{
+			name:       "alg does not match the key type",
+			form:       url.Values{"token": {newSignedToken(jwt.SigningMethodES256, ecKey, "key-001", defaultIssuerName, time.Now().Add(time.Hour))}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "jwt response by accept header",
+			form:       url.Values{"token": {validToken}},
+			accept:     "application/token-introspection+jwt",
+			wantStatus: http.StatusOK,
+			wantActive: true,
+			wantJWT:    true,
+		},
+		{
+			name:             "jwt response by server option",
+			form:             url.Values{"token": {validToken}},
+			introspectionJWT: true,
+			wantStatus:       http.StatusOK,
+			wantActive:       true,
+			wantJWT:          true,
+		},
+		{
+			name:       "token signed by revoked key",
+			form:       url.Values{"token": {validToken}},
+			lifecycle:  &lifecycle.Manifest{Keys: map[string]*lifecycle.Metadata{"key-001": {Status: lifecycle.StateRevoked}}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "token signed by retiring key",
+			form:       url.Values{"token": {validToken}},
+			lifecycle:  &lifecycle.Manifest{Keys: map[string]*lifecycle.Metadata{"key-001": {Status: lifecycle.StateRetiring}}},
+			wantStatus: http.StatusOK,
+			wantActive: true,
+		},
+		{
+			name:       "token with valid status",
+			form:       url.Values{"token": {withStatus(0)}},
+			wantStatus: http.StatusOK,
+			wantActive: true,
+		},
+		{
+			name:       "revoked token",
+			form:       url.Values{"token": {withStatus(1)}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "suspended token",
+			form:       url.Values{"token": {withStatus(2)}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "status list token",
+			form:       url.Values{"token": {newSignedTokenWithHeader(jwt.SigningMethodEdDSA, priv, "key-001", defaultIssuerName, time.Now().Add(time.Hour), model.StatusListTokenType, nil)}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "error missing token",
+			form:       url.Values{},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuer := &MockTokenIssuer{}
+			s := newTestTokenServer(issuer)
+			s.publicKeys = map[string]crypto.PublicKey{"key-001": pub, "key-ec": &ecKey.PublicKey}
+			s.IntrospectionJWT = tt.introspectionJWT
+			s.Lifecycle = tt.lifecycle
+			s.FileOperator = &MockStatusFileOperator{Content: []byte(`{"bits":2,"statuses":[0,1,2],"jtis":{}}`)}
+			s.StatusListFile = "statuslist.json"
+			s.StatusListURI = statusListURI
+
+			req := httptest.NewRequest(http.MethodPost, "/introspect", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.SetBasicAuth("client-1", "secret")
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			s.introspectHandler(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("introspectHandler() status = %d, want %d, body = %s", rec.Code, tt.wantStatus, rec.Body.String())
+				return
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			res := map[string]any{}
+			if tt.wantJWT {
+				if rec.Header().Get("Content-Type") != introspectionJWTContentType || rec.Body.String() != "mock.jwt.value" {
+					t.Errorf("introspectHandler() content-type = %s, body = %s", rec.Header().Get("Content-Type"), rec.Body.String())
+				}
+				if issuer.SignHeader["typ"] != "token-introspection+jwt" {
+					t.Errorf("introspectHandler() typ = %v", issuer.SignHeader["typ"])
+				}
+				claims := issuer.SignClaims.(jwt.MapClaims)
+				if claims["aud"] != "client-1" {
+					t.Errorf("introspectHandler() aud = %v, want client-1", claims["aud"])
+				}
+				res = claims["token_introspection"].(map[string]any)
+			} else if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+
+			if res["active"] != tt.wantActive {
+				t.Errorf("introspectHandler() active = %v, want %v", res["active"], tt.wantActive)
+			}
+			if tt.wantActive && (res["scope"] != "read" || res["client_id"] != "client-1" || res["sub"] != "client-1") {
+				t.Errorf("introspectHandler() response = %v", res)
+			}
+			if !tt.wantActive && len(res) != 1 {
+				t.Errorf("introspectHandler() inactive response has extra members: %v", res)
+			}
+		})
+	}
+}
@@ -1,5 +1,17 @@
 package server
 
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jwks_demo/internal/issue"
+	"github.com/jwks_demo/internal/model"
+	"github.com/jwks_demo/internal/verify"
+)
+
 // MockFileOperator は FileOperator インターフェースのモック実装です。
 type MockFileOperator struct {
 	ErrLoadTxtFile  error
@@ -27,3 +39,99 @@ func (m *MockFileOperator) GetFileNames(dirPath string) ([]string, error) {
 
 	return []string{"files/public/key-001.pem", "files/public/key-002.pem"}, nil
 }
+
+// MockTokenIssuer は TokenIssuer インターフェースのモック実装です。
+type MockTokenIssuer struct {
+	ErrIssue error
+
+	// 最後に Issue に渡された値
+	PrivateKeyPath string
+	Kid            string
+	Claims         *model.CustomClaims
+
+	// 最後に Sign に渡された値
+	SignHeader map[string]any
+	SignClaims jwt.Claims
+}
+
+// Issue は渡された値を記録し、固定のトークンを返します。
+func (m *MockTokenIssuer) Issue(privateKeyPath string, kid string, claims *model.CustomClaims) (*issue.IssuedToken, error) {
+	if m.ErrIssue != nil {
+		return nil, m.ErrIssue
+	}
+	m.PrivateKeyPath = privateKeyPath
+	m.Kid = kid
+	m.Claims = claims
+	return &issue.IssuedToken{
+		Token:  "mock.token.value",
+		Header: map[string]any{"alg": "EdDSA", "kid": kid, "typ": "JWT"},
+		Claims: claims,
+	}, nil
+}
+
+// Sign は渡された値を記録し、固定のトークンを返します。
+func (m *MockTokenIssuer) Sign(privateKeyPath string, kid string, header map[string]any, claims jwt.Claims) (string, map[string]any, error) {
+	if m.ErrIssue != nil {
+		return "", nil, m.ErrIssue
+	}
+	m.PrivateKeyPath = privateKeyPath
+	m.Kid = kid
+	m.SignHeader = header
+	m.SignClaims = claims
+	return "mock.jwt.value", header, nil
+}
+
+// MockStatusFileOperator はステータスリストの保存ファイルを返す FileOperator のモック実装です。
+// Content が nil の場合はファイルが存在しないものとして扱います。
+type MockStatusFileOperator struct {
+	Content []byte
+}
+
+func (m *MockStatusFileOperator) LoadTxtFile(filePath string) ([]byte, error) {
+	if m.Content == nil {
+		return nil, os.ErrNotExist
+	}
+	return m.Content, nil
+}
+
+func (m *MockStatusFileOperator) GetFileNames(dirPath string) ([]string, error) {
+	return nil, nil
+}
+
+// MockKeyDirFileOperator はディレクトリ内の鍵ファイルを返す FileOperator のモック実装です。
+// Files のキーはディレクトリからの相対パス (ファイル名) です。
+type MockKeyDirFileOperator struct {
+	Files map[string][]byte
+}
+
+func (m *MockKeyDirFileOperator) LoadTxtFile(filePath string) ([]byte, error) {
+	b, ok := m.Files[filepath.Base(filePath)]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return b, nil
+}
+
+func (m *MockKeyDirFileOperator) GetFileNames(dirPath string) ([]string, error) {
+	names := make([]string, 0, len(m.Files))
+	for name := range m.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// MockTokenVerifier は TokenVerifier インターフェースのモック実装です。
+// Claims に登録されたトークンのみを有効なトークンとして扱います。
+type MockTokenVerifier struct {
+	Claims map[string]*verify.MyCustomClaims
+}
+
+// VerifyClaims は登録されたクレームを返します。
+func (m *MockTokenVerifier) VerifyClaims(jwtString string) (*verify.MyCustomClaims, error) {
+	claims, ok := m.Claims[jwtString]
+	if !ok {
+		return nil, errors.New("token is invalid")
+	}
+	return claims, nil
+}
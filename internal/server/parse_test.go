@@ -1,6 +1,7 @@
 package server
 
 import (
+	"crypto"
 	"crypto/ed25519"
 	"fmt"
 	"reflect"
@@ -14,7 +15,7 @@ func Test_parsePemPublicKeyLine(t *testing.T) {
 	tests := []struct {
 		name    string
 		args    args
-		want    ed25519.PublicKey
+		want    crypto.PublicKey
 		wantErr bool
 	}{
 		{
@@ -37,6 +38,14 @@ MCowBQYDK2VwAyEAwYDYgYnwhxMfR9hE7isN1rWHubXvEW1EJ/gYirMuxyY=
 			name: "error case: invaild value",
 			args: args{pemLine: `-----BEGIN PUBLIC KEY-----
 XXXwBQYDK2VwAyEAwYDYgYnwhxMfR9hE7isN1rWHubXvEW1EJ/gYirMuxyY=
+-----END PUBLIC KEY-----`},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "error case: not a signing key",
+			args: args{pemLine: `-----BEGIN PUBLIC KEY-----
+MCowBQYDK2VuAyEAdQLquBbVT3apElGvEo9ycPYQLVfqvzr3dAWP2/zpA3M=
 -----END PUBLIC KEY-----`},
 			want:    nil,
 			wantErr: true,
@@ -2,8 +2,10 @@ package server
 
 import (
 	"context"
-	"encoding/base64"
+	"crypto"
+	"crypto/rsa"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -13,12 +15,22 @@ import (
 	"strings"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/mux"
+	"github.com/jwks_demo/internal/client"
+	"github.com/jwks_demo/internal/issue"
+	"github.com/jwks_demo/internal/jwe"
+	"github.com/jwks_demo/internal/jwk"
+	"github.com/jwks_demo/internal/lifecycle"
 	"github.com/jwks_demo/internal/model"
 )
 
 const defaultPublicKeyDir = "files/public"
+const defaultPrivateKeyDir = "files/private"
 const defaultTestKeyId = "key-001"
+const defaultIssuerName = "jwks_demo_issuer"
+const defaultTokenEndpointURL = "http://localhost:8080/token"
+const defaultTokenLifetime = 3600 * time.Second
 const ShutdownWait = 15 * time.Second
 
 type FileOperator interface {
@@ -26,19 +38,69 @@ type FileOperator interface {
 	GetFileNames(dirPath string) ([]string, error)
 }
 
+// TokenIssuer はトークンエンドポイントなどでトークンに署名する
+type TokenIssuer interface {
+	Issue(privateKeyPath string, kid string, claims *model.CustomClaims) (*issue.IssuedToken, error)
+	Sign(privateKeyPath string, kid string, header map[string]any, claims jwt.Claims) (string, map[string]any, error)
+}
+
 type Server struct {
-	FileOperator FileOperator
-	PublicKeyDir string
-	Port         int
+	FileOperator  FileOperator
+	PublicKeyDir  string
+	PrivateKeyDir string
+	Port          int
+
+	// トークンエンドポイントの設定 (Clients が nil の場合は無効)
+	Clients       *client.Registry
+	Issuer        TokenIssuer
+	IssuerName    string        // 発行するトークンの iss
+	SigningKid    string        // 署名に使う鍵の kid (空の場合は公開中の先頭の active な鍵)
+	TokenLifetime time.Duration // 発行するトークンの有効期限
+
+	// トークンエンドポイントの公開 URL
+	// private_key_jwt の client_assertion の aud として IssuerName とともに受け付ける
+	TokenEndpointURL string
+
+	// トークン交換 (RFC 8693) で subject_token / actor_token を検証する (nil の場合は起動時にこのサーバーの JWKS で検証するものを設定する)
+	TokenVerifier TokenVerifier
+
+	// true の場合はイントロスペクションのレスポンスを常に署名付き JWT で返す (RFC 9701)
+	IntrospectionJWT bool
+
+	// ステータスリストの設定 (StatusListFile が空の場合は無効)
+	StatusListFile string        // issue / status コマンドが更新するステータスの保存ファイル
+	StatusListURI  string        // ステータスリストトークンの sub (公開する URI)
+	StatusListTTL  time.Duration // ステータスリストトークンの ttl
+
+	// JWKS で公開する暗号化用の公開鍵 (use: "enc") のディレクトリ (空の場合は公開しない)
+	EncryptionKeyDir string
+
+	// 公開する鍵の kid の決め方 (nil の場合は拡張子なしのファイル名)
+	// issue コマンドと同じ設定にすることでトークンの kid と JWKS の kid が一致する
+	KidResolver *jwk.KidResolver
 
-	Keys []model.Key
+	// 署名用の鍵のライフサイクル (nil の場合は全ての鍵を常に公開する)
+	// JWKS ではリクエスト時点で公開すべき署名用の鍵 (pending, active, retiring) のみを返す
+	// 暗号化用の鍵 (use: "enc") はマニフェストの対象外で、常に公開する
+	Lifecycle *lifecycle.Manifest
+
+	Keys        []model.Key
+	keyFiles    map[string]string           // kid -> 鍵のファイル名
+	encKeyFiles map[string]string           // kid -> 暗号化用の鍵のファイル名
+	publicKeys  map[string]crypto.PublicKey // kid -> 公開鍵 (発行したトークンの検証に使う)
 }
 
 func NewServer(f FileOperator, port int) *Server {
 	return &Server{
-		FileOperator: f,
-		PublicKeyDir: defaultPublicKeyDir,
-		Port:         port,
+		FileOperator:  f,
+		PublicKeyDir:  defaultPublicKeyDir,
+		PrivateKeyDir: defaultPrivateKeyDir,
+		Port:          port,
+		Issuer:        issue.NewIssuer(f),
+		IssuerName:    defaultIssuerName,
+		TokenLifetime: defaultTokenLifetime,
+
+		TokenEndpointURL: defaultTokenEndpointURL,
 	}
 }
 
@@ -69,32 +131,136 @@ func (s *Server) RegistPublicKey() error {
 		}
 
 		keyPub, err := parsePemPublicKeyLine(string(pubKeyLine))
+		if errors.Is(err, issue.ErrUnsupportedSigningKey) {
+			// JWKS には署名に使える鍵 (Ed25519, EC, RSA) のみ公開する
+			slog.Warn("skipped public key that cannot be used for signing", "file_name", p, "error", err)
+			continue
+		}
 		if err != nil {
 			return err
 		}
 
-		// base64 に変換して登録
-		// kid = 拡張子なしファイル名
-		kid := getBaseFilename(p)
-		if kid == "" {
-			slog.Error("failed to get base filename. Maybe file_name is hidden filename.", "file_name", p)
-			return fmt.Errorf("failed to get base filename")
+		kid, err := s.keyID(p, keyPub)
+		if err != nil {
+			return err
+		}
+		// 同じ kid の鍵が複数あると検証に使う鍵を決められないため、公開しない
+		if dup, ok := s.keyFiles[kid]; ok {
+			slog.Error("duplicate kid in public key directory", "kid", kid, "file_name", p, "other_file_name", dup)
+			return fmt.Errorf("kid %s of %s is already used by %s", kid, p, dup)
 		}
 
-		key := NewEd25519key(kid, base64.RawURLEncoding.EncodeToString(keyPub))
+		key, err := signingJWK(kid, keyPub)
+		if err != nil {
+			return err
+		}
 		s.Keys = append(s.Keys, key)
-		slog.Info("loaded public key", "file_name", p, "key_length", len(key.X))
+		if s.keyFiles == nil {
+			s.keyFiles = make(map[string]string)
+			s.publicKeys = make(map[string]crypto.PublicKey)
+		}
+		s.keyFiles[kid] = p
+		s.publicKeys[kid] = keyPub
+		slog.Info("loaded public key", "file_name", p, "kid", kid, "kty", key.Kty, "alg", key.Alg)
+		if s.Lifecycle != nil && !s.Lifecycle.Listed(kid) {
+			slog.Warn("public key is not in the key manifest", "file_name", p, "kid", kid, "state", s.Lifecycle.State(kid, time.Now()))
+		}
 	}
 
 	return nil
 }
 
+// signingJWK は署名用の公開鍵を JWKS で公開する形式に変換する
+// RSA 鍵は RS* と PS* のどちらでも署名できるため alg を指定しない
+func signingJWK(kid string, pub crypto.PublicKey) (model.Key, error) {
+	alg := ""
+	if _, ok := pub.(*rsa.PublicKey); !ok {
+		method, err := issue.SigningMethodForKey(pub, "")
+		if err != nil {
+			return model.Key{}, err
+		}
+		alg = method.Alg()
+	}
+	return jwk.FromPublicKey(kid, pub, alg)
+}
+
+// RegistEncryptionKey は EncryptionKeyDir の公開鍵 (X25519 または RSA) を暗号化用の鍵として JWKS に登録する
+func (s *Server) RegistEncryptionKey() error {
+	if s.EncryptionKeyDir == "" {
+		return nil
+	}
+
+	encPath, err := s.FileOperator.GetFileNames(s.EncryptionKeyDir)
+	if err != nil {
+		slog.Error("failed to get encryption key file names", "error", err)
+		return err
+	}
+
+	for _, p := range encPath {
+		pubPem, err := s.FileOperator.LoadTxtFile(s.EncryptionKeyDir + "/" + p)
+		if err != nil {
+			slog.Error("failed to load encryption key file", "error", err)
+			return err
+		}
+
+		pub, err := jwe.ParsePublicKeyPEM(pubPem)
+		if err != nil {
+			return fmt.Errorf("failed to parse encryption key %s: %w", p, err)
+		}
+
+		kid, err := s.keyID(p, pub)
+		if err != nil {
+			return err
+		}
+		// JWKS の利用者が鍵を区別できるよう、署名用の鍵や他の暗号化用の鍵と同じ kid では公開しない
+		if dup, ok := s.keyFiles[kid]; ok {
+			slog.Error("kid of encryption key is used by a signing key", "kid", kid, "file_name", p, "other_file_name", dup)
+			return fmt.Errorf("kid %s of encryption key %s is already used by signing key %s", kid, p, dup)
+		}
+		if dup, ok := s.encKeyFiles[kid]; ok {
+			slog.Error("duplicate kid in encryption key directory", "kid", kid, "file_name", p, "other_file_name", dup)
+			return fmt.Errorf("kid %s of %s is already used by %s", kid, p, dup)
+		}
+
+		key, err := jwe.PublicJWK(kid, pub)
+		if err != nil {
+			return err
+		}
+		s.Keys = append(s.Keys, key)
+		if s.encKeyFiles == nil {
+			s.encKeyFiles = make(map[string]string)
+		}
+		s.encKeyFiles[kid] = p
+		slog.Info("loaded encryption key", "file_name", p, "kid", kid, "kty", key.Kty, "alg", key.Alg)
+	}
+
+	return nil
+}
+
+// keyID は鍵ファイル p の kid を返す
+// KidResolver が nil の場合は拡張子なしのファイル名を kid とする
+func (s *Server) keyID(p string, pub crypto.PublicKey) (string, error) {
+	if s.KidResolver != nil {
+		return s.KidResolver.Kid(p, pub)
+	}
+	kid := getBaseFilename(p)
+	if kid == "" {
+		slog.Error("failed to get base filename. Maybe file_name is hidden filename.", "file_name", p)
+		return "", fmt.Errorf("failed to get base filename")
+	}
+	return kid, nil
+}
+
 func (s *Server) Start() error {
 	// 公開鍵情報を取得
 	if err := s.RegistPublicKey(); err != nil {
 		slog.Error("failed to register public key", "error", err)
 		return err
 	}
+	if err := s.RegistEncryptionKey(); err != nil {
+		slog.Error("failed to register encryption key", "error", err)
+		return err
+	}
 
 	slog.Info("start JWKS server", "port", s.Port)
 
@@ -102,6 +268,16 @@ func (s *Server) Start() error {
 	r := mux.NewRouter()
 	r.HandleFunc("/", homeHandler)
 	r.HandleFunc("/.well-known/jwks.json", s.jwksHandler).Methods("GET")
+	if s.StatusListFile != "" {
+		r.HandleFunc("/statuslist", s.statusListHandler).Methods("GET")
+	}
+	if s.Clients != nil {
+		r.HandleFunc("/token", s.tokenHandler).Methods("POST")
+		r.HandleFunc("/introspect", s.introspectHandler).Methods("POST")
+		if s.TokenVerifier == nil {
+			s.TokenVerifier = &serverTokenVerifier{s: s}
+		}
+	}
 
 	srv := &http.Server{
 		Handler:      r,
@@ -146,7 +322,13 @@ func (s *Server) jwksHandler(w http.ResponseWriter, r *http.Request) {
 	response := model.Response{
 		Keys: []model.Key{},
 	}
-	response.Keys = append(response.Keys, s.Keys...)
+	now := time.Now()
+	for _, key := range s.Keys {
+		if key.Use == "sig" && !s.visible(key.Kid, now) {
+			continue
+		}
+		response.Keys = append(response.Keys, key)
+	}
 
 	if err := json.NewEncoder(w).Encode(response); err != nil {
 		slog.Error("failed to encode response", "error", err)
@@ -156,6 +338,11 @@ func (s *Server) jwksHandler(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// visible は now に kid の鍵を公開するかどうかを返す
+func (s *Server) visible(kid string, now time.Time) bool {
+	return s.Lifecycle == nil || s.Lifecycle.Visible(kid, now)
+}
+
 func getBaseFilename(path string) string {
 	// Get the filename with extension (e.g., "file.txt")
 	base := filepath.Base(path)
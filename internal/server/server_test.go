@@ -1,10 +1,24 @@
 package server
 
 import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
 	"errors"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"testing"
+	"time"
 
+	"github.com/jwks_demo/internal/jwk"
+	"github.com/jwks_demo/internal/lifecycle"
 	"github.com/jwks_demo/internal/model"
 )
 
@@ -110,6 +124,180 @@ func TestServer_RegistPublicKey(t *testing.T) {
 	}
 }
 
+func TestServer_RegistPublicKey_kidResolver(t *testing.T) {
+	// MockFileOperator が返す公開鍵の JWK Thumbprint
+	const thumbprint = "ntC-nAUpjYNctU02o3Rx-1Mv6Tw7Hn_8U6Uup5gmYG8"
+
+	tests := []struct {
+		name     string
+		resolver *jwk.KidResolver
+		wantKids []string
+		wantErr  bool
+	}{
+		{
+			name:     "filename",
+			wantKids: []string{"key-001", "key-002"},
+		},
+		{
+			name:     "override",
+			resolver: &jwk.KidResolver{Mode: jwk.KidModeThumbprint, Overrides: map[string]string{"key-002": "custom"}},
+			wantKids: []string{thumbprint, "custom"},
+		},
+		{
+			// 同じ鍵の 2 つのファイルは同じ thumbprint になる
+			name:     "error duplicate thumbprint",
+			resolver: &jwk.KidResolver{Mode: jwk.KidModeThumbprint},
+			wantErr:  true,
+		},
+		{
+			name:     "error override to an existing kid",
+			resolver: &jwk.KidResolver{Overrides: map[string]string{"key-002": "key-001"}},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{
+				FileOperator: &MockFileOperator{},
+				PublicKeyDir: "files/public",
+				KidResolver:  tt.resolver,
+			}
+			err := s.RegistPublicKey()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Server.RegistPublicKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			var kids []string
+			for _, key := range s.Keys {
+				kids = append(kids, key.Kid)
+			}
+			if !reflect.DeepEqual(kids, tt.wantKids) {
+				t.Errorf("Server.RegistPublicKey() kids = %v, want %v", kids, tt.wantKids)
+			}
+		})
+	}
+}
+
+func TestServer_RegistPublicKey_keyTypes(t *testing.T) {
+	publicPem := func(pub any) []byte {
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	}
+	edPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	x25519Key, _ := ecdh.X25519().GenerateKey(rand.Reader)
+
+	s := &Server{
+		FileOperator: &MockKeyDirFileOperator{Files: map[string][]byte{
+			"key-ed.pem":     publicPem(edPub),
+			"key-ec.pem":     publicPem(&ecKey.PublicKey),
+			"key-rsa.pem":    publicPem(&rsaKey.PublicKey),
+			"key-x25519.pem": publicPem(x25519Key.PublicKey()),
+		}},
+		PublicKeyDir: "files/public",
+	}
+	if err := s.RegistPublicKey(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 署名に使えない X25519 の鍵は公開しない
+	want := map[string]string{"key-ec": "EC P-384 ES384", "key-ed": "OKP Ed25519 EdDSA", "key-rsa": "RSA  "}
+	got := map[string]string{}
+	for _, key := range s.Keys {
+		if key.Use != "sig" {
+			t.Errorf("Server.RegistPublicKey() key = %+v", key)
+		}
+		got[key.Kid] = key.Kty + " " + key.Crv + " " + key.Alg
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Server.RegistPublicKey() keys = %v, want %v", got, want)
+	}
+	if _, ok := s.publicKeys["key-rsa"].(*rsa.PublicKey); !ok {
+		t.Errorf("Server.RegistPublicKey() publicKeys = %v", s.publicKeys)
+	}
+}
+
+func TestServer_RegistEncryptionKey(t *testing.T) {
+	x25519Key, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	x25519Der, _ := x509.MarshalPKIXPublicKey(x25519Key.PublicKey())
+	x25519Pem := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: x25519Der})
+	ed25519Pem := []byte(`-----BEGIN PUBLIC KEY-----
+MCowBQYDK2VwAyEAwYDYgYnwhxMfR9hE7isN1rWHubXvEW1EJ/gYirMuxyY=
+-----END PUBLIC KEY-----
+`)
+
+	tests := []struct {
+		name     string
+		dir      string
+		files    map[string][]byte
+		keyFiles map[string]string
+		wantKids []string
+		wantErr  bool
+	}{
+		{
+			name:     "X25519 key",
+			dir:      "files/enc",
+			files:    map[string][]byte{"enc-001.pem": x25519Pem},
+			wantKids: []string{"enc-001"},
+		},
+		{
+			name:  "disabled",
+			files: map[string][]byte{"enc-001.pem": x25519Pem},
+		},
+		{
+			name:    "error signing key in encryption key dir",
+			dir:     "files/enc",
+			files:   map[string][]byte{"enc-001.pem": x25519Pem, "key-001.pem": ed25519Pem},
+			wantErr: true,
+		},
+		{
+			name:     "error kid used by a signing key",
+			dir:      "files/enc",
+			files:    map[string][]byte{"key-001.pem": x25519Pem},
+			keyFiles: map[string]string{"key-001": "key-001.pem"},
+			wantErr:  true,
+		},
+		{
+			name:    "error duplicate kid in encryption key dir",
+			dir:     "files/enc",
+			files:   map[string][]byte{"enc-001.pem": x25519Pem, "enc-001.pub": x25519Pem},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{
+				FileOperator:     &MockKeyDirFileOperator{Files: tt.files},
+				EncryptionKeyDir: tt.dir,
+				keyFiles:         tt.keyFiles,
+			}
+			if err := s.RegistEncryptionKey(); (err != nil) != tt.wantErr {
+				t.Errorf("Server.RegistEncryptionKey() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			var kids []string
+			for _, key := range s.Keys {
+				if key.Use != "enc" || key.Crv != "X25519" || key.X == "" {
+					t.Errorf("Server.RegistEncryptionKey() key = %+v", key)
+				}
+				kids = append(kids, key.Kid)
+			}
+			if !reflect.DeepEqual(kids, tt.wantKids) {
+				t.Errorf("Server.RegistEncryptionKey() kids = %v, want %v", kids, tt.wantKids)
+			}
+		})
+	}
+}
+
 func Test_getBaseFilename(t *testing.T) {
 	type args struct {
 		path string
@@ -149,3 +337,59 @@ func Test_getBaseFilename(t *testing.T) {
 		})
 	}
 }
+
+func TestServer_jwksHandler_lifecycle(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	s := &Server{
+		Keys: []model.Key{
+			NewEd25519key("active", "x"),
+			NewEd25519key("pending", "x"),
+			NewEd25519key("retiring", "x"),
+			NewEd25519key("retired", "x"),
+			NewEd25519key("revoked", "x"),
+			NewEd25519key("unlisted", "x"),
+			{Kty: "OKP", Crv: "X25519", Kid: "enc-001", Use: "enc", Alg: "ECDH-ES", X: "x"},
+		},
+		Lifecycle: &lifecycle.Manifest{Keys: map[string]*lifecycle.Metadata{
+			"active":   {ActivateAt: &past},
+			"pending":  {ActivateAt: &future},
+			"retiring": {StopSigningAt: &past, RetireAt: &future},
+			"retired":  {RetireAt: &past},
+			"revoked":  {Status: lifecycle.StateRevoked},
+		}},
+	}
+
+	rec := httptest.NewRecorder()
+	s.jwksHandler(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+
+	var res model.Response
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	var kids []string
+	for _, k := range res.Keys {
+		kids = append(kids, k.Kid)
+	}
+	// マニフェストに無い署名用の鍵は default_status が無い場合は公開しない (暗号化用の鍵は対象外)
+	want := []string{"active", "pending", "retiring", "enc-001"}
+	if !reflect.DeepEqual(kids, want) {
+		t.Errorf("jwksHandler() kids = %v, want %v", kids, want)
+	}
+
+	s.Lifecycle.DefaultStatus = lifecycle.StateRetiring
+	rec = httptest.NewRecorder()
+	s.jwksHandler(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	res = model.Response{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	kids = nil
+	for _, k := range res.Keys {
+		kids = append(kids, k.Kid)
+	}
+	want = []string{"active", "pending", "retiring", "unlisted", "enc-001"}
+	if !reflect.DeepEqual(kids, want) {
+		t.Errorf("jwksHandler() with default_status kids = %v, want %v", kids, want)
+	}
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jwks_demo/internal/model"
+	"github.com/jwks_demo/internal/status"
+	"github.com/jwks_demo/internal/verify"
+)
+
+// statusListHandler は GET /statuslist でステータスリストトークンを返す
+func (s *Server) statusListHandler(w http.ResponseWriter, r *http.Request) {
+	// issue / status コマンドによる更新を反映するため、リクエストごとにファイルを読み込む
+	store, err := s.loadStatusStore()
+	if err != nil {
+		slog.Error("failed to load status list file", "error", err)
+		http.Error(w, "failed to load status list", http.StatusInternalServerError)
+		return
+	}
+
+	list, err := store.List()
+	if err != nil {
+		slog.Error("failed to build status list", "error", err)
+		http.Error(w, "failed to build status list", http.StatusInternalServerError)
+		return
+	}
+	encoded, err := list.Encode()
+	if err != nil {
+		slog.Error("failed to encode status list", "error", err)
+		http.Error(w, "failed to encode status list", http.StatusInternalServerError)
+		return
+	}
+
+	path, kid, err := s.signingKey()
+	if err != nil {
+		slog.Error("failed to get signing key", "error", err)
+		http.Error(w, "failed to sign status list", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	claims := &model.StatusListTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.IssuerName,
+			Subject:   s.StatusListURI,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.TokenLifetime)),
+		},
+		TTL:        int64(s.StatusListTTL.Seconds()),
+		StatusList: *encoded,
+	}
+	header := map[string]any{"typ": model.StatusListTokenType}
+	token, _, err := s.Issuer.Sign(path, kid, header, claims)
+	if err != nil {
+		slog.Error("failed to sign status list", "error", err)
+		http.Error(w, "failed to sign status list", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", model.StatusListTokenMediaType)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(token))
+}
+
+// loadStatusStore はステータスの保存ファイルを読み込む。ファイルが無い場合は空のストアを返す
+func (s *Server) loadStatusStore() (*status.Store, error) {
+	b, err := s.FileOperator.LoadTxtFile(s.StatusListFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return status.NewStore(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return status.ParseStore(b)
+}
+
+// checkTokenStatus はトークンの status クレームをこのサーバーのステータスの保存ファイルで確認する
+// status クレームが無いトークンは有効として扱う
+func (s *Server) checkTokenStatus(claim *model.StatusClaim) error {
+	if claim == nil {
+		return nil
+	}
+	ref := claim.StatusList
+	if s.StatusListFile == "" || ref.URI != s.StatusListURI {
+		return fmt.Errorf("status list is not served by this server: %s", ref.URI)
+	}
+	store, err := s.loadStatusStore()
+	if err != nil {
+		return fmt.Errorf("failed to load status list: %w", err)
+	}
+	list, err := store.List()
+	if err != nil {
+		return fmt.Errorf("failed to build status list: %w", err)
+	}
+	value, err := list.Get(ref.Idx)
+	if err != nil {
+		return err
+	}
+	switch value {
+	case status.Valid:
+		return nil
+	case status.Invalid:
+		return verify.ErrTokenRevoked
+	case status.Suspended:
+		return verify.ErrTokenSuspended
+	}
+	return fmt.Errorf("unknown token status: %d", value)
+}
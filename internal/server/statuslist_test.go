@@ -0,0 +1,81 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jwks_demo/internal/model"
+	"github.com/jwks_demo/internal/status"
+)
+
+func TestServer_statusListHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		fileOp     FileOperator
+		issueErr   error
+		wantStatus int
+	}{
+		{
+			name:       "normal",
+			fileOp:     &MockStatusFileOperator{Content: []byte(`{"bits":2,"statuses":[0,1,2],"jtis":{}}`)},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "status list file does not exist",
+			fileOp:     &MockStatusFileOperator{},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "error invalid status list file",
+			fileOp:     &MockStatusFileOperator{Content: []byte(`{"bits":3}`)},
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name:       "error load file",
+			fileOp:     &MockFileOperator{ErrLoadTxtFile: errors.New("error")},
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name:       "error sign",
+			fileOp:     &MockStatusFileOperator{},
+			issueErr:   errors.New("error"),
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuer := &MockTokenIssuer{ErrIssue: tt.issueErr}
+			s := newTestTokenServer(issuer)
+			s.FileOperator = tt.fileOp
+			s.StatusListFile = "statuslist.json"
+			s.StatusListURI = "http://localhost:8080/statuslist"
+
+			rec := httptest.NewRecorder()
+			s.statusListHandler(rec, httptest.NewRequest(http.MethodGet, "/statuslist", nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("statusListHandler() status = %d, want %d", rec.Code, tt.wantStatus)
+				return
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			if rec.Header().Get("Content-Type") != model.StatusListTokenMediaType {
+				t.Errorf("statusListHandler() content-type = %s", rec.Header().Get("Content-Type"))
+			}
+			if issuer.SignHeader["typ"] != model.StatusListTokenType {
+				t.Errorf("statusListHandler() typ = %v", issuer.SignHeader["typ"])
+			}
+			claims := issuer.SignClaims.(*model.StatusListTokenClaims)
+			if claims.Subject != s.StatusListURI {
+				t.Errorf("statusListHandler() sub = %v, want %v", claims.Subject, s.StatusListURI)
+			}
+			if _, err := status.Decode(&claims.StatusList); err != nil {
+				t.Errorf("statusListHandler() returns undecodable status list: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,267 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jwks_demo/internal/client"
+	"github.com/jwks_demo/internal/issue"
+	"github.com/jwks_demo/internal/model"
+)
+
+const grantTypeClientCredentials = "client_credentials"
+
+// RFC 6749 Section 5.2 のエラーコード
+const (
+	errInvalidRequest       = "invalid_request"
+	errInvalidClient        = "invalid_client"
+	errUnsupportedGrantType = "unsupported_grant_type"
+	errInvalidScope         = "invalid_scope"
+	errInvalidTarget        = "invalid_target" // RFC 8707 Section 2
+)
+
+// tokenResponse はトークンエンドポイントの成功レスポンス (RFC 6749 Section 5.1)
+type tokenResponse struct {
+	AccessToken     string `json:"access_token"`
+	IssuedTokenType string `json:"issued_token_type,omitempty"` // トークン交換の場合のみ (RFC 8693 Section 2.2.1)
+	TokenType       string `json:"token_type"`
+	ExpiresIn       int64  `json:"expires_in"`
+	Scope           string `json:"scope,omitempty"`
+}
+
+// oauthError はトークンエンドポイントのエラーレスポンス (RFC 6749 Section 5.2)
+type oauthError struct {
+	Status           int    `json:"-"`
+	Code             string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+	basicAuth        bool   // クライアントが Authorization ヘッダーで認証を試みたか
+}
+
+func (e *oauthError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.ErrorDescription)
+}
+
+func newOAuthError(status int, code, description string) *oauthError {
+	return &oauthError{Status: status, Code: code, ErrorDescription: description}
+}
+
+// tokenHandler は POST /token を処理する
+func (s *Server) tokenHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, newOAuthError(http.StatusBadRequest, errInvalidRequest, "failed to parse request body"))
+		return
+	}
+
+	c, oerr := s.authenticateClient(r)
+	if oerr != nil {
+		slog.Info("client authentication failed", "error", oerr)
+		writeOAuthError(w, oerr)
+		return
+	}
+
+	grantType := r.PostForm.Get("grant_type")
+	switch grantType {
+	case grantTypeClientCredentials:
+		s.clientCredentialsGrant(w, r, c)
+	case grantTypeTokenExchange:
+		s.tokenExchangeGrant(w, r, c)
+	case "":
+		writeOAuthError(w, newOAuthError(http.StatusBadRequest, errInvalidRequest, "grant_type is required"))
+	default:
+		writeOAuthError(w, newOAuthError(http.StatusBadRequest, errUnsupportedGrantType, fmt.Sprintf("grant_type %q is not supported", grantType)))
+	}
+}
+
+// authenticateClient は client_secret_basic、client_secret_post または private_key_jwt でクライアントを認証する
+func (s *Server) authenticateClient(r *http.Request) (*client.Client, *oauthError) {
+	if r.PostForm.Has("client_assertion") || r.PostForm.Has("client_assertion_type") {
+		return s.authenticateClientAssertion(r)
+	}
+
+	clientID, clientSecret, basic := r.BasicAuth()
+	method := client.AuthMethodClientSecretPost
+	if basic {
+		method = client.AuthMethodClientSecretBasic
+		// RFC 6749 Section 2.3.1: Basic 認証の値は application/x-www-form-urlencoded でエンコードされている
+		var err1, err2 error
+		clientID, err1 = url.QueryUnescape(clientID)
+		clientSecret, err2 = url.QueryUnescape(clientSecret)
+		if err1 != nil || err2 != nil {
+			return nil, &oauthError{Status: http.StatusUnauthorized, Code: errInvalidClient, ErrorDescription: "malformed client credentials", basicAuth: true}
+		}
+		if r.PostForm.Has("client_secret") {
+			return nil, newOAuthError(http.StatusBadRequest, errInvalidRequest, "multiple client authentication methods are used")
+		}
+	} else {
+		clientID = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+	}
+
+	if clientID == "" {
+		return nil, newOAuthError(http.StatusUnauthorized, errInvalidClient, "client authentication is required")
+	}
+
+	c, err := s.Clients.Authenticate(clientID, clientSecret, method)
+	if err != nil {
+		return nil, &oauthError{Status: http.StatusUnauthorized, Code: errInvalidClient, ErrorDescription: "client authentication failed", basicAuth: basic}
+	}
+	return c, nil
+}
+
+// authenticateClientAssertion は private_key_jwt でクライアントを認証する (RFC 7523 Section 2.2)
+func (s *Server) authenticateClientAssertion(r *http.Request) (*client.Client, *oauthError) {
+	if _, _, basic := r.BasicAuth(); basic || r.PostForm.Has("client_secret") {
+		return nil, newOAuthError(http.StatusBadRequest, errInvalidRequest, "multiple client authentication methods are used")
+	}
+	if r.PostForm.Get("client_assertion_type") != client.ClientAssertionTypeJWTBearer {
+		return nil, newOAuthError(http.StatusBadRequest, errInvalidRequest, "unsupported client_assertion_type")
+	}
+	assertion := r.PostForm.Get("client_assertion")
+	if assertion == "" {
+		return nil, newOAuthError(http.StatusBadRequest, errInvalidRequest, "client_assertion is required")
+	}
+
+	// aud には設定されたトークンエンドポイントの URL または発行者名を受け付ける
+	// リクエストの Host ヘッダーはクライアントが指定できるため使わない
+	audiences := []string{s.IssuerName}
+	if s.TokenEndpointURL != "" {
+		audiences = append(audiences, s.TokenEndpointURL)
+	}
+	c, err := s.Clients.AuthenticateAssertion(assertion, r.PostForm.Get("client_id"), audiences)
+	if err != nil {
+		slog.Info("client assertion is rejected", "error", err)
+		return nil, newOAuthError(http.StatusUnauthorized, errInvalidClient, "client authentication failed")
+	}
+	return c, nil
+}
+
+// clientCredentialsGrant は client_credentials グラントでトークンを発行する (RFC 6749 Section 4.4)
+func (s *Server) clientCredentialsGrant(w http.ResponseWriter, r *http.Request, c *client.Client) {
+	scopes := strings.Fields(r.PostForm.Get("scope"))
+	if len(scopes) == 0 {
+		scopes = c.Scopes
+	}
+	for _, scope := range scopes {
+		if !c.AllowsScope(scope) {
+			writeOAuthError(w, newOAuthError(http.StatusBadRequest, errInvalidScope, fmt.Sprintf("scope %q is not allowed for the client", scope)))
+			return
+		}
+	}
+
+	audiences := r.PostForm["audience"]
+	if len(audiences) == 0 {
+		audiences = c.Audiences
+	}
+	for _, aud := range audiences {
+		if !c.AllowsAudience(aud) {
+			writeOAuthError(w, newOAuthError(http.StatusBadRequest, errInvalidTarget, fmt.Sprintf("audience %q is not allowed for the client", aud)))
+			return
+		}
+	}
+
+	now := time.Now()
+	claims := &model.CustomClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.IssuerName,
+			Subject:   c.ClientID,
+			Audience:  jwt.ClaimStrings(audiences),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.TokenLifetime)),
+			ID:        issue.NewJTI(),
+		},
+		Extra: map[string]any{
+			"client_id": c.ClientID,
+		},
+	}
+	if len(scopes) > 0 {
+		claims.Extra["scope"] = strings.Join(scopes, " ")
+	}
+
+	issued, err := s.signToken(claims)
+	if err != nil {
+		slog.Error("failed to issue token", "client_id", c.ClientID, "error", err)
+		http.Error(w, "failed to issue token", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("issued token", "client_id", c.ClientID, "grant_type", grantTypeClientCredentials, "jti", claims.ID)
+	writeTokenResponse(w, tokenResponse{
+		AccessToken: issued.Token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(s.TokenLifetime.Seconds()),
+		Scope:       strings.Join(scopes, " "),
+	})
+}
+
+// signToken は JWKS で公開している鍵に対応する秘密鍵でクレームに署名する
+func (s *Server) signToken(claims *model.CustomClaims) (*issue.IssuedToken, error) {
+	path, kid, err := s.signingKey()
+	if err != nil {
+		return nil, err
+	}
+	return s.Issuer.Issue(path, kid, claims)
+}
+
+// signingKey は署名に使う秘密鍵のパスと kid を返す
+func (s *Server) signingKey() (path string, kid string, err error) {
+	kid = s.SigningKid
+	if kid == "" {
+		if len(s.Keys) == 0 {
+			return "", "", fmt.Errorf("no public key is registered")
+		}
+		if kid = s.activeKid(); kid == "" {
+			return "", "", fmt.Errorf("no published signing key is active")
+		}
+	}
+
+	fileName, ok := s.keyFiles[kid]
+	if !ok {
+		return "", "", fmt.Errorf("signing key is not published in JWKS: %s", kid)
+	}
+
+	return filepath.Join(s.PrivateKeyDir, fileName), kid, nil
+}
+
+// activeKid は公開中の署名用の鍵のうち、署名に使える先頭の鍵の kid を返す (無い場合は空)
+func (s *Server) activeKid() string {
+	now := time.Now()
+	for _, key := range s.Keys {
+		if _, ok := s.keyFiles[key.Kid]; !ok {
+			continue
+		}
+		if s.Lifecycle == nil || s.Lifecycle.CheckSigning(key.Kid, now) == nil {
+			return key.Kid
+		}
+	}
+	return ""
+}
+
+func writeTokenResponse(w http.ResponseWriter, res tokenResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		slog.Error("failed to encode response", "error", err)
+	}
+}
+
+func writeOAuthError(w http.ResponseWriter, e *oauthError) {
+	if e.basicAuth {
+		w.Header().Set("WWW-Authenticate", `Basic realm="jwks_demo"`)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(e.Status)
+	if err := json.NewEncoder(w).Encode(e); err != nil {
+		slog.Error("failed to encode response", "error", err)
+	}
+}
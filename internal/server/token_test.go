@@ -0,0 +1,360 @@
+package server
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jwks_demo/internal/client"
+	"github.com/jwks_demo/internal/lifecycle"
+	"github.com/jwks_demo/internal/model"
+)
+
+// "secret" を bcrypt (cost 4) でハッシュ化した値
+const testSecretHash = "$2a$04$0Z2czos2lTZXL/x4swnQx.eFuruRATHSJbK3vYUZdypJAO9.qMday"
+
+func newTestTokenServer(issuer TokenIssuer) *Server {
+	return &Server{
+		PrivateKeyDir: "files/private",
+		Clients: &client.Registry{
+			Clients: map[string]*client.Client{
+				"client-1": {
+					ClientID:         "client-1",
+					ClientSecretHash: testSecretHash,
+					Scopes:           []string{"read", "write"},
+					Audiences:        []string{"api"},
+				},
+				"basic-client": {
+					ClientID:                "basic-client",
+					TokenEndpointAuthMethod: client.AuthMethodClientSecretBasic,
+					ClientSecretHash:        testSecretHash,
+					Scopes:                  []string{"read"},
+				},
+				// private_key_jwt で登録したクライアントはシークレットが分かっても認証できない
+				"pkjwt-client": {
+					ClientID:                "pkjwt-client",
+					TokenEndpointAuthMethod: client.AuthMethodPrivateKeyJWT,
+					ClientSecretHash:        testSecretHash,
+					Scopes:                  []string{"read"},
+				},
+			},
+		},
+		Issuer:        issuer,
+		IssuerName:    defaultIssuerName,
+		TokenLifetime: defaultTokenLifetime,
+		Keys:          []model.Key{NewEd25519key("key-001", "x")},
+		keyFiles:      map[string]string{"key-001": "key-001.pem"},
+	}
+}
+
+func TestServer_tokenHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		form       url.Values
+		basicAuth  []string
+		issueErr   error
+		wantStatus int
+		wantError  string
+		wantScope  string
+	}{
+		{
+			name:       "client_secret_post",
+			form:       url.Values{"grant_type": {"client_credentials"}, "client_id": {"client-1"}, "client_secret": {"secret"}, "scope": {"read"}},
+			wantStatus: http.StatusOK,
+			wantScope:  "read",
+		},
+		{
+			name:       "client_secret_basic with default scope",
+			form:       url.Values{"grant_type": {"client_credentials"}},
+			basicAuth:  []string{"client-1", "secret"},
+			wantStatus: http.StatusOK,
+			wantScope:  "read write",
+		},
+		{
+			name:       "error wrong secret",
+			form:       url.Values{"grant_type": {"client_credentials"}},
+			basicAuth:  []string{"client-1", "wrong"},
+			wantStatus: http.StatusUnauthorized,
+			wantError:  errInvalidClient,
+		},
+		{
+			name:       "error client_secret_post for client registered with client_secret_basic",
+			form:       url.Values{"grant_type": {"client_credentials"}, "client_id": {"basic-client"}, "client_secret": {"secret"}},
+			wantStatus: http.StatusUnauthorized,
+			wantError:  errInvalidClient,
+		},
+		{
+			name:       "error client secret for client registered with private_key_jwt",
+			form:       url.Values{"grant_type": {"client_credentials"}},
+			basicAuth:  []string{"pkjwt-client", "secret"},
+			wantStatus: http.StatusUnauthorized,
+			wantError:  errInvalidClient,
+		},
+		{
+			name:       "error no client authentication",
+			form:       url.Values{"grant_type": {"client_credentials"}},
+			wantStatus: http.StatusUnauthorized,
+			wantError:  errInvalidClient,
+		},
+		{
+			name:       "error multiple authentication methods",
+			form:       url.Values{"grant_type": {"client_credentials"}, "client_secret": {"secret"}},
+			basicAuth:  []string{"client-1", "secret"},
+			wantStatus: http.StatusBadRequest,
+			wantError:  errInvalidRequest,
+		},
+		{
+			name:       "error missing grant_type",
+			form:       url.Values{"client_id": {"client-1"}, "client_secret": {"secret"}},
+			wantStatus: http.StatusBadRequest,
+			wantError:  errInvalidRequest,
+		},
+		{
+			name:       "error unsupported grant_type",
+			form:       url.Values{"grant_type": {"password"}, "client_id": {"client-1"}, "client_secret": {"secret"}},
+			wantStatus: http.StatusBadRequest,
+			wantError:  errUnsupportedGrantType,
+		},
+		{
+			name:       "error scope not allowed",
+			form:       url.Values{"grant_type": {"client_credentials"}, "client_id": {"client-1"}, "client_secret": {"secret"}, "scope": {"read admin"}},
+			wantStatus: http.StatusBadRequest,
+			wantError:  errInvalidScope,
+		},
+		{
+			name:       "error audience not allowed",
+			form:       url.Values{"grant_type": {"client_credentials"}, "client_id": {"client-1"}, "client_secret": {"secret"}, "audience": {"other"}},
+			wantStatus: http.StatusBadRequest,
+			wantError:  errInvalidTarget,
+		},
+		{
+			name:       "error issue failed",
+			form:       url.Values{"grant_type": {"client_credentials"}, "client_id": {"client-1"}, "client_secret": {"secret"}},
+			issueErr:   errors.New("error"),
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuer := &MockTokenIssuer{ErrIssue: tt.issueErr}
+			s := newTestTokenServer(issuer)
+
+			req := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.basicAuth != nil {
+				req.SetBasicAuth(tt.basicAuth[0], tt.basicAuth[1])
+			}
+			rec := httptest.NewRecorder()
+			s.tokenHandler(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("tokenHandler() status = %d, want %d, body = %s", rec.Code, tt.wantStatus, rec.Body.String())
+				return
+			}
+
+			if tt.wantError != "" {
+				var res oauthError
+				if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+					t.Fatal(err)
+				}
+				if res.Code != tt.wantError {
+					t.Errorf("tokenHandler() error = %v, want %v", res.Code, tt.wantError)
+				}
+				if tt.basicAuth != nil && rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+					t.Errorf("tokenHandler() WWW-Authenticate header is missing")
+				}
+				return
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var res tokenResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			if res.AccessToken != "mock.token.value" || res.TokenType != "Bearer" || res.Scope != tt.wantScope {
+				t.Errorf("tokenHandler() response = %+v", res)
+			}
+			if issuer.PrivateKeyPath != "files/private/key-001.pem" || issuer.Kid != "key-001" {
+				t.Errorf("tokenHandler() signed with %s (kid = %s)", issuer.PrivateKeyPath, issuer.Kid)
+			}
+			if issuer.Claims.Subject != "client-1" || issuer.Claims.Extra["client_id"] != "client-1" {
+				t.Errorf("tokenHandler() claims = %+v", issuer.Claims)
+			}
+		})
+	}
+}
+
+func TestServer_tokenHandler_privateKeyJWT(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registryJSON := `{"clients":[{"client_id":"jwt-client","scopes":["read"],"jwks":{"keys":[` +
+		`{"kty":"OKP","crv":"Ed25519","kid":"client-key","use":"sig","alg":"EdDSA","x":"` + base64.RawURLEncoding.EncodeToString(pub) + `"}]}}]}`
+	registry, err := client.LoadRegistry(&client.MockFileOperator{Files: map[string][]byte{"clients.json": []byte(registryJSON)}}, "clients.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newAssertionFor := func(jti, aud string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.RegisteredClaims{
+			Issuer:    "jwt-client",
+			Subject:   "jwt-client",
+			Audience:  jwt.ClaimStrings{aud},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			ID:        jti,
+		})
+		token.Header["kid"] = "client-key"
+		s, err := token.SignedString(priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	newAssertion := func(jti string) string {
+		return newAssertionFor(jti, "https://as.example.com/token")
+	}
+	replayed := newAssertion("jti-replayed")
+
+	tests := []struct {
+		name       string
+		form       url.Values
+		wantStatus int
+		wantError  string
+	}{
+		{
+			name:       "normal",
+			form:       url.Values{"grant_type": {"client_credentials"}, "client_assertion_type": {client.ClientAssertionTypeJWTBearer}, "client_assertion": {replayed}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "issuer name as audience",
+			form:       url.Values{"grant_type": {"client_credentials"}, "client_assertion_type": {client.ClientAssertionTypeJWTBearer}, "client_assertion": {newAssertionFor("jti-iss", defaultIssuerName)}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			// リクエストの Host ヘッダーから組み立てた URL は aud として受け付けない
+			name:       "error audience from the request host",
+			form:       url.Values{"grant_type": {"client_credentials"}, "client_assertion_type": {client.ClientAssertionTypeJWTBearer}, "client_assertion": {newAssertionFor("jti-host", "http://example.com/token")}},
+			wantStatus: http.StatusUnauthorized,
+			wantError:  errInvalidClient,
+		},
+		{
+			name:       "error replayed assertion",
+			form:       url.Values{"grant_type": {"client_credentials"}, "client_assertion_type": {client.ClientAssertionTypeJWTBearer}, "client_assertion": {replayed}},
+			wantStatus: http.StatusUnauthorized,
+			wantError:  errInvalidClient,
+		},
+		{
+			name:       "error unsupported assertion type",
+			form:       url.Values{"grant_type": {"client_credentials"}, "client_assertion_type": {"urn:example"}, "client_assertion": {newAssertion("jti-1")}},
+			wantStatus: http.StatusBadRequest,
+			wantError:  errInvalidRequest,
+		},
+		{
+			name:       "error assertion with client_secret",
+			form:       url.Values{"grant_type": {"client_credentials"}, "client_assertion_type": {client.ClientAssertionTypeJWTBearer}, "client_assertion": {newAssertion("jti-2")}, "client_secret": {"secret"}},
+			wantStatus: http.StatusBadRequest,
+			wantError:  errInvalidRequest,
+		},
+		{
+			name:       "error client without secret uses client_secret_post",
+			form:       url.Values{"grant_type": {"client_credentials"}, "client_id": {"jwt-client"}, "client_secret": {""}},
+			wantStatus: http.StatusUnauthorized,
+			wantError:  errInvalidClient,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestTokenServer(&MockTokenIssuer{})
+			s.Clients = registry
+			s.TokenEndpointURL = "https://as.example.com/token"
+
+			req := httptest.NewRequest(http.MethodPost, "http://example.com/token", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+			s.tokenHandler(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("tokenHandler() status = %d, want %d, body = %s", rec.Code, tt.wantStatus, rec.Body.String())
+				return
+			}
+			if tt.wantError != "" {
+				var res oauthError
+				if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+					t.Fatal(err)
+				}
+				if res.Code != tt.wantError {
+					t.Errorf("tokenHandler() error = %v, want %v", res.Code, tt.wantError)
+				}
+			}
+		})
+	}
+}
+
+func TestServer_signingKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		signingKid string
+		lifecycle  *lifecycle.Manifest
+		wantKid    string
+		wantErr    bool
+	}{
+		{name: "first key", wantKid: "key-001"},
+		{
+			name: "skip key that is not active",
+			lifecycle: &lifecycle.Manifest{Keys: map[string]*lifecycle.Metadata{
+				"key-001": {Status: lifecycle.StateRetiring},
+				"key-002": {Status: lifecycle.StateActive},
+			}},
+			wantKid: "key-002",
+		},
+		{
+			name:      "skip key that is not in manifest",
+			lifecycle: &lifecycle.Manifest{Keys: map[string]*lifecycle.Metadata{"key-002": {Status: lifecycle.StateActive}}},
+			wantKid:   "key-002",
+		},
+		{
+			name:       "signing kid is left to the issuer",
+			signingKid: "key-001",
+			lifecycle:  &lifecycle.Manifest{Keys: map[string]*lifecycle.Metadata{"key-001": {Status: lifecycle.StateRetiring}}},
+			wantKid:    "key-001",
+		},
+		{
+			name: "error no active key",
+			lifecycle: &lifecycle.Manifest{Keys: map[string]*lifecycle.Metadata{
+				"key-001": {Status: lifecycle.StatePending},
+				"key-002": {Status: lifecycle.StateRevoked},
+			}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestTokenServer(&MockTokenIssuer{})
+			s.Keys = append(s.Keys, NewEd25519key("key-002", "x"))
+			s.keyFiles["key-002"] = "key-002.pem"
+			s.SigningKid = tt.signingKid
+			s.Lifecycle = tt.lifecycle
+
+			_, kid, err := s.signingKey()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("signingKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if kid != tt.wantKid {
+				t.Errorf("signingKey() kid = %v, want %v", kid, tt.wantKid)
+			}
+		})
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package status
+
+import "log/slog"
+
+// lockFile はファイルロックに対応していないプラットフォームではロックを取らない
+func lockFile(lockPath string) (func(), error) {
+	slog.Warn("status list lock is not supported on this platform", "path", lockPath)
+	return func() {}, nil
+}
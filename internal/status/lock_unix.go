@@ -0,0 +1,32 @@
+//go:build unix
+
+package status
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"syscall"
+)
+
+// lockFile は lockPath のファイルに排他ロック (flock) を取る
+func lockFile(lockPath string) (func(), error) {
+	f, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	fd := int(f.Fd())
+	err = syscall.Flock(fd, syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		slog.Info("waiting for another process to release the status list lock", "path", lockPath)
+		err = syscall.Flock(fd, syscall.LOCK_EX)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(fd, syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
@@ -0,0 +1,36 @@
+package status
+
+import "os"
+
+// MockFileOperator は FileOperator インターフェースのモック実装です。
+type MockFileOperator struct {
+	Files           map[string][]byte // filePath -> 内容
+	ErrLoadTxtFile  error
+	ErrWriteTxtFile error
+}
+
+// LoadTxtFile は Files に登録された内容を返します。
+// ErrLoadTxtFile が設定されていればそのエラーを返します。
+func (m *MockFileOperator) LoadTxtFile(filePath string) ([]byte, error) {
+	if m.ErrLoadTxtFile != nil {
+		return nil, m.ErrLoadTxtFile
+	}
+	b, ok := m.Files[filePath]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return b, nil
+}
+
+// WriteTxtFile は Files に内容を登録します。
+// ErrWriteTxtFile が設定されていればそのエラーを返します。
+func (m *MockFileOperator) WriteTxtFile(filePath string, data []byte, perm os.FileMode) error {
+	if m.ErrWriteTxtFile != nil {
+		return m.ErrWriteTxtFile
+	}
+	if m.Files == nil {
+		m.Files = make(map[string][]byte)
+	}
+	m.Files[filePath] = data
+	return nil
+}
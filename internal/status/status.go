@@ -0,0 +1,122 @@
+package status
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"fmt"
+	"io"
+
+	"github.com/jwks_demo/internal/model"
+)
+
+// ステータスの値
+const (
+	Valid     byte = 0x00
+	Invalid   byte = 0x01 // 失効済み
+	Suspended byte = 0x02 // 一時停止中
+)
+
+// MaxListSize はステータスリストに格納できるステータスの最大数
+// 受け取ったステータスリストの展開後のサイズもこの数から決まる上限を超えないようにする (zip bomb 対策)
+const MaxListSize = 1 << 24
+
+// maxListBytes は bits ビットのステータスを MaxListSize 個格納したリストのバイト数
+func maxListBytes(bits int) int64 {
+	return (int64(MaxListSize)*int64(bits) + 7) / 8
+}
+
+// List はビット単位で詰めたステータスのリスト
+type List struct {
+	Bits  int    // 1 つのステータスのビット数
+	Bytes []byte // ステータスのバイト列
+}
+
+// NewList は size 個のステータスを格納できる空のリストを作成する
+func NewList(bits, size int) (*List, error) {
+	if !validBits(bits) {
+		return nil, fmt.Errorf("invalid bits: %d (must be 1, 2, 4 or 8)", bits)
+	}
+	if size > MaxListSize {
+		return nil, fmt.Errorf("status list size %d exceeds the maximum %d", size, MaxListSize)
+	}
+	return &List{Bits: bits, Bytes: make([]byte, (size*bits+7)/8)}, nil
+}
+
+func validBits(bits int) bool {
+	return bits == 1 || bits == 2 || bits == 4 || bits == 8
+}
+
+// Len はリストに格納できるステータスの数を返す
+func (l *List) Len() int {
+	return len(l.Bytes) * 8 / l.Bits
+}
+
+// Get は idx のステータスを返す
+func (l *List) Get(idx int) (byte, error) {
+	if idx < 0 || idx >= l.Len() {
+		return 0, fmt.Errorf("status index out of range: %d", idx)
+	}
+	pos := idx * l.Bits
+	mask := byte(1<<l.Bits - 1)
+	return (l.Bytes[pos/8] >> (pos % 8)) & mask, nil
+}
+
+// Set は idx のステータスを value に設定する
+func (l *List) Set(idx int, value byte) error {
+	if idx < 0 || idx >= l.Len() {
+		return fmt.Errorf("status index out of range: %d", idx)
+	}
+	mask := byte(1<<l.Bits - 1)
+	if value > mask {
+		return fmt.Errorf("status value %d does not fit in %d bits", value, l.Bits)
+	}
+	pos := idx * l.Bits
+	l.Bytes[pos/8] = l.Bytes[pos/8]&^(mask<<(pos%8)) | value<<(pos%8)
+	return nil
+}
+
+// Encode はリストを status_list クレームの形式 (zlib + base64url) に変換する
+func (l *List) Encode() (*model.StatusList, error) {
+	var buf bytes.Buffer
+	w, err := zlib.NewWriterLevel(&buf, zlib.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(l.Bytes); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return &model.StatusList{
+		Bits: l.Bits,
+		Lst:  base64.RawURLEncoding.EncodeToString(buf.Bytes()),
+	}, nil
+}
+
+// Decode は status_list クレームからリストを復元する
+// 展開後のサイズが MaxListSize 個のステータスを超える場合はエラーを返す
+func Decode(sl *model.StatusList) (*List, error) {
+	if !validBits(sl.Bits) {
+		return nil, fmt.Errorf("invalid bits: %d (must be 1, 2, 4 or 8)", sl.Bits)
+	}
+	compressed, err := base64.RawURLEncoding.DecodeString(sl.Lst)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode lst: %w", err)
+	}
+	r, err := zlib.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress lst: %w", err)
+	}
+	defer r.Close()
+	limit := maxListBytes(sl.Bits)
+	b, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress lst: %w", err)
+	}
+	if int64(len(b)) > limit {
+		return nil, fmt.Errorf("decompressed lst exceeds %d bytes (%d statuses of %d bits)", limit, MaxListSize, sl.Bits)
+	}
+	return &List{Bits: sl.Bits, Bytes: b}, nil
+}
@@ -0,0 +1,141 @@
+package status
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/jwks_demo/internal/model"
+)
+
+func TestList_SetGet(t *testing.T) {
+	// draft-ietf-oauth-status-list の 1 bit の例
+	statuses := []byte{1, 0, 0, 1, 1, 1, 0, 1, 1, 1, 0, 0, 0, 1, 0, 1}
+	l, err := NewList(1, len(statuses))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range statuses {
+		if err := l.Set(i, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := []byte{0xB9, 0xA3}; !reflect.DeepEqual(l.Bytes, want) {
+		t.Errorf("List.Bytes = %x, want %x", l.Bytes, want)
+	}
+
+	tests := []struct {
+		name    string
+		bits    int
+		idx     int
+		value   byte
+		wantErr bool
+	}{
+		{name: "2 bits", bits: 2, idx: 5, value: Suspended},
+		{name: "4 bits", bits: 4, idx: 3, value: 0x0F},
+		{name: "8 bits", bits: 8, idx: 7, value: 0xFF},
+		{name: "error value too large", bits: 2, idx: 0, value: 0x04, wantErr: true},
+		{name: "error index out of range", bits: 2, idx: 8, value: Invalid, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := NewList(tt.bits, 8)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = l.Set(tt.idx, tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("List.Set() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			for i := 0; i < l.Len(); i++ {
+				want := Valid
+				if i == tt.idx {
+					want = tt.value
+				}
+				if got, _ := l.Get(i); got != want {
+					t.Errorf("List.Get(%d) = %d, want %d", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestList_EncodeDecode(t *testing.T) {
+	l, _ := NewList(2, 12)
+	l.Set(0, Invalid)
+	l.Set(11, Suspended)
+
+	encoded, err := l.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Decode(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, l) {
+		t.Errorf("Decode(Encode()) = %+v, want %+v", decoded, l)
+	}
+
+	// draft-ietf-oauth-status-list の例
+	decoded, err = Decode(&model.StatusList{Bits: 1, Lst: "eNrbuRgAAhcBXQ"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0xB9, 0xA3}; !reflect.DeepEqual(decoded.Bytes, want) {
+		t.Errorf("Decode() = %x, want %x", decoded.Bytes, want)
+	}
+
+	if _, err := Decode(&model.StatusList{Bits: 3, Lst: encoded.Lst}); err == nil {
+		t.Errorf("Decode() with invalid bits should fail")
+	}
+	if _, err := Decode(&model.StatusList{Bits: 2, Lst: "invalid!"}); err == nil {
+		t.Errorf("Decode() with invalid lst should fail")
+	}
+}
+
+func TestDecode_sizeLimit(t *testing.T) {
+	compress := func(size int64) *model.StatusList {
+		var buf bytes.Buffer
+		w := zlib.NewWriter(&buf)
+		if _, err := io.CopyN(w, zeroReader{}, size); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return &model.StatusList{Bits: 1, Lst: base64.RawURLEncoding.EncodeToString(buf.Bytes())}
+	}
+
+	limit := maxListBytes(1)
+	got, err := Decode(compress(limit))
+	if err != nil {
+		t.Fatalf("Decode() of the maximum size error = %v", err)
+	}
+	if got.Len() != MaxListSize {
+		t.Errorf("Decode() len = %d, want %d", got.Len(), MaxListSize)
+	}
+
+	// 展開すると上限を超えるリストは展開を途中でやめてエラーにする
+	if _, err := Decode(compress(limit + 1)); err == nil {
+		t.Error("Decode() of a list over the maximum size succeeded")
+	}
+	if _, err := NewList(1, MaxListSize+1); err == nil {
+		t.Error("NewList() over the maximum size succeeded")
+	}
+}
+
+// zeroReader は 0 を無限に返す io.Reader
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
@@ -0,0 +1,165 @@
+package status
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/jwks_demo/internal/issue"
+	"github.com/jwks_demo/internal/model"
+)
+
+const defaultBits = 2 // VALID / INVALID / SUSPENDED を表現できるビット数
+
+type FileOperator interface {
+	LoadTxtFile(filePath string) ([]byte, error)
+	WriteTxtFile(filePath string, data []byte, perm os.FileMode) error
+}
+
+// Store は発行したトークンのステータスを保存するファイル
+type Store struct {
+	Bits     int            `json:"bits"`
+	Statuses []int          `json:"statuses"` // インデックス順のステータス
+	JTIs     map[string]int `json:"jtis"`     // jti -> インデックス
+
+	path         string
+	fileOperator FileOperator
+}
+
+// NewStore は空のストアを作成する
+func NewStore() *Store {
+	return &Store{
+		Bits: defaultBits,
+		JTIs: make(map[string]int),
+	}
+}
+
+// ParseStore は保存ファイルの内容からストアを復元する
+func ParseStore(b []byte) (*Store, error) {
+	s := NewStore()
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("failed to parse status list file: %w", err)
+	}
+	if !validBits(s.Bits) {
+		return nil, fmt.Errorf("invalid bits in status list file: %d", s.Bits)
+	}
+	if s.JTIs == nil {
+		s.JTIs = make(map[string]int)
+	}
+	return s, nil
+}
+
+// LoadStore はステータスの保存ファイルを読み込む。ファイルが存在しない場合は空のストアを返す
+func LoadStore(f FileOperator, path string) (*Store, error) {
+	b, err := f.LoadTxtFile(path)
+	var s *Store
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		slog.Info("status list file does not exist. a new one will be created", "path", path)
+		s = NewStore()
+	case err != nil:
+		return nil, err
+	default:
+		if s, err = ParseStore(b); err != nil {
+			return nil, err
+		}
+	}
+
+	s.path = path
+	s.fileOperator = f
+	return s, nil
+}
+
+// Lock は path のステータスの保存ファイルを読み込んでから保存するまでの間、他のプロセスによる更新を排他する
+// path に ".lock" を付けたファイルをロックし、他のプロセスがロックしている場合は解放されるまで待つ
+// 返した関数でロックを解放する。プロセスが終了した場合もロックは解放される
+func Lock(path string) (unlock func(), err error) {
+	return lockFile(path + ".lock")
+}
+
+// Save はストアをファイルに書き込む
+func (s *Store) Save() error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.fileOperator.WriteTxtFile(s.path, b, 0600)
+}
+
+// Attach はクレームに新しいインデックスを割り当て、status クレームを設定する
+// jti が設定されていない場合は新しい jti を生成する
+func (s *Store) Attach(claims *model.CustomClaims, uri string) error {
+	if claims.ID == "" {
+		claims.ID = issue.NewJTI()
+	}
+	if _, ok := s.JTIs[claims.ID]; ok {
+		return fmt.Errorf("jti is already registered in status list: %s", claims.ID)
+	}
+	if len(s.Statuses) >= MaxListSize {
+		return fmt.Errorf("status list is full (%d statuses)", MaxListSize)
+	}
+
+	idx := len(s.Statuses)
+	s.Statuses = append(s.Statuses, int(Valid))
+	s.JTIs[claims.ID] = idx
+
+	if claims.Extra == nil {
+		claims.Extra = map[string]any{}
+	}
+	claims.Extra["status"] = model.StatusClaim{
+		StatusList: model.StatusListReference{Idx: idx, URI: uri},
+	}
+	return nil
+}
+
+// Index は jti に割り当てられたインデックスを返す
+func (s *Store) Index(jti string) (int, error) {
+	idx, ok := s.JTIs[jti]
+	if !ok {
+		return 0, fmt.Errorf("jti is not registered in status list: %s", jti)
+	}
+	return idx, nil
+}
+
+// Set は idx のステータスを value に変更する
+// 失効 (INVALID) したトークンは元に戻せないため、INVALID 以外への変更は受け付けない
+func (s *Store) Set(idx int, value byte) error {
+	if idx < 0 || idx >= len(s.Statuses) {
+		return fmt.Errorf("status index out of range: %d", idx)
+	}
+	if value > byte(1<<s.Bits-1) {
+		return fmt.Errorf("status value %d does not fit in %d bits", value, s.Bits)
+	}
+	if byte(s.Statuses[idx]) == Invalid && value != Invalid {
+		return fmt.Errorf("status index %d is revoked and cannot be changed", idx)
+	}
+	s.Statuses[idx] = int(value)
+	return nil
+}
+
+// Reinstate は一時停止 (SUSPENDED) 中の idx のステータスを VALID に戻す
+func (s *Store) Reinstate(idx int) error {
+	if idx < 0 || idx >= len(s.Statuses) {
+		return fmt.Errorf("status index out of range: %d", idx)
+	}
+	if byte(s.Statuses[idx]) != Suspended {
+		return fmt.Errorf("status index %d is not suspended", idx)
+	}
+	return s.Set(idx, Valid)
+}
+
+// List はストアの内容からステータスリストを作成する
+func (s *Store) List() (*List, error) {
+	l, err := NewList(s.Bits, len(s.Statuses))
+	if err != nil {
+		return nil, err
+	}
+	for idx, v := range s.Statuses {
+		if err := l.Set(idx, byte(v)); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
@@ -0,0 +1,133 @@
+package status
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jwks_demo/internal/model"
+)
+
+func TestStore(t *testing.T) {
+	f := &MockFileOperator{}
+
+	// ファイルが存在しない場合は空のストアから始める
+	s, err := LoadStore(f, "statuslist.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := &model.CustomClaims{}
+	first.ID = "jti-1"
+	second := &model.CustomClaims{}
+	if err := s.Attach(first, "http://localhost:8080/statuslist"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Attach(second, "http://localhost:8080/statuslist"); err != nil {
+		t.Fatal(err)
+	}
+	if second.ID == "" {
+		t.Errorf("Store.Attach() should generate jti")
+	}
+	if got := second.Extra["status"].(model.StatusClaim).StatusList.Idx; got != 1 {
+		t.Errorf("Store.Attach() idx = %d, want 1", got)
+	}
+	if err := s.Attach(first, "http://localhost:8080/statuslist"); err == nil {
+		t.Errorf("Store.Attach() with registered jti should fail")
+	}
+
+	idx, err := s.Index("jti-1")
+	if err != nil || idx != 0 {
+		t.Fatalf("Store.Index() = %d, %v", idx, err)
+	}
+	if err := s.Set(idx, Invalid); err != nil {
+		t.Fatal(err)
+	}
+	// 失効したトークンは元に戻せない
+	if err := s.Set(idx, Valid); err == nil {
+		t.Errorf("Store.Set() on a revoked index should fail")
+	}
+	if err := s.Set(idx, Suspended); err == nil {
+		t.Errorf("Store.Set() on a revoked index should fail")
+	}
+	if err := s.Reinstate(idx); err == nil {
+		t.Errorf("Store.Reinstate() on a revoked index should fail")
+	}
+	if err := s.Set(5, Invalid); err == nil {
+		t.Errorf("Store.Set() with out of range index should fail")
+	}
+	if _, err := s.Index("unknown"); err == nil {
+		t.Errorf("Store.Index() with unknown jti should fail")
+	}
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 保存した内容を読み込み直してリストを作成する
+	s, err = LoadStore(f, "statuslist.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := l.Get(0); got != Invalid {
+		t.Errorf("List.Get(0) = %d, want %d", got, Invalid)
+	}
+	if got, _ := l.Get(1); got != Valid {
+		t.Errorf("List.Get(1) = %d, want %d", got, Valid)
+	}
+
+	// 一時停止したトークンだけを有効に戻せる
+	if err := s.Reinstate(1); err == nil {
+		t.Errorf("Store.Reinstate() on a valid index should fail")
+	}
+	if err := s.Set(1, Suspended); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Reinstate(1); err != nil {
+		t.Fatalf("Store.Reinstate() = %v", err)
+	}
+	if got := s.Statuses[1]; got != int(Valid) {
+		t.Errorf("Store.Reinstate() status = %d, want %d", got, Valid)
+	}
+
+	f.Files["invalid.json"] = []byte(`{"bits":3}`)
+	if _, err := LoadStore(f, "invalid.json"); err == nil {
+		t.Errorf("LoadStore() with invalid bits should fail")
+	}
+}
+
+func TestLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "statuslist.json")
+	unlock, err := Lock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 別のロックはロックが解放されるまで待つ
+	locked := make(chan struct{})
+	go func() {
+		unlock2, err := Lock(path)
+		if err != nil {
+			t.Error(err)
+			close(locked)
+			return
+		}
+		close(locked)
+		unlock2()
+	}()
+	select {
+	case <-locked:
+		t.Fatal("Lock() succeeded while another lock is held")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	unlock()
+	select {
+	case <-locked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Lock() did not succeed after the lock was released")
+	}
+}
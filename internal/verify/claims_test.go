@@ -0,0 +1,76 @@
+package verify
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jwks_demo/internal/model"
+)
+
+func TestVerifier_VerifyClaims(t *testing.T) {
+	_, issuerKey, _ := ed25519.GenerateKey(rand.Reader)
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	jwksBody, _ := json.Marshal(model.Response{Keys: []model.Key{
+		{Kty: "OKP", Crv: "Ed25519", Kid: "key-001", Use: "sig", Alg: "EdDSA", X: base64.RawURLEncoding.EncodeToString(issuerKey.Public().(ed25519.PublicKey))},
+	}})
+	newToken := func(key ed25519.PrivateKey, claims *MyCustomClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+		token.Header["kid"] = "key-001"
+		s, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	exp := jwt.NewNumericDate(time.Now().Add(time.Hour))
+	act := &model.Actor{Sub: "gateway", Act: &model.Actor{Sub: "frontend"}}
+
+	tests := []struct {
+		name    string
+		token   string
+		want    *MyCustomClaims
+		wantErr bool
+	}{
+		{
+			name:  "delegated token",
+			token: newToken(issuerKey, &MyCustomClaims{RegisteredClaims: jwt.RegisteredClaims{Subject: "alice", ExpiresAt: exp}, Scope: "read write", Act: act}),
+			want:  &MyCustomClaims{RegisteredClaims: jwt.RegisteredClaims{Subject: "alice"}, Scope: "read write", Act: act},
+		},
+		{
+			name:    "error signed by another key",
+			token:   newToken(otherKey, &MyCustomClaims{RegisteredClaims: jwt.RegisteredClaims{Subject: "alice", ExpiresAt: exp}}),
+			wantErr: true,
+		},
+		{
+			name:    "error expired",
+			token:   newToken(issuerKey, &MyCustomClaims{RegisteredClaims: jwt.RegisteredClaims{Subject: "alice", ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Hour))}}),
+			wantErr: true,
+		},
+		{
+			name:    "error bound to a DPoP key",
+			token:   newToken(issuerKey, &MyCustomClaims{RegisteredClaims: jwt.RegisteredClaims{Subject: "alice", ExpiresAt: exp}, Cnf: &model.Confirmation{JKT: "jkt"}}),
+			wantErr: true,
+		},
+	}
+	v := &Verifier{JWSTClient: &jwksClient{body: string(jwksBody)}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := v.VerifyClaims(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Verifier.VerifyClaims() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Subject != tt.want.Subject || got.Scope != tt.want.Scope || got.Act.Sub != tt.want.Act.Sub || got.Act.Act.Sub != tt.want.Act.Act.Sub {
+				t.Errorf("Verifier.VerifyClaims() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
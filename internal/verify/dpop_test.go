@@ -0,0 +1,173 @@
+package verify
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jwks_demo/internal/dpop"
+	"github.com/jwks_demo/internal/jwk"
+	"github.com/jwks_demo/internal/model"
+	"github.com/jwks_demo/internal/mtls"
+)
+
+// jwksClient は呼び出しごとに同じ JWKS を返す JWSTClient
+type jwksClient struct {
+	body string
+}
+
+func (c *jwksClient) Do(req *http.Request) (*http.Response, error) {
+	return NewMockHttpResponse(http.StatusOK, c.body), nil
+}
+
+func TestVerifier_VerifyDPoP(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	const uri = "https://rs.example.com/resource"
+
+	_, issuerKey, _ := ed25519.GenerateKey(rand.Reader)
+	jwksBody, _ := json.Marshal(model.Response{Keys: []model.Key{
+		{Kty: "OKP", Crv: "Ed25519", Kid: "key-001", Use: "sig", Alg: "EdDSA", X: base64.RawURLEncoding.EncodeToString(issuerKey.Public().(ed25519.PublicKey))},
+	}})
+
+	_, clientKey, _ := ed25519.GenerateKey(rand.Reader)
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	jkt, _ := jwk.Thumbprint(clientKey.Public())
+
+	newToken := func(cnf *model.Confirmation) string {
+		claims := &MyCustomClaims{RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour))}, Cnf: cnf}
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+		token.Header["kid"] = "key-001"
+		s, err := token.SignedString(issuerKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	newProof := func(key ed25519.PrivateKey, jti, htm, accessToken string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{
+			"jti": jti, "htm": htm, "htu": uri, "iat": now.Unix(), "ath": dpop.AccessTokenHash(accessToken),
+		})
+		token.Header["typ"] = dpop.ProofType
+		token.Header["jwk"] = model.Key{Kty: "OKP", Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(key.Public().(ed25519.PublicKey))}
+		s, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	bound := newToken(&model.Confirmation{JKT: jkt})
+	unbound := newToken(nil)
+
+	tests := []struct {
+		name    string
+		token   string
+		proof   string
+		method  string
+		wantOk  bool
+		wantErr bool
+	}{
+		{name: "valid", token: bound, proof: newProof(clientKey, "jti-1", "GET", bound), method: "GET", wantOk: true},
+		{name: "error replayed proof", token: bound, proof: newProof(clientKey, "jti-1", "GET", bound), method: "GET", wantErr: true},
+		{name: "error proof signed by another key", token: bound, proof: newProof(otherKey, "jti-2", "GET", bound), method: "GET", wantErr: true},
+		{name: "error htm mismatch", token: bound, proof: newProof(clientKey, "jti-3", "POST", bound), method: "GET", wantErr: true},
+		{name: "error ath for another token", token: bound, proof: newProof(clientKey, "jti-4", "GET", unbound), method: "GET", wantErr: true},
+		{name: "error token not bound", token: unbound, proof: newProof(clientKey, "jti-5", "GET", unbound), method: "GET", wantErr: true},
+	}
+
+	// リプレイを検知できるよう、すべてのケースで同じ Verifier を使う
+	v := &Verifier{JWSTClient: &jwksClient{body: string(jwksBody)}, clock: func() time.Time { return now }}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotOk, err := v.VerifyDPoP(tt.token, tt.proof, tt.method, uri)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Verifier.VerifyDPoP() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if gotOk != tt.wantOk {
+				t.Errorf("Verifier.VerifyDPoP() = %v, want %v", gotOk, tt.wantOk)
+			}
+		})
+	}
+
+	t.Run("error bound token without proof", func(t *testing.T) {
+		if ok, err := v.Verify(bound); ok || err == nil {
+			t.Errorf("Verifier.Verify() = %v, %v, want rejection", ok, err)
+		}
+		if ok, err := v.Verify(unbound); !ok || err != nil {
+			t.Errorf("Verifier.Verify() unbound = %v, %v, want ok", ok, err)
+		}
+	})
+}
+
+func TestVerifier_VerifyBound(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	const uri = "https://rs.example.com/resource"
+
+	_, issuerKey, _ := ed25519.GenerateKey(rand.Reader)
+	jwksBody, _ := json.Marshal(model.Response{Keys: []model.Key{
+		{Kty: "OKP", Crv: "Ed25519", Kid: "key-001", Use: "sig", Alg: "EdDSA", X: base64.RawURLEncoding.EncodeToString(issuerKey.Public().(ed25519.PublicKey))},
+	}})
+	_, clientKey, _ := ed25519.GenerateKey(rand.Reader)
+	jkt, _ := jwk.Thumbprint(clientKey.Public())
+	clientCert := newClientCert(t, "service-a")
+
+	// DPoP の鍵と証明書の両方に結び付けられたトークン
+	claims := &MyCustomClaims{
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour))},
+		Cnf:              &model.Confirmation{JKT: jkt, X5tS256: mtls.Thumbprint(clientCert)},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = "key-001"
+	bound, err := token.SignedString(issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newProof := func(jti string) string {
+		proof := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{
+			"jti": jti, "htm": "GET", "htu": uri, "iat": now.Unix(), "ath": dpop.AccessTokenHash(bound),
+		})
+		proof.Header["typ"] = dpop.ProofType
+		proof.Header["jwk"] = model.Key{Kty: "OKP", Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(clientKey.Public().(ed25519.PublicKey))}
+		s, err := proof.SignedString(clientKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	tests := []struct {
+		name   string
+		p      Presentation
+		wantOk bool
+	}{
+		{name: "proof and certificate", p: Presentation{DPoPProof: newProof("jti-1"), DPoPMethod: "GET", DPoPURI: uri, ClientCert: clientCert}, wantOk: true},
+		{name: "error proof only", p: Presentation{DPoPProof: newProof("jti-2"), DPoPMethod: "GET", DPoPURI: uri}},
+		{name: "error certificate only", p: Presentation{ClientCert: clientCert}},
+		{name: "error another certificate", p: Presentation{DPoPProof: newProof("jti-3"), DPoPMethod: "GET", DPoPURI: uri, ClientCert: newClientCert(t, "service-b")}},
+		{name: "error nothing presented"},
+	}
+	v := &Verifier{JWSTClient: &jwksClient{body: string(jwksBody)}, clock: func() time.Time { return now }}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotOk, err := v.VerifyBound(bound, tt.p)
+			if gotOk != tt.wantOk || (err == nil) != tt.wantOk {
+				t.Errorf("Verifier.VerifyBound() = %v, %v, want %v", gotOk, err, tt.wantOk)
+			}
+		})
+	}
+
+	t.Run("error single binding verifiers", func(t *testing.T) {
+		if ok, err := v.VerifyCertificateBound(bound, clientCert); ok || err == nil {
+			t.Errorf("Verifier.VerifyCertificateBound() = %v, %v, want rejection", ok, err)
+		}
+		if ok, err := v.VerifyDPoP(bound, newProof("jti-4"), "GET", uri); ok || err == nil {
+			t.Errorf("Verifier.VerifyDPoP() = %v, %v, want rejection", ok, err)
+		}
+	})
+}
@@ -0,0 +1,106 @@
+package verify
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jwks_demo/internal/model"
+	"github.com/jwks_demo/internal/mtls"
+)
+
+// newClientCert はテスト用の CA と、その CA が発行したクライアント証明書を作成する
+func newClientCert(t *testing.T, cn string) *x509.Certificate {
+	t.Helper()
+	caPub, caKey, _ := ed25519.GenerateKey(rand.Reader)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDer, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, caPub, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(caDer)
+
+	clientPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	clientTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, clientTemplate, ca, clientPub, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return cert
+}
+
+func TestVerifier_VerifyCertificateBound(t *testing.T) {
+	_, issuerKey, _ := ed25519.GenerateKey(rand.Reader)
+	jwksBody, _ := json.Marshal(model.Response{Keys: []model.Key{
+		{Kty: "OKP", Crv: "Ed25519", Kid: "key-001", Use: "sig", Alg: "EdDSA", X: base64.RawURLEncoding.EncodeToString(issuerKey.Public().(ed25519.PublicKey))},
+	}})
+	newToken := func(cnf *model.Confirmation) string {
+		claims := &MyCustomClaims{RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}, Cnf: cnf}
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+		token.Header["kid"] = "key-001"
+		s, err := token.SignedString(issuerKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	clientCert := newClientCert(t, "service-a")
+	otherCert := newClientCert(t, "service-b")
+	bound := newToken(&model.Confirmation{X5tS256: mtls.Thumbprint(clientCert)})
+	unbound := newToken(nil)
+
+	tests := []struct {
+		name    string
+		token   string
+		cert    *x509.Certificate
+		wantOk  bool
+		wantErr bool
+	}{
+		{name: "matching certificate", token: bound, cert: clientCert, wantOk: true},
+		{name: "error another certificate", token: bound, cert: otherCert, wantErr: true},
+		{name: "error no certificate", token: bound, wantErr: true},
+		{name: "error token not bound", token: unbound, cert: clientCert, wantErr: true},
+	}
+	v := &Verifier{JWSTClient: &jwksClient{body: string(jwksBody)}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotOk, err := v.VerifyCertificateBound(tt.token, tt.cert)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Verifier.VerifyCertificateBound() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if gotOk != tt.wantOk {
+				t.Errorf("Verifier.VerifyCertificateBound() = %v, want %v", gotOk, tt.wantOk)
+			}
+		})
+	}
+
+	t.Run("error bound token without certificate", func(t *testing.T) {
+		if ok, err := v.Verify(bound); ok || err == nil {
+			t.Errorf("Verifier.Verify() = %v, %v, want rejection", ok, err)
+		}
+	})
+}
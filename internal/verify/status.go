@@ -0,0 +1,129 @@
+package verify
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jwks_demo/internal/model"
+	"github.com/jwks_demo/internal/status"
+)
+
+const (
+	defaultStatusListTTL   = 5 * time.Minute // ttl が無いステータスリストのキャッシュ時間
+	maxStatusListTokenSize = 32 << 20        // 受け付けるステータスリストトークンの最大サイズ
+)
+
+var (
+	ErrTokenRevoked   = errors.New("token is revoked")
+	ErrTokenSuspended = errors.New("token is suspended")
+)
+
+type cachedStatusList struct {
+	list      *status.List
+	expiresAt time.Time
+}
+
+// checkStatus は status クレームが参照するステータスリストでトークンの状態を確認する
+func (v *Verifier) checkStatus(claim *model.StatusClaim) error {
+	ref := claim.StatusList
+	list, err := v.statusList(ref.URI)
+	if err != nil {
+		return fmt.Errorf("failed to get status list: %w", err)
+	}
+
+	value, err := list.Get(ref.Idx)
+	if err != nil {
+		return err
+	}
+	switch value {
+	case status.Valid:
+		return nil
+	case status.Invalid:
+		return ErrTokenRevoked
+	case status.Suspended:
+		return ErrTokenSuspended
+	}
+	return fmt.Errorf("unknown token status: %d", value)
+}
+
+// statusList はキャッシュ済みのステータスリストを返す。キャッシュが無いか期限切れの場合は取得する
+func (v *Verifier) statusList(uri string) (*status.List, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if c, ok := v.statusLists[uri]; ok && time.Now().Before(c.expiresAt) {
+		return c.list, nil
+	}
+
+	list, expiresAt, err := v.fetchStatusList(uri)
+	if err != nil {
+		return nil, err
+	}
+	if v.statusLists == nil {
+		v.statusLists = make(map[string]*cachedStatusList)
+	}
+	v.statusLists[uri] = &cachedStatusList{list: list, expiresAt: expiresAt}
+	return list, nil
+}
+
+// fetchStatusList はステータスリストトークンを取得して検証し、リストとキャッシュの期限を返す
+func (v *Verifier) fetchStatusList(uri string) (*status.List, time.Time, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	req := &http.Request{
+		Method: http.MethodGet,
+		URL:    u,
+		Header: http.Header{"Accept": []string{model.StatusListTokenMediaType}},
+	}
+
+	res, err := v.JWSTClient.Do(req)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, time.Time{}, fmt.Errorf("failed to fetch status list: status code %d", res.StatusCode)
+	}
+	resBody, err := io.ReadAll(io.LimitReader(res.Body, maxStatusListTokenSize+1))
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if len(resBody) > maxStatusListTokenSize {
+		return nil, time.Time{}, fmt.Errorf("status list token exceeds %d bytes", maxStatusListTokenSize)
+	}
+
+	// ステータスリストトークンもトークンと同じ JWKS の鍵で検証する
+	claims := &model.StatusListTokenClaims{}
+	token, err := jwt.ParseWithClaims(string(resBody), claims, v.keyFunc, jwt.WithSubject(uri))
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("invalid status list token: %w", err)
+	}
+	if typ, _ := token.Header["typ"].(string); typ != model.StatusListTokenType {
+		return nil, time.Time{}, fmt.Errorf("unexpected status list token typ: %q", typ)
+	}
+
+	list, err := status.Decode(&claims.StatusList)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	ttl := defaultStatusListTTL
+	if claims.TTL > 0 {
+		ttl = time.Duration(claims.TTL) * time.Second
+	}
+	expiresAt := time.Now().Add(ttl)
+	if claims.ExpiresAt != nil && claims.ExpiresAt.Before(expiresAt) {
+		expiresAt = claims.ExpiresAt.Time
+	}
+
+	slog.Info("fetched status list", "uri", uri, "bits", list.Bits, "size", list.Len())
+	return list, expiresAt, nil
+}
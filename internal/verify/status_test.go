@@ -0,0 +1,157 @@
+package verify
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jwks_demo/internal/model"
+	"github.com/jwks_demo/internal/status"
+)
+
+const testStatusListURI = "http://localhost:8080/statuslist"
+
+func newStatusListToken(t *testing.T, key ed25519.PrivateKey, typ, sub string) string {
+	t.Helper()
+	l, _ := status.NewList(2, 4)
+	l.Set(1, status.Invalid)
+	l.Set(2, status.Suspended)
+	encoded, err := l.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, &model.StatusListTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   sub,
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+		TTL:        300,
+		StatusList: *encoded,
+	})
+	token.Header["kid"] = "key-001"
+	token.Header["typ"] = typ
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestVerifier_checkStatus(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	validList := newStatusListToken(t, priv, model.StatusListTokenType, testStatusListURI)
+
+	tests := []struct {
+		name       string
+		idx        int
+		mockClient JWSTClient
+		wantErr    error
+		wantAnyErr bool
+	}{
+		{
+			name:       "valid",
+			idx:        0,
+			mockClient: &MockJWSTClient{Response: NewMockHttpResponse(http.StatusOK, validList)},
+		},
+		{
+			name:       "revoked",
+			idx:        1,
+			mockClient: &MockJWSTClient{Response: NewMockHttpResponse(http.StatusOK, validList)},
+			wantErr:    ErrTokenRevoked,
+		},
+		{
+			name:       "suspended",
+			idx:        2,
+			mockClient: &MockJWSTClient{Response: NewMockHttpResponse(http.StatusOK, validList)},
+			wantErr:    ErrTokenSuspended,
+		},
+		{
+			name:       "error index out of range",
+			idx:        100,
+			mockClient: &MockJWSTClient{Response: NewMockHttpResponse(http.StatusOK, validList)},
+			wantAnyErr: true,
+		},
+		{
+			name:       "error status list signed by other key",
+			mockClient: &MockJWSTClient{Response: NewMockHttpResponse(http.StatusOK, newStatusListToken(t, otherKey, model.StatusListTokenType, testStatusListURI))},
+			wantAnyErr: true,
+		},
+		{
+			name:       "error wrong typ",
+			mockClient: &MockJWSTClient{Response: NewMockHttpResponse(http.StatusOK, newStatusListToken(t, priv, "JWT", testStatusListURI))},
+			wantAnyErr: true,
+		},
+		{
+			name:       "error wrong sub",
+			mockClient: &MockJWSTClient{Response: NewMockHttpResponse(http.StatusOK, newStatusListToken(t, priv, model.StatusListTokenType, "http://example.com/other"))},
+			wantAnyErr: true,
+		},
+		{
+			name:       "error endpoint returns error status",
+			mockClient: &MockJWSTClient{Response: NewMockHttpResponse(http.StatusNotFound, "not found")},
+			wantAnyErr: true,
+		},
+		{
+			name:       "error http client error",
+			mockClient: &MockJWSTClient{Err: errors.New("network timeout")},
+			wantAnyErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &Verifier{
+				JWSTClient:        tt.mockClient,
+				trustedPublicKeys: map[string]crypto.PublicKey{"key-001": pub},
+			}
+			err := v.checkStatus(&model.StatusClaim{StatusList: model.StatusListReference{Idx: tt.idx, URI: testStatusListURI}})
+			if tt.wantAnyErr {
+				if err == nil {
+					t.Errorf("Verifier.checkStatus() error = nil, want error")
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verifier.checkStatus() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifier_statusList_cache(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockClient := &MockJWSTClient{Response: NewMockHttpResponse(http.StatusOK, newStatusListToken(t, priv, model.StatusListTokenType, testStatusListURI))}
+	v := &Verifier{
+		JWSTClient:        mockClient,
+		trustedPublicKeys: map[string]crypto.PublicKey{"key-001": pub},
+	}
+	if _, err := v.statusList(testStatusListURI); err != nil {
+		t.Fatal(err)
+	}
+
+	// キャッシュが有効な間は取得し直さない
+	mockClient.Response = nil
+	mockClient.Err = errors.New("should not be called")
+	if _, err := v.statusList(testStatusListURI); err != nil {
+		t.Errorf("Verifier.statusList() should use cache: %v", err)
+	}
+
+	// キャッシュが期限切れの場合は取得し直す
+	v.statusLists[testStatusListURI].expiresAt = time.Now().Add(-time.Second)
+	if _, err := v.statusList(testStatusListURI); err == nil {
+		t.Errorf("Verifier.statusList() should fetch again after the cache expires")
+	}
+}
@@ -1,8 +1,9 @@
 package verify
 
 import (
+	"crypto"
 	"crypto/ed25519"
-	"encoding/base64"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,18 +11,48 @@ import (
 	"log/slog"
 	"net/http"
 	"net/url"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/jwks_demo/internal/dpop"
+	"github.com/jwks_demo/internal/issue"
+	"github.com/jwks_demo/internal/jwe"
+	"github.com/jwks_demo/internal/jwk"
 	"github.com/jwks_demo/internal/model"
+	"github.com/jwks_demo/internal/mtls"
 )
 
 type MyCustomClaims struct {
 	jwt.RegisteredClaims
+	Status *model.StatusClaim  `json:"status,omitempty"`
+	Cnf    *model.Confirmation `json:"cnf,omitempty"`
+
+	Scope    string       `json:"scope,omitempty"`
+	ClientID string       `json:"client_id,omitempty"`
+	Act      *model.Actor `json:"act,omitempty"` // トークン交換で委任を受けた主体 (RFC 8693)
 }
 
 type Verifier struct {
-	trustedPublicKeys map[string]ed25519.PublicKey // 検証に使う公開鍵を保持するマップ (kid -> PublicKey)
+	trustedPublicKeys map[string]crypto.PublicKey // 検証に使う公開鍵を保持するマップ (kid -> PublicKey)
+	trustedAlgs       map[string]string           // JWKS で alg が指定された鍵の alg (kid -> alg)
 	JWSTClient        JWSTClient
+
+	// true の場合は status クレームが参照するステータスリストを取得し、失効したトークンを拒否する
+	CheckStatus bool
+
+	// JWE で暗号化されたトークンの復号に使う秘密鍵 (X25519 または RSA)
+	DecryptionKey crypto.PrivateKey
+
+	// DPoP proof の iat と現在時刻の差として許容する最大値 (0 の場合は dpop.DefaultMaxAge)
+	DPoPMaxAge time.Duration
+
+	mu          sync.Mutex
+	statusLists map[string]*cachedStatusList // uri -> ステータスリスト
+	dpopJTIs    map[string]time.Time         // 使用済みの DPoP proof の jti -> 期限 (リプレイ検知)
+
+	clock func() time.Time // テスト用に差し替え可能な現在時刻
 }
 
 type JWSTClient interface {
@@ -30,7 +61,7 @@ type JWSTClient interface {
 
 func NewVerfier() *Verifier {
 	return &Verifier{
-		trustedPublicKeys: make(map[string]ed25519.PublicKey),
+		trustedPublicKeys: make(map[string]crypto.PublicKey),
 		JWSTClient:        &http.Client{},
 	}
 }
@@ -38,7 +69,10 @@ func NewVerfier() *Verifier {
 // テスト用初期化関数
 func (v *Verifier) LoadKeys() error {
 	if v.trustedPublicKeys == nil {
-		v.trustedPublicKeys = make(map[string]ed25519.PublicKey)
+		v.trustedPublicKeys = make(map[string]crypto.PublicKey)
+	}
+	if v.trustedAlgs == nil {
+		v.trustedAlgs = make(map[string]string)
 	}
 
 	url, _ := url.Parse("http://localhost:8080/.well-known/jwks.json")
@@ -71,72 +105,310 @@ func (v *Verifier) LoadKeys() error {
 		return fmt.Errorf("failed to Unmarshal response body: %w", err)
 	}
 
-	loadedKeys := 0
 	for _, key := range responseJWKS.Keys {
+		publicKey, err := parseSigningKey(key)
+		if err != nil {
+			slog.Info("Skipping key in JWKS", "kid", key.Kid, "kty", key.Kty, "crv", key.Crv, "use", key.Use, "reason", err)
+			continue
+		}
+		v.trustedPublicKeys[key.Kid] = publicKey
+		if key.Alg != "" {
+			v.trustedAlgs[key.Kid] = key.Alg
+		} else {
+			delete(v.trustedAlgs, key.Kid)
+		}
+		slog.Info("Successfully loaded public key from JWKS", "kid", key.Kid, "kty", key.Kty, "alg", key.Alg)
+	}
+
+	return nil
+}
+
+// parseSigningKey は JWKS の署名用の鍵 (Ed25519, EC, RSA) を公開鍵に変換する
+// issue が署名に使えない鍵や、alg が鍵の種類と合わない鍵はエラーを返す
+func parseSigningKey(key model.Key) (crypto.PublicKey, error) {
+	if key.Use != "sig" || key.Kid == "" {
+		return nil, errors.New("not a signing key with kid")
+	}
+	publicKey, err := jwk.PublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := issue.SigningMethodForKey(publicKey, key.Alg); err != nil {
+		return nil, err
+	}
+	return publicKey, nil
+}
+
+// ParseEd25519Keys は JWKS の鍵のうち署名用の Ed25519 鍵を kid -> PublicKey のマップに変換する
+// 不正な鍵や Ed25519 以外の鍵は読み飛ばす
+func ParseEd25519Keys(keys []model.Key) map[string]ed25519.PublicKey {
+	publicKeys := make(map[string]ed25519.PublicKey)
+	loadedKeys := 0
+	for _, key := range keys {
 		// Ed25519 キーのみを処理 (必要に応じて他のタイプもサポート)
 		if key.Kty == "OKP" && key.Crv == "Ed25519" && key.Use == "sig" && key.Kid != "" && key.X != "" {
-			// x パラメータ (base64urlエンコードされた公開鍵) をデコード
-			publicKeyBytes, err := base64.RawURLEncoding.DecodeString(key.X)
+			publicKey, err := jwk.ParseEd25519Key(key)
 			if err != nil {
-				slog.Warn("Failed to decode base64url public key 'x'", "kid", key.Kid, "error", err)
-				continue // 次のキーへ
-			}
-
-			// バイト数が Ed25519 公開鍵として正しいか確認 (オプションだが推奨)
-			if len(publicKeyBytes) != ed25519.PublicKeySize {
-				slog.Warn("Decoded public key has incorrect size for Ed25519", "kid", key.Kid, "expected_size", ed25519.PublicKeySize, "actual_size", len(publicKeyBytes))
+				slog.Warn("Failed to parse Ed25519 public key", "kid", key.Kid, "error", err)
 				continue // 次のキーへ
 			}
-
-			// デコードしたバイト列は ed25519.PublicKey 型として扱える
-			v.trustedPublicKeys[key.Kid] = ed25519.PublicKey(publicKeyBytes)
-			slog.Info("Successfully loaded Ed25519 public key from JWKS", "index", loadedKeys, "kid", key.Kid, "key_length", len(publicKeyBytes))
+			publicKeys[key.Kid] = publicKey
+			slog.Info("Successfully loaded Ed25519 public key from JWKS", "index", loadedKeys, "kid", key.Kid, "key_length", len(publicKey))
 			loadedKeys++
 		} else {
 			slog.Info("Skipping key in JWKS", "kid", key.Kid, "kty", key.Kty, "crv", key.Crv, "use", key.Use)
 		}
 	}
+	return publicKeys
+}
 
-	return nil
+// keyFunc はトークンの kid に対応する信頼済みの公開鍵を返す
+func (v *Verifier) keyFunc(token *jwt.Token) (interface{}, error) {
+	// ヘッダーからkidを取得
+	kid, ok := token.Header["kid"].(string)
+	if !ok || kid == "" {
+		slog.Warn("kid header missing or not a string")
+		return nil, errors.New("kid header missing or not a string")
+	}
+
+	// kidに対応する検証キーを取得
+	publicKey, ok := v.trustedPublicKeys[kid]
+	if !ok {
+		return nil, fmt.Errorf("verification key not found for kid: %s", kid)
+	}
+
+	// アルゴリズムの検証 (鍵の種類で使えるもの、JWKS で alg が指定されている場合はその alg に限る)
+	alg := token.Method.Alg()
+	if want, ok := v.trustedAlgs[kid]; ok && alg != want {
+		return nil, fmt.Errorf("unexpected signing method: %v (expected %v)", alg, want)
+	}
+	if _, err := issue.SigningMethodForKey(publicKey, alg); err != nil {
+		return nil, fmt.Errorf("unexpected signing method: %w", err)
+	}
+
+	return publicKey, nil
 }
 
+func (v *Verifier) now() time.Time {
+	if v.clock != nil {
+		return v.clock()
+	}
+	return time.Now()
+}
+
+// Verify はトークンを検証する
+// DPoP に結び付けられたトークン (cnf.jkt を持つトークン) は proof が無いため拒否する
 func (v *Verifier) Verify(jwtString string) (ok bool, err error) {
-	if err := v.LoadKeys(); err != nil {
-		slog.Error("failed to load keys", "error", err)
+	claims, ok, err := v.verifyToken(jwtString)
+	if !ok || err != nil {
+		return ok, err
+	}
+	if err := checkUnbound(claims); err != nil {
 		return false, err
 	}
+	return true, nil
+}
+
+// VerifyClaims は Verify と同じ検証を行い、有効なトークンのクレームを返す
+// 無効なトークンはエラーとして返す
+func (v *Verifier) VerifyClaims(jwtString string) (*MyCustomClaims, error) {
+	claims, ok, err := v.verifyToken(jwtString)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("token is invalid")
+	}
+	if err := checkUnbound(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// checkUnbound は鍵や証明書に結び付けられたトークンを、所持の証明なしに受け付けないようエラーを返す
+func checkUnbound(claims *MyCustomClaims) error {
+	if claims.Cnf != nil && claims.Cnf.JKT != "" {
+		return errors.New("token is bound to a DPoP key; a DPoP proof is required")
+	}
+	if claims.Cnf != nil && claims.Cnf.X5tS256 != "" {
+		return errors.New("token is bound to a client certificate; the presenting certificate is required")
+	}
+	return nil
+}
+
+// Presentation はトークンとともに提示された所持の証明
+// 提示されていない証明はゼロ値のままにする
+type Presentation struct {
+	DPoPProof  string            // リクエストとともに提示された DPoP proof (RFC 9449)
+	DPoPMethod string            // proof を提示したリクエストの HTTP メソッド
+	DPoPURI    string            // proof を提示したリクエストの URI
+	ClientCert *x509.Certificate // mTLS で提示されたクライアント証明書 (RFC 8705)
+}
+
+// VerifyBound は鍵や証明書に結び付けられたトークンを、提示された証明 p で検証する
+// トークンの cnf の全てのメンバー (jkt, x5t#S256) が証明されている必要がある
+// DPoP と証明書の両方に結び付けられたトークンは、proof と証明書の両方が無いと受け付けない
+func (v *Verifier) VerifyBound(jwtString string, p Presentation) (ok bool, err error) {
+	claims, ok, err := v.verifyToken(jwtString)
+	if !ok || err != nil {
+		return ok, err
+	}
+	cnf := claims.Cnf
+	if cnf == nil {
+		cnf = &model.Confirmation{}
+	}
+	if cnf.JKT == "" && cnf.X5tS256 == "" {
+		return false, errors.New("token is not bound to a DPoP key or a client certificate")
+	}
 
-	token, err := jwt.ParseWithClaims(jwtString, &MyCustomClaims{}, func(token *jwt.Token) (interface{}, error) {
-		// ヘッダーからkidを取得
-		kid, ok := token.Header["kid"].(string)
-		if !ok || kid == "" {
-			slog.Warn("kid header missing or not a string")
-			return nil, errors.New("kid header missing or not a string")
+	// 副作用の無い証明書の確認を先に行い、失敗した場合に proof の jti を使用済みにしない
+	if cnf.X5tS256 != "" || p.ClientCert != nil {
+		if err := checkCertificate(cnf, p.ClientCert); err != nil {
+			return false, err
+		}
+	}
+	if cnf.JKT != "" || p.DPoPProof != "" {
+		if err := v.checkDPoP(cnf, jwtString, p); err != nil {
+			return false, err
 		}
+	}
+	return true, nil
+}
+
+// VerifyCertificateBound は証明書に結び付けられたトークンを、mTLS で提示されたクライアント証明書 cert で検証する (RFC 8705)
+// 証明書の SHA-256 thumbprint がトークンの cnf["x5t#S256"] と一致する必要がある
+// 証明書チェーンの検証は TLS の終端で行われている前提とする
+func (v *Verifier) VerifyCertificateBound(jwtString string, cert *x509.Certificate) (ok bool, err error) {
+	return v.VerifyBound(jwtString, Presentation{ClientCert: cert})
+}
+
+// VerifyDPoP は DPoP に結び付けられたトークンを、リクエスト (method, uri) とともに提示された DPoP proof で検証する (RFC 9449)
+// proof の署名鍵の thumbprint がトークンの cnf.jkt と一致し、ath が提示されたトークンのハッシュと一致する必要がある
+func (v *Verifier) VerifyDPoP(jwtString, proof, method, uri string) (ok bool, err error) {
+	return v.VerifyBound(jwtString, Presentation{DPoPProof: proof, DPoPMethod: method, DPoPURI: uri})
+}
+
+// checkCertificate は提示されたクライアント証明書 cert の thumbprint がトークンの cnf["x5t#S256"] と一致するかを確認する
+func checkCertificate(cnf *model.Confirmation, cert *x509.Certificate) error {
+	if cnf.X5tS256 == "" {
+		return errors.New("token is not bound to a client certificate")
+	}
+	if cert == nil {
+		return errors.New("token is bound to a client certificate; the presenting certificate is required")
+	}
+	if thumbprint := mtls.Thumbprint(cert); thumbprint != cnf.X5tS256 {
+		return fmt.Errorf("client certificate thumbprint %s does not match the token cnf x5t#S256 %s", thumbprint, cnf.X5tS256)
+	}
+
+	slog.Info("client certificate matches the token", "x5t#S256", cnf.X5tS256, "subject", cert.Subject.String())
+	return nil
+}
+
+// checkDPoP は提示された DPoP proof を検証し、proof の鍵がトークンの cnf.jkt と一致するかを確認する
+func (v *Verifier) checkDPoP(cnf *model.Confirmation, jwtString string, p Presentation) error {
+	if cnf.JKT == "" {
+		return errors.New("token is not bound to a DPoP key")
+	}
+	if p.DPoPProof == "" {
+		return errors.New("token is bound to a DPoP key; a DPoP proof is required")
+	}
+
+	maxAge := v.DPoPMaxAge
+	if maxAge == 0 {
+		maxAge = dpop.DefaultMaxAge
+	}
+	now := v.now()
+	proof, err := dpop.ParseProof(p.DPoPProof, now, maxAge)
+	if err != nil {
+		return err
+	}
+	if err := proof.Check(p.DPoPMethod, p.DPoPURI, jwtString); err != nil {
+		return err
+	}
+	if proof.Thumbprint != cnf.JKT {
+		return fmt.Errorf("DPoP proof key %s does not match the token cnf.jkt %s", proof.Thumbprint, cnf.JKT)
+	}
+	if err := v.useDPoPJTI(proof.JTI, now, proof.IssuedAt.Add(maxAge)); err != nil {
+		return err
+	}
+
+	slog.Info("DPoP proof is valid", "jkt", proof.Thumbprint, "htm", proof.HTM, "htu", proof.HTU)
+	return nil
+}
 
-		// アルゴリズムの検証
-		if _, ok := token.Method.(*jwt.SigningMethodEd25519); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+// useDPoPJTI は proof の jti を使用済みとして記録し、期限内に同じ jti が使われた場合はエラーを返す
+func (v *Verifier) useDPoPJTI(jti string, now, expiresAt time.Time) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.dpopJTIs == nil {
+		v.dpopJTIs = make(map[string]time.Time)
+	}
+	for k, exp := range v.dpopJTIs {
+		if now.After(exp) {
+			delete(v.dpopJTIs, k)
 		}
+	}
+	if _, ok := v.dpopJTIs[jti]; ok {
+		return fmt.Errorf("DPoP proof jti has already been used: %s", jti)
+	}
+	v.dpopJTIs[jti] = expiresAt
+	return nil
+}
+
+// verifyToken はトークンの署名・有効期限・ステータスを検証し、クレームを返す
+func (v *Verifier) verifyToken(jwtString string) (claims *MyCustomClaims, ok bool, err error) {
+	if err := v.LoadKeys(); err != nil {
+		slog.Error("failed to load keys", "error", err)
+		return nil, false, err
+	}
 
-		// kidに対応する検証キーを取得
-		publicKey, ok := v.trustedPublicKeys[kid]
-		if !ok {
-			return nil, fmt.Errorf("verification key not found for kid: %s", kid)
+	// 入れ子の JWT (JWE) の場合は復号してから内側の JWS を検証する
+	if jwe.IsJWE(jwtString) {
+		if jwtString, err = v.decrypt(jwtString); err != nil {
+			return nil, false, err
 		}
+	}
 
-		return publicKey, nil
-	})
+	token, err := jwt.ParseWithClaims(jwtString, &MyCustomClaims{}, v.keyFunc)
 	if err != nil {
-		return false, err
+		return nil, false, err
+	}
+	// 同じ鍵で署名されたステータスリストトークンなどをアクセストークンとして受け付けない
+	if typ, ok := token.Header["typ"]; ok {
+		if s, _ := typ.(string); !strings.EqualFold(s, "JWT") {
+			return nil, false, fmt.Errorf("unexpected token type: %v", typ)
+		}
 	}
 
-	if claims, ok := token.Claims.(*MyCustomClaims); ok && token.Valid {
+	claims, ok = token.Claims.(*MyCustomClaims)
+	if ok && token.Valid {
 		slog.Info("token is valid", "claims", claims)
 	} else {
 		slog.Info("token is invalid", "claims", claims)
-		return false, nil // エラーなしでNG
+		return nil, false, nil // エラーなしでNG
 	}
 
-	return true, nil
+	if v.CheckStatus && claims.Status != nil {
+		if err := v.checkStatus(claims.Status); err != nil {
+			return nil, false, err
+		}
+	}
+
+	return claims, true, nil
+}
+
+// decrypt は JWE を DecryptionKey で復号し、内側の署名済みトークンを返す
+func (v *Verifier) decrypt(token string) (string, error) {
+	if v.DecryptionKey == nil {
+		return "", errors.New("token is encrypted but no decryption key is configured")
+	}
+	payload, header, err := jwe.Decrypt(token, v.DecryptionKey)
+	if err != nil {
+		return "", err
+	}
+	if header.Cty != "JWT" {
+		return "", fmt.Errorf("unexpected JWE cty: %q (expected \"JWT\")", header.Cty)
+	}
+	slog.Info("decrypted JWE", "alg", header.Alg, "enc", header.Enc, "kid", header.Kid)
+	return string(payload), nil
 }
@@ -12,10 +12,11 @@ func main() {
 }
 
 func init() {
-	// init 関数で slog の初期化を行う。形式は JSON 形式で出力する。
+	// init 関数で slog の初期化を行う。形式は JSON 形式で stderr に出力する。
+	// stdout はトークンなどコマンドの出力結果のみに使う。
 	opts := &slog.HandlerOptions{
 		AddSource: true,
 	}
 
-	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, opts)))
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, opts)))
 }